@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Alert is one failure in -output alerts, kept small enough for an alert
+// dispatcher to route on kind without knowing the rest of the report
+type Alert struct {
+	URL     string `json:"url"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// runAlerts lists every failure in run, using the same rules as
+// -fail-on-error so the two always agree. Statuses the user opted out of
+// failing on, such as an unfollowed redirect, a 304 or a 4xx under
+// -4xx-as-warning, stay quiet.
+func runAlerts(run RunResult) []Alert {
+	var alerts []Alert
+	for _, failure := range run.DNSFailures {
+		alerts = append(alerts, Alert{URL: failure.URL, Kind: "dns", Message: failure.Error})
+	}
+	for _, violation := range run.HTTPSViolations {
+		alerts = append(alerts, Alert{URL: violation.URL, Kind: "https", Message: "plaintext http:// URL"})
+	}
+	for _, result := range run.Pings {
+		if !pingFailed(result) {
+			continue
+		}
+		if result.Error != nil {
+			alerts = append(alerts, Alert{URL: result.URL, Kind: "ping", Message: result.Error.Error()})
+		} else if result.PacketLoss <= *lossCrit && result.RTTBreach {
+			alerts = append(alerts, Alert{URL: result.URL, Kind: "rtt", Message: fmt.Sprintf("average RTT %s", formatDuration(result.AvgRtt))})
+		} else {
+			alerts = append(alerts, Alert{URL: result.URL, Kind: "loss", Message: fmt.Sprintf("%.0f%% packet loss", result.PacketLoss)})
+		}
+	}
+	for _, result := range run.Fetches {
+		if fetchFailed(result) {
+			alerts = append(alerts, fetchAlert(result))
+		}
+	}
+	return alerts
+}
+
+// fetchAlert describes why a failed fetch counts as a failure, taking the
+// first of fetchFailed's reasons that applies
+func fetchAlert(result FetchResult) Alert {
+	alert := Alert{URL: result.URL}
+	switch {
+	case result.Error != nil:
+		alert.Kind, alert.Message = "fetch", result.Error.Error()
+	case result.CheckOK != nil && !*result.CheckOK:
+		alert.Kind, alert.Message = "check", result.CheckFailure
+	case result.FinalHostMismatch != "":
+		alert.Kind, alert.Message = "final_host", "ended on "+result.FinalHostMismatch
+	case result.SLABreach:
+		alert.Kind, alert.Message = "sla", fmt.Sprintf("took %s", formatDuration(result.Duration))
+	default:
+		alert.Kind, alert.Message = "status", fmt.Sprintf("HTTP %d", result.StatusCode)
+	}
+	return alert
+}
+
+// alertsReporter writes one JSON object per failure, and nothing at all
+// for a healthy run
+type alertsReporter struct{}
+
+func (alertsReporter) Report(w io.Writer, run RunResult) error {
+	encoder := json.NewEncoder(w)
+	for _, alert := range runAlerts(run) {
+		if err := encoder.Encode(alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunAlertsFetches(t *testing.T) {
+	fail := false
+	tests := []struct {
+		name   string
+		result FetchResult
+		// kind is the alert expected, or "" for none
+		kind    string
+		message string
+	}{
+		{"200", FetchResult{StatusCode: 200}, "", ""},
+		{"204", FetchResult{StatusCode: 204}, "", ""},
+		{"websocket 101", FetchResult{StatusCode: 101, Proto: "WebSocket"}, "", ""},
+		{"unfollowed 301", FetchResult{StatusCode: 301, Location: "https://a.example/"}, "", ""},
+		{"conditional 304", FetchResult{StatusCode: 304}, "", ""},
+		{"404", FetchResult{StatusCode: 404}, "status", "HTTP 404"},
+		{"4xx as warning", FetchResult{StatusCode: 404, ClientErrorWarning: true}, "", ""},
+		{"final host mismatch", FetchResult{StatusCode: 200, FinalHostMismatch: "b.example"}, "final_host", "ended on b.example"},
+		{"503", FetchResult{StatusCode: 503}, "status", "HTTP 503"},
+		{"error", FetchResult{Error: errors.New("connection refused")}, "fetch", "connection refused"},
+		{"failed check", FetchResult{StatusCode: 200, CheckOK: &fail, CheckFailure: "want 201"}, "check", "want 201"},
+		{"SLA breach", FetchResult{StatusCode: 200, SLABreach: true}, "sla", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.result.URL = "https://a.example/"
+			alerts := runAlerts(RunResult{Fetches: []FetchResult{tt.result}})
+			if tt.kind == "" {
+				if len(alerts) != 0 {
+					t.Errorf("got alerts %v, want none", alerts)
+				}
+				return
+			}
+			if len(alerts) != 1 {
+				t.Fatalf("got %d alerts, want 1", len(alerts))
+			}
+			if alerts[0].Kind != tt.kind || !strings.HasPrefix(alerts[0].Message, tt.message) {
+				t.Errorf("got %s %q, want %s %q", alerts[0].Kind, alerts[0].Message, tt.kind, tt.message)
+			}
+		})
+	}
+}
+
+func TestAlertsReporter(t *testing.T) {
+	healthy := RunResult{
+		Pings: []PingResult{{URL: "https://a.example/", PacketsSent: 3, PacketsRecv: 3}},
+		// Statuses the user opted out of failing on are healthy too
+		Fetches: []FetchResult{
+			{URL: "https://a.example/", StatusCode: 200},
+			{URL: "https://a.example/old", StatusCode: 301, Location: "https://a.example/"},
+			{URL: "https://a.example/cached", StatusCode: 304},
+			{URL: "https://a.example/gone", StatusCode: 404, ClientErrorWarning: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := (alertsReporter{}).Report(&buf, healthy); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("a healthy run printed %q, want nothing", buf.String())
+	}
+
+	unhealthy := RunResult{
+		Pings:   []PingResult{{URL: "https://b.example/", PacketsSent: 3, PacketLoss: 100}},
+		Fetches: []FetchResult{{URL: "https://b.example/", StatusCode: 502}},
+	}
+	buf.Reset()
+	if err := (alertsReporter{}).Report(&buf, unhealthy); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"url":"https://b.example/","kind":"loss","message":"100% packet loss"}` + "\n" +
+		`{"url":"https://b.example/","kind":"status","message":"HTTP 502"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// apiStore holds the latest run for the -api server
+type apiStore struct {
+	mu  sync.RWMutex
+	run *RunResult
+}
+
+// set replaces the latest run
+func (s *apiStore) set(run RunResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = &run
+}
+
+// latest returns the latest run, or nil before the first one finishes
+func (s *apiStore) latest() *RunResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.run
+}
+
+// apiSiteResult is the body of /results/{url}
+type apiSiteResult struct {
+	URL   string       `json:"url"`
+	Ping  *PingResult  `json:"ping,omitempty"`
+	Fetch *FetchResult `json:"fetch,omitempty"`
+}
+
+// startAPI serves the store's results on addr in the background:
+//
+//	/healthz        200 once a run has finished, 503 before
+//	/results        the latest run, in the -report JSON format
+//	/results/{url}  the ping and fetch of one URL, which should be escaped
+func startAPI(addr string, store *apiStore) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if store.latest() == nil {
+			http.Error(w, "no results yet", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /results", func(w http.ResponseWriter, r *http.Request) {
+		run := store.latest()
+		if run == nil {
+			http.Error(w, "no results yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, run)
+	})
+	mux.HandleFunc("GET /results/{url...}", func(w http.ResponseWriter, r *http.Request) {
+		run := store.latest()
+		if run == nil {
+			http.Error(w, "no results yet", http.StatusServiceUnavailable)
+			return
+		}
+		for _, line := range mergeByURL(*run) {
+			if line.url == r.PathValue("url") {
+				writeJSON(w, apiSiteResult{URL: line.url, Ping: line.ping, Fetch: line.fetch})
+				return
+			}
+		}
+		http.Error(w, "unknown url", http.StatusNotFound)
+	})
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Serving -api: %v", err)))
+			os.Exit(1)
+		}
+	}()
+}
+
+// writeJSON sends v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// asnInfo is the autonomous system an IP belongs to
+type asnInfo struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// String renders the AS as "AS13335 Cloudflare, Inc.", or "-" when the
+// IP isn't in the database
+func (a asnInfo) String() string {
+	if a.Number == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("AS%d %s", a.Number, a.Org)
+}
+
+// asnLookup maps IPs to their AS using an offline MaxMind-format database
+// such as GeoLite2-ASN, remembering every answer
+type asnLookup struct {
+	db    *maxminddb.Reader
+	mu    sync.Mutex
+	cache map[string]asnInfo
+}
+
+// openASN opens the database at path
+func openASN(path string) (*asnLookup, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &asnLookup{db: db, cache: make(map[string]asnInfo)}, nil
+}
+
+// lookup returns the AS of ip; unknown or unparseable IPs get the zero
+// asnInfo
+func (a *asnLookup) lookup(ip string) asnInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if info, ok := a.cache[ip]; ok {
+		return info
+	}
+	var info asnInfo
+	if parsed := net.ParseIP(ip); parsed != nil {
+		// A failed lookup leaves info empty, shown as "-"
+		_ = a.db.Lookup(parsed, &info)
+	}
+	a.cache[ip] = info
+	return info
+}
+
+// asnDB is set when -asn is on and its database opened
+var asnDB *asnLookup
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Assertion is a per-site success criterion. Every condition that is set
+// must hold for the check to pass.
+type Assertion struct {
+	// Status is the exact status code required, or 0 for any
+	Status int `yaml:"status"`
+	// BodyContains must appear in the body
+	BodyContains string `yaml:"body_contains"`
+	// BodyNotContains must not appear in the body
+	BodyNotContains string `yaml:"body_not_contains"`
+	// BodyRegex is a regular expression the body must match
+	BodyRegex string `yaml:"body_regex"`
+
+	// bodyRegex is BodyRegex compiled by compile
+	bodyRegex *regexp.Regexp
+}
+
+// compile prepares BodyRegex, so a bad pattern is reported when the config
+// is loaded rather than on every fetch
+func (a *Assertion) compile() error {
+	if a.BodyRegex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(a.BodyRegex)
+	if err != nil {
+		return fmt.Errorf("body_regex: %w", err)
+	}
+	a.bodyRegex = re
+	return nil
+}
+
+// needsBody reports whether the assertion looks at the response body
+func (a Assertion) needsBody() bool {
+	return a.BodyContains != "" || a.BodyNotContains != "" || a.BodyRegex != ""
+}
+
+// check evaluates the assertion against a response, returning whether it
+// passed and, when it didn't, the first condition that failed
+func (a Assertion) check(status int, body []byte) (bool, string) {
+	if a.Status != 0 && status != a.Status {
+		return false, fmt.Sprintf("want %d", a.Status)
+	}
+	if a.BodyContains != "" && !bytes.Contains(body, []byte(a.BodyContains)) {
+		return false, fmt.Sprintf("missing %q", a.BodyContains)
+	}
+	if a.BodyNotContains != "" && bytes.Contains(body, []byte(a.BodyNotContains)) {
+		return false, fmt.Sprintf("found %q", a.BodyNotContains)
+	}
+	if a.bodyRegex != nil && !a.bodyRegex.Match(body) {
+		return false, fmt.Sprintf("no match for /%s/", a.BodyRegex)
+	}
+	return true, ""
+}
+
+// checkCell renders the OK/FAIL column, or "-" for sites without an
+// assertion
+func checkCell(result FetchResult) (string, lipgloss.Style) {
+	switch {
+	case result.CheckOK == nil:
+		return "-", cellStyle
+	case *result.CheckOK:
+		return "OK", padded(successStyle)
+	}
+	return "FAIL", padded(errorStyle)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckCellIsPadded(t *testing.T) {
+	pass, fail := true, false
+	tests := []struct {
+		checkOK *bool
+		want    string
+	}{
+		{nil, " -      "},
+		{&pass, " OK     "},
+		{&fail, " FAIL   "},
+	}
+	for _, tt := range tests {
+		text, style := checkCell(FetchResult{CheckOK: tt.checkOK})
+		if got := style.Width(8).Render(text); got != tt.want {
+			t.Errorf("check cell = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// loadConfig writes config to a websites file and loads it, returning
+// what loadWebsitesFile panicked with, if anything
+func loadConfig(t *testing.T, config string) (websites []Website, failure any) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "websites.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, configPath, path)
+	setFlag(t, format, "")
+	defer func() { failure = recover() }()
+	return loadWebsitesFile().Websites, nil
+}
+
+func TestBodyRegex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<p>build 7</p>\nversion: 1.24.3\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		pattern string
+		ok      bool
+		failure string
+	}{
+		{"match", `version: \d+\.\d+\.\d+`, true, ""},
+		{"multiline match", `(?m)^version: 1\.24\.\d+$`, true, ""},
+		{"no match", `version: 2\.`, false, `no match for /version: 2\./`},
+		{"anchored no match", `^version`, false, `no match for /^version/`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			websites, failure := loadConfig(t, fmt.Sprintf("websites:\n  - url: %s\n    assert:\n      body_regex: '%s'\n", server.URL, tt.pattern))
+			if failure != nil {
+				t.Fatalf("loading failed: %v", failure)
+			}
+			site := websites[0]
+			if site.Assert.bodyRegex == nil {
+				t.Fatal("the pattern wasn't compiled at load time")
+			}
+
+			result := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if result.CheckOK == nil || *result.CheckOK != tt.ok {
+				t.Errorf("CheckOK = %v, want %v", result.CheckOK, tt.ok)
+			}
+			if result.CheckFailure != tt.failure {
+				t.Errorf("failure = %q, want %q", result.CheckFailure, tt.failure)
+			}
+			if got := fetchFailed(result); got != !tt.ok {
+				t.Errorf("fetchFailed = %v, want %v", got, !tt.ok)
+			}
+		})
+	}
+}
+
+func TestBodyRegexInvalid(t *testing.T) {
+	for _, pattern := range []string{`version: (\d+`, `[z-a]`, `x**`} {
+		t.Run(pattern, func(t *testing.T) {
+			_, failure := loadConfig(t, fmt.Sprintf("websites:\n  - url: https://a.example/\n    assert:\n      body_regex: '%s'\n", pattern))
+			err, ok := failure.(error)
+			if !ok || !strings.HasPrefix(err.Error(), "https://a.example/: body_regex: error parsing regexp") {
+				t.Errorf("loading panicked with %v, want the site's bad pattern reported", failure)
+			}
+		})
+	}
+}
+
+func TestAssertionCombined(t *testing.T) {
+	body := []byte("<p>build 7</p>\nstatus: healthy\n")
+	tests := []struct {
+		name    string
+		assert  Assertion
+		status  int
+		ok      bool
+		failure string
+	}{
+		{"all clauses pass", Assertion{Status: 200, BodyContains: "healthy", BodyNotContains: "error", BodyRegex: `build \d+`}, 200, true, ""},
+		{"status fails first", Assertion{Status: 200, BodyContains: "missing", BodyRegex: `nope`}, 503, false, "want 200"},
+		{"body_contains fails before the regex", Assertion{Status: 200, BodyContains: "ready", BodyRegex: `nope`}, 200, false, `missing "ready"`},
+		{"body_not_contains fails before the regex", Assertion{BodyContains: "healthy", BodyNotContains: "build", BodyRegex: `nope`}, 200, false, `found "build"`},
+		{"regex fails last", Assertion{Status: 200, BodyContains: "healthy", BodyNotContains: "error", BodyRegex: `build [a-z]+`}, 200, false, "no match for /build [a-z]+/"},
+		{"body_not_contains with a matching status", Assertion{Status: 200, BodyNotContains: "healthy"}, 200, false, `found "healthy"`},
+		{"body_not_contains with a matching status passes", Assertion{Status: 200, BodyNotContains: "error"}, 200, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.assert.compile(); err != nil {
+				t.Fatal(err)
+			}
+			ok, failure := tt.assert.check(tt.status, body)
+			if ok != tt.ok || failure != tt.failure {
+				t.Errorf("check = %v, %q, want %v, %q", ok, failure, tt.ok, tt.failure)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// HTTPSViolation is a site that -require-https found configured with a
+// plaintext http:// URL
+type HTTPSViolation struct {
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+}
+
+// auditHTTPS lists the sites whose URL uses http://, skipping hosts in
+// exempt and sites reached over a Unix socket, which never leave the
+// machine
+func auditHTTPS(sites []Website, exempt []string) []HTTPSViolation {
+	var violations []HTTPSViolation
+	for _, site := range sites {
+		if _, _, ok := site.unixSocket(); ok {
+			continue
+		}
+		u, err := url.Parse(site.URL)
+		if err != nil || !strings.EqualFold(u.Scheme, "http") {
+			continue
+		}
+		if slices.ContainsFunc(exempt, func(host string) bool { return strings.EqualFold(host, u.Hostname()) }) {
+			continue
+		}
+		violations = append(violations, HTTPSViolation{URL: site.URL, Name: site.Name})
+	}
+	return violations
+}
+
+// renderHTTPSAudit lists the plaintext sites found by -require-https
+func renderHTTPSAudit(w io.Writer, violations []HTTPSViolation) {
+	if len(violations) == 0 {
+		return
+	}
+
+	auditTitle := titleStyle.Render(" HTTPS Audit ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(auditTitle))
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(labelWidth).Render(siteHeader()),
+		headerStyle.Width(48).Render("Violation"),
+	)}
+	for _, violation := range violations {
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(labelWidth).Render(fitCell(siteLabel(violation.Name, violation.URL), labelWidth)),
+			errorStyle.Width(48).Render("plaintext http:// URL"),
+		))
+	}
+	fmt.Fprintln(w, tableStyle.Render(lipgloss.JoinVertical(lipgloss.Left, rows...)))
+}
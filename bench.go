@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/time/rate"
+)
+
+// BenchmarkResult summarises a -benchmark run
+type BenchmarkResult struct {
+	URL         string        `json:"url"`
+	Requests    int           `json:"requests"`
+	Concurrency int           `json:"concurrency"`
+	Elapsed     time.Duration `json:"elapsed"`
+	// Completed counts the requests that finished, successfully or not
+	Completed int `json:"completed"`
+	// Errors counts requests that failed or returned a 4xx/5xx status
+	Errors int `json:"errors"`
+	// Statuses counts the responses by status code
+	Statuses map[int]int `json:"statuses"`
+	// Latencies holds the duration of every request that got a response,
+	// shortest first
+	Latencies []time.Duration `json:"-"`
+	// Interrupted is set when the benchmark was stopped before all
+	// requests had been sent
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// requestsPerSecond is the completed requests over the wall-clock time
+func (b BenchmarkResult) requestsPerSecond() float64 {
+	if b.Elapsed <= 0 {
+		return 0
+	}
+	return float64(b.Completed) / b.Elapsed.Seconds()
+}
+
+// percentile returns the nearest-rank p-th percentile latency, or 0 when
+// nothing completed
+func (b BenchmarkResult) percentile(p float64) time.Duration {
+	if len(b.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(b.Latencies))))
+	return b.Latencies[max(rank-1, 0)]
+}
+
+// MarshalJSON adds the derived figures a consumer would otherwise have to
+// recompute from the latencies
+func (b BenchmarkResult) MarshalJSON() ([]byte, error) {
+	type plain BenchmarkResult
+	return json.Marshal(struct {
+		plain
+		RequestsPerSecond float64       `json:"requests_per_second"`
+		P50               time.Duration `json:"p50"`
+		P90               time.Duration `json:"p90"`
+		P99               time.Duration `json:"p99"`
+		Max               time.Duration `json:"max"`
+	}{plain(b), b.requestsPerSecond(), b.percentile(50), b.percentile(90), b.percentile(99), b.percentile(100)})
+}
+
+// runBenchmark sends n fetches of target, at most c at a time, through the
+// same fetch core as a normal run. Retries are turned off so every request
+// counts once. Requests not yet sent when ctx is cancelled are skipped.
+func runBenchmark(ctx context.Context, target string, n, c int, limiter *rate.Limiter) BenchmarkResult {
+	site := Website{URL: target, Retry: &RetryPolicy{Attempts: 1}}
+	client := newFetchClient()
+	bench := BenchmarkResult{URL: target, Requests: n, Concurrency: c, Statuses: make(map[int]int)}
+
+	var mu sync.Mutex
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range c {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next.Add(1) <= int64(n) {
+				if ctx.Err() != nil {
+					return
+				}
+				result := fetch(ctx, client, site, limiter)
+				if cancelled(ctx, result.Error) {
+					return
+				}
+				mu.Lock()
+				bench.Completed++
+				if result.Error != nil || result.StatusCode >= 400 {
+					bench.Errors++
+				}
+				if result.Error == nil {
+					bench.Latencies = append(bench.Latencies, result.Duration)
+					bench.Statuses[result.StatusCode]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	bench.Elapsed = time.Since(start)
+	bench.Interrupted = ctx.Err() != nil
+	slices.Sort(bench.Latencies)
+	return bench
+}
+
+// reportBenchmark writes bench as JSON with durations in -time-unit under
+// -output json, and as a table otherwise
+func reportBenchmark(w io.Writer, bench BenchmarkResult) error {
+	if *output == "json" {
+		return encodeTimed(w, bench, *timeUnit)
+	}
+	renderBenchmark(w, bench)
+	return nil
+}
+
+// renderBenchmark draws the benchmark summary in the style of the timing
+// table
+func renderBenchmark(w io.Writer, bench BenchmarkResult) {
+	title := titleStyle.Render(" Benchmark ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(title))
+	if bench.Interrupted {
+		fmt.Fprintln(w, warningStyle.Bold(true).Render(" ⚠ Interrupted; results are partial "))
+	}
+
+	errorRate := 0.0
+	if bench.Completed > 0 {
+		errorRate = 100 * float64(bench.Errors) / float64(bench.Completed)
+	}
+	errorText := fmt.Sprintf("%d (%.1f%%)", bench.Errors, errorRate)
+	errorCell := successStyle.Render(errorText)
+	if bench.Errors > 0 {
+		errorCell = errorStyle.Render(errorText)
+	}
+
+	statuses := make([]int, 0, len(bench.Statuses))
+	for code := range bench.Statuses {
+		statuses = append(statuses, code)
+	}
+	slices.Sort(statuses)
+	statusText := "-"
+	for i, code := range statuses {
+		if i == 0 {
+			statusText = ""
+		} else {
+			statusText += ", "
+		}
+		statusText += fmt.Sprintf("%d×%d", bench.Statuses[code], code)
+	}
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(40).Render("Metric"),
+		headerStyle.Width(40).Render("Value"),
+	)}
+	for _, row := range [][2]string{
+		{"URL", truncateString(bench.URL, 36)},
+		{"Requests", fmt.Sprintf("%d of %d at concurrency %d", bench.Completed, bench.Requests, bench.Concurrency)},
+		{"Elapsed", formatDuration(bench.Elapsed)},
+		{"Requests/sec", fmt.Sprintf("%.1f", bench.requestsPerSecond())},
+		{"Errors", errorCell},
+		{"Statuses", statusText},
+		{"Latency p50", formatDuration(bench.percentile(50))},
+		{"Latency p90", formatDuration(bench.percentile(90))},
+		{"Latency p99", formatDuration(bench.percentile(99))},
+		{"Latency max", formatDuration(bench.percentile(100))},
+	} {
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(40).Render(row[0]),
+			cellStyle.Width(40).Render(row[1]),
+		))
+	}
+	fmt.Fprintln(w, tableStyle.Width(80).Render(lipgloss.JoinVertical(lipgloss.Left, rows...)))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBenchmarkSamples(t *testing.T) {
+	var inFlight, peak, served atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		// Every fifth request fails
+		if served.Add(1)%5 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct{ n, c int }{{1, 1}, {25, 4}, {10, 20}}
+	for _, tt := range tests {
+		served.Store(0)
+		peak.Store(0)
+		bench := runBenchmark(context.Background(), server.URL, tt.n, tt.c, newLimiter(0))
+		if bench.Completed != tt.n || len(bench.Latencies) != tt.n {
+			t.Errorf("n=%d c=%d: %d completed with %d samples, want %d of each", tt.n, tt.c, bench.Completed, len(bench.Latencies), tt.n)
+		}
+		if got := bench.Statuses[200] + bench.Statuses[500]; got != tt.n {
+			t.Errorf("n=%d c=%d: counted %d statuses, want %d", tt.n, tt.c, got, tt.n)
+		}
+		if bench.Errors != tt.n/5 || bench.Statuses[500] != tt.n/5 {
+			t.Errorf("n=%d c=%d: %d errors and %d 500s, want %d", tt.n, tt.c, bench.Errors, bench.Statuses[500], tt.n/5)
+		}
+		if got := int(peak.Load()); got > min(tt.n, tt.c) {
+			t.Errorf("n=%d c=%d: %d requests in flight at once", tt.n, tt.c, got)
+		}
+		for i := 1; i < len(bench.Latencies); i++ {
+			if bench.Latencies[i] < bench.Latencies[i-1] {
+				t.Fatalf("n=%d c=%d: latencies not sorted", tt.n, tt.c)
+			}
+		}
+	}
+}
+
+func TestReportBenchmarkTimeUnit(t *testing.T) {
+	setFlag(t, output, "json")
+	setFlag(t, timeUnit, "ms")
+	bench := BenchmarkResult{
+		URL:       "https://a.example/",
+		Requests:  2,
+		Completed: 2,
+		Elapsed:   3 * time.Second,
+		Latencies: []time.Duration{time.Second, 2 * time.Second},
+	}
+	var buf bytes.Buffer
+	if err := reportBenchmark(&buf, bench); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"elapsed": 3000, "p50": 1000, "p90": 2000, "p99": 2000, "max": 2000, "requests": 2}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	if got["time_unit"] != "ms" {
+		t.Errorf("time_unit = %v, want ms", got["time_unit"])
+	}
+}
+
+func TestRunBenchmarkReachesConcurrency(t *testing.T) {
+	// Each request is held until c of them are in flight together, so a
+	// benchmark that sent fewer at once would stall until the deadline
+	tests := []struct{ n, c int }{{4, 1}, {8, 4}, {3, 10}}
+	for _, tt := range tests {
+		var inFlight, peak atomic.Int32
+		want := int32(min(tt.n, tt.c))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for old := peak.Load(); n > old && !peak.CompareAndSwap(old, n); old = peak.Load() {
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for peak.Load() < want && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}))
+		bench := runBenchmark(context.Background(), server.URL, tt.n, tt.c, newLimiter(0))
+		server.Close()
+		if got := peak.Load(); got != want {
+			t.Errorf("n=%d c=%d: at most %d requests in flight, want %d", tt.n, tt.c, got, want)
+		}
+		if bench.Completed != tt.n || bench.Errors != 0 {
+			t.Errorf("n=%d c=%d: %d completed, %d errors", tt.n, tt.c, bench.Completed, bench.Errors)
+		}
+	}
+}
+
+func TestRunBenchmarkInterrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+	// Cancel as an interrupt does, part way through
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(100*time.Millisecond, cancel).Stop()
+
+	bench := runBenchmark(ctx, server.URL, 1000, 2, newLimiter(0))
+	if !bench.Interrupted {
+		t.Error("cancelled benchmark not marked interrupted")
+	}
+	if bench.Completed == 0 || bench.Completed >= bench.Requests {
+		t.Errorf("completed %d of %d, want some but not all", bench.Completed, bench.Requests)
+	}
+	// The requests the cancel cut off count neither as done nor as errors
+	if bench.Errors != 0 || len(bench.Latencies) != bench.Completed {
+		t.Errorf("%d errors and %d samples for %d completed", bench.Errors, len(bench.Latencies), bench.Completed)
+	}
+}
+
+func TestBenchmarkFigures(t *testing.T) {
+	ms := func(n ...int) []time.Duration {
+		var d []time.Duration
+		for _, v := range n {
+			d = append(d, time.Duration(v)*time.Millisecond)
+		}
+		return d
+	}
+	tests := []struct {
+		name               string
+		bench              BenchmarkResult
+		rps                float64
+		p50, p90, p99, max time.Duration
+	}{
+		{"none", BenchmarkResult{}, 0, 0, 0, 0, 0},
+		{"one", BenchmarkResult{Completed: 1, Elapsed: 500 * time.Millisecond, Latencies: ms(7)}, 2, 7 * time.Millisecond, 7 * time.Millisecond, 7 * time.Millisecond, 7 * time.Millisecond},
+		{"ten", BenchmarkResult{Completed: 10, Elapsed: 2 * time.Second, Latencies: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)}, 5, 5 * time.Millisecond, 9 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+		{"errors count toward rps", BenchmarkResult{Completed: 4, Errors: 2, Elapsed: time.Second, Latencies: ms(1, 3)}, 4, time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.bench
+			if got := b.requestsPerSecond(); got != tt.rps {
+				t.Errorf("requests/sec = %v, want %v", got, tt.rps)
+			}
+			got := []time.Duration{b.percentile(50), b.percentile(90), b.percentile(99), b.percentile(100)}
+			if want := []time.Duration{tt.p50, tt.p90, tt.p99, tt.max}; !slices.Equal(got, want) {
+				t.Errorf("p50/p90/p99/max = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderBenchmark(t *testing.T) {
+	bench := BenchmarkResult{
+		URL: "https://a.example/", Requests: 4, Concurrency: 2, Completed: 4, Errors: 1,
+		Elapsed: time.Second, Statuses: map[int]int{200: 3, 503: 1}, Latencies: []time.Duration{time.Millisecond},
+	}
+	var out strings.Builder
+	renderBenchmark(&out, bench)
+	for _, want := range []string{"4 of 4 at concurrency 2", "4.0", "1 (25.0%)", "3×200, 1×503"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBenchmarkFlags(t *testing.T) {
+	setFlag(t, benchmark, "https://a.example/")
+	tests := []struct {
+		n, c    int
+		output  string
+		wantErr bool
+	}{
+		{100, 10, "table", false},
+		{1, 1, "json", false},
+		{0, 10, "table", true},
+		{100, 0, "table", true},
+		{100, 10, "line", true},
+	}
+	for _, tt := range tests {
+		setFlag(t, benchRequests, tt.n)
+		setFlag(t, benchConcurrency, tt.c)
+		setFlag(t, output, tt.output)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-n %d -c %d -output %s: error = %v, want error %v", tt.n, tt.c, tt.output, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// sourceIP returns the local address -interface names: an IP assigned to
+// this machine, or the first address of a network interface (IPv4 if it
+// has one, unless -family 6 asks for IPv6)
+func sourceIP(spec string) (net.IP, error) {
+	if ip := net.ParseIP(spec); ip != nil {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if prefix, ok := addr.(*net.IPNet); ok && prefix.IP.Equal(ip) {
+				return ip, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not an address of this machine", spec)
+	}
+
+	iface, err := net.InterfaceByName(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an IP address nor a network interface", spec)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", spec, err)
+	}
+	preferred := 4
+	if *family == "6" {
+		preferred = 6
+	}
+	var found net.IP
+	for _, addr := range addrs {
+		prefix, ok := addr.(*net.IPNet)
+		if !ok || prefix.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipVersion(prefix.IP.String()) == preferred {
+			return prefix.IP, nil
+		}
+		if found == nil {
+			found = prefix.IP
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("interface %s has no usable address", spec)
+	}
+	return found, nil
+}
+
+// boundTransport returns a transport whose connections all originate from
+// ip. Connections stay on ip's address family, since a socket bound to an
+// IPv4 address can't reach an IPv6 one.
+func boundTransport(ip net.IP) *http.Transport {
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: ip}}
+	family := "tcp6"
+	if ip.To4() != nil {
+		family = "tcp4"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, family, addr)
+		if err != nil {
+			return nil, fmt.Errorf("from %s: %w", ip, err)
+		}
+		return conn, nil
+	}
+	return transport
+}
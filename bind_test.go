@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		spec, family string
+		want         string
+		err          string
+		linux        bool
+	}{
+		{"127.0.0.1", "auto", "127.0.0.1", "", false},
+		{"::1", "auto", "::1", "", false},
+		{"lo", "auto", "127.0.0.1", "", true},
+		{"lo", "6", "::1", "", true},
+		{"192.0.2.254", "auto", "", "192.0.2.254 is not an address of this machine", false},
+		{"nosuchif0", "auto", "", `"nosuchif0" is neither an IP address nor a network interface`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+" -family "+tt.family, func(t *testing.T) {
+			if tt.linux && runtime.GOOS != "linux" {
+				t.Skip("the loopback interface is only called lo on Linux")
+			}
+			setFlag(t, family, tt.family)
+			ip, err := sourceIP(tt.spec)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Skipf("no %s here: %v", tt.spec, err)
+			}
+			if ip.String() != tt.want {
+				t.Errorf("sourceIP(%q) = %s, want %s", tt.spec, ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInterface(t *testing.T) {
+	tests := []struct {
+		spec  string
+		http3 bool
+		err   string
+	}{
+		{"127.0.0.1", false, ""},
+		{"192.0.2.254", false, "-interface: 192.0.2.254 is not an address of this machine"},
+		{"127.0.0.1", true, "-interface cannot be combined with -http3"},
+	}
+	for _, tt := range tests {
+		setFlag(t, fetchInterface, tt.spec)
+		setFlag(t, useHTTP3, tt.http3)
+		err := validateFlags()
+		if got := errorString(err); got != tt.err {
+			t.Errorf("-interface %s -http3=%v: error = %q, want %q", tt.spec, tt.http3, got, tt.err)
+		}
+	}
+}
+
+func TestFetchFromInterface(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("binding to any 127/8 address needs Linux")
+	}
+	remote := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		remote <- host
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("-interface", func(t *testing.T) {
+		setFlag(t, fetchInterface, "127.0.0.1")
+		result := fetchData(context.Background(), newFetchClient(), Website{URL: server.URL}, newLimiter(0))
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		if got := <-remote; got != "127.0.0.1" {
+			t.Errorf("server saw the fetch from %s, want 127.0.0.1", got)
+		}
+	})
+
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"127.0.0.2", ""},
+		{"192.0.2.254", "from 192.0.2.254: "},
+		{"::1", "from ::1: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			client := newFetchClient()
+			client.Transport = boundTransport(net.ParseIP(tt.source))
+			result := fetchData(context.Background(), client, Website{URL: server.URL, Retry: &RetryPolicy{Attempts: 1}}, newLimiter(0))
+			if tt.err != "" {
+				if result.Error == nil || !strings.Contains(result.Error.Error(), tt.err) {
+					t.Errorf("error = %v, want the binding failure naming the source", result.Error)
+				}
+				return
+			}
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if got := <-remote; got != tt.source {
+				t.Errorf("server saw the fetch from %s, want %s", got, tt.source)
+			}
+		})
+	}
+}
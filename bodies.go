@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsafeFileChars matches runs of characters not allowed in saved body
+// file names, which rules out path separators and traversal
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// maxBodyFileName caps the readable part of a saved body's file name
+const maxBodyFileName = 100
+
+// bodyPath returns where -save-bodies writes the body of rawURL inside
+// dir. The name is the sanitised URL plus a short hash of the original so
+// that URLs differing only in stripped characters don't collide.
+func bodyPath(dir, rawURL string) string {
+	name := rawURL
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	name = unsafeFileChars.ReplaceAllString(name, "_")
+	name = strings.Trim(name, "._")
+	if len(name) > maxBodyFileName {
+		name = name[:maxBodyFileName]
+	}
+	if name == "" {
+		name = "body"
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(rawURL))
+	return filepath.Join(dir, fmt.Sprintf("%s_%08x.html", name, hash.Sum32()))
+}
+
+// bodyFile is the -save-bodies file for one fetch. It is only created on
+// the first write, so a fetch that reads no body, such as a 204 or 304,
+// leaves no empty file that looks like a truncated save.
+type bodyFile struct {
+	path string
+	file *os.File
+}
+
+func (f *bodyFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		file, err := os.Create(f.path)
+		if err != nil {
+			return 0, fmt.Errorf("save body: %w", err)
+		}
+		f.file = file
+	}
+	return f.file.Write(p)
+}
+
+// Close closes the file if one was created
+func (f *bodyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
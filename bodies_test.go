@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestSaveBodies(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name string
+		site Website
+		body string // "" means no file should be written
+	}{
+		{"GET with a body", Website{URL: "/page"}, "hello"},
+		{"HEAD", Website{URL: "/page", Method: http.MethodHead}, ""},
+		{"204 No Content", Website{URL: "/empty"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlag(t, saveBodies, dir)
+			result := fetchTest(t, server, tt.site)
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.body == "" {
+				if result.BodyFile != "" || len(entries) != 0 {
+					t.Errorf("body file = %q with %d files saved, want nothing written", result.BodyFile, len(entries))
+				}
+				return
+			}
+			if result.BodyFile != bodyPath(dir, server.URL+tt.site.URL) {
+				t.Errorf("body file = %q, want %q", result.BodyFile, bodyPath(dir, server.URL+tt.site.URL))
+			}
+			got, err := os.ReadFile(result.BodyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("saved body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fetchColumn describes one selectable column of the fetch table
+type fetchColumn struct {
+	name   string
+	header string
+	width  int
+	// cell returns the text and style of the column for a successful fetch
+	cell func(result FetchResult) (string, lipgloss.Style)
+}
+
+// fetchColumns lists every column the fetch table can show
+var fetchColumns = []fetchColumn{
+	{"url", "URL", labelWidth, func(result FetchResult) (string, lipgloss.Style) {
+		return fitCell(siteLabel(result.Name, result.URL), labelWidth), cellStyle
+	}},
+	{"status", "Status", 16, fetchStatusCell},
+	{"check", "Check", 8, checkCell},
+	{"proto", "Protocol", 10, func(result FetchResult) (string, lipgloss.Style) {
+		return result.Proto, cellStyle
+	}},
+	{"ip", "Pinned IP", 18, func(result FetchResult) (string, lipgloss.Style) {
+		return truncateString(result.PinnedIP, 16), cellStyle
+	}},
+	{"family", "IP", 8, func(result FetchResult) (string, lipgloss.Style) {
+		return formatIPVersion(result.IPVersion), cellStyle
+	}},
+	{"size", "Size (MB)", 12, func(result FetchResult) (string, lipgloss.Style) {
+		return formatSize(result.BodySize), cellStyle
+	}},
+	{"sent", "Sent (B)", 10, func(result FetchResult) (string, lipgloss.Style) {
+		return fmt.Sprintf("%d", result.RequestSize), cellStyle
+	}},
+	{"transfer", "Transfer", 10, transferCell},
+	{"time", "Time", 12, func(result FetchResult) (string, lipgloss.Style) {
+		return formatDuration(result.Duration), cellStyle
+	}},
+	{"ttfb", "TTFB", 12, func(result FetchResult) (string, lipgloss.Style) {
+		if result.TTFB > 0 {
+			return formatDuration(result.TTFB), cellStyle
+		}
+		return "-", cellStyle
+	}},
+	{"redirect", "Redirects", 12, func(result FetchResult) (string, lipgloss.Style) {
+		return formatDuration(result.RedirectTime), cellStyle
+	}},
+	{"final", "Final", 12, func(result FetchResult) (string, lipgloss.Style) {
+		return formatDuration(result.FinalTime), cellStyle
+	}},
+	{"repeat", "Min/Avg/Max", 28, func(result FetchResult) (string, lipgloss.Style) {
+		return repeatCell(result), cellStyle
+	}},
+	{"throughput", "MB/s", 12, func(result FetchResult) (string, lipgloss.Style) {
+		if result.Throughput > 0 {
+			return formatSize(result.Throughput), cellStyle
+		}
+		return "-", cellStyle
+	}},
+	{"checked", "Checked", 12, func(result FetchResult) (string, lipgloss.Style) {
+		return formatAgo(result.CheckedAt), cellStyle
+	}},
+	{"tags", "Tags", 16, func(result FetchResult) (string, lipgloss.Style) {
+		return strings.Join(result.Tags, ", "), padded(infoStyle)
+	}},
+	{"notes", "Notes", 24, func(result FetchResult) (string, lipgloss.Style) {
+		return strings.Join(fetchNotes(result), ", "), notesStyle(result)
+	}},
+}
+
+// defaultFetchColumns are shown when -columns is not given, adding the
+// Check column when any of results had an assertion
+func defaultFetchColumns(results []FetchResult) string {
+	columns := "url,status"
+	for _, result := range results {
+		if result.CheckOK != nil {
+			columns += ",check"
+			break
+		}
+	}
+	columns += ",size"
+	for _, result := range results {
+		if result.RequestSize > 0 {
+			columns += ",sent"
+			break
+		}
+	}
+	if *useHTTP3 {
+		columns += ",proto"
+	}
+	if *pinIP {
+		columns += ",ip"
+	}
+	if *showFamily {
+		columns += ",family"
+	}
+	if *repeat > 1 {
+		columns += ",repeat"
+	}
+	if *throughput {
+		columns += ",throughput"
+	}
+	if *watch > 0 {
+		columns += ",checked"
+	}
+	if len(tagFilter) > 0 {
+		columns += ",tags"
+	}
+	return columns + ",notes"
+}
+
+// selectFetchColumns resolves a comma-separated list of column names
+func selectFetchColumns(spec string) ([]fetchColumn, error) {
+	var selected []fetchColumn
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		column, ok := findFetchColumn(name)
+		if !ok {
+			var valid []string
+			for _, column := range fetchColumns {
+				valid = append(valid, column.name)
+			}
+			return nil, fmt.Errorf("unknown column %q (valid columns: %s)", name, strings.Join(valid, ", "))
+		}
+		selected = append(selected, column)
+	}
+	return selected, nil
+}
+
+func findFetchColumn(name string) (fetchColumn, bool) {
+	for _, column := range fetchColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return fetchColumn{}, false
+}
+
+// fetchStatusCell styles the status code by class, marking redirects
+func fetchStatusCell(result FetchResult) (string, lipgloss.Style) {
+	statusText := fmt.Sprintf("%d", result.StatusCode)
+	if statusOK(result) {
+		return statusText, padded(successStyle)
+	} else if result.StatusCode >= 300 && result.StatusCode < 400 {
+		return statusText + " (Redirect)", padded(warningStyle)
+	} else if result.ClientErrorWarning {
+		return statusText, padded(warningStyle)
+	}
+	return statusText, padded(errorStyle)
+}
+
+// renderFetchHeader renders the header cells of the selected columns
+func renderFetchHeader(columns []fetchColumn) string {
+	var cells []string
+	for _, column := range columns {
+		header := column.header
+		if column.name == "url" {
+			header = siteHeader()
+		}
+		cells = append(cells, headerStyle.Width(column.width).Render(header))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+}
+
+// renderFetchRow renders one fetch result. Failed fetches show the URL followed by
+// the error spanning the remaining width, and stale results are dimmed.
+func renderFetchRow(columns []fetchColumn, result FetchResult) string {
+	stale := isStale(result.CheckedAt)
+
+	if result.Error != nil {
+		var cells []string
+		width := 0
+		for _, column := range columns {
+			width += column.width
+		}
+		if hasColumn(columns, "url") {
+			cells = append(cells, cellStyle.Faint(stale).Width(labelWidth).Render(fitCell(siteLabel(result.Name, result.URL), labelWidth)))
+			width -= labelWidth
+		}
+		cells = append(cells, result.ErrorKind.style().Faint(stale).Width(width).Render(fmt.Sprintf("%s: %v", result.ErrorKind, result.Error)))
+		return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+	}
+
+	var cells []string
+	for _, column := range columns {
+		text, style := column.cell(result)
+		cells = append(cells, style.Faint(stale).Width(column.width).Render(text))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+}
+
+func hasColumn(columns []fetchColumn, name string) bool {
+	for _, column := range columns {
+		if column.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notesStyle highlights notes that point at a security problem
+func notesStyle(result FetchResult) lipgloss.Style {
+	switch {
+	case result.SLABreach, result.Downgrade, result.FinalHostMismatch != "":
+		return padded(errorStyle)
+	case result.CrossDomain, highServerLatency(result), missedHTTP3(result), lengthMismatch(result):
+		return padded(warningStyle)
+	}
+	return cellStyle
+}
+
+// transferCell says how the body was delimited: "chunked" for a chunked
+// response, "length" for one with a Content-Length, and "-" otherwise
+func transferCell(result FetchResult) (string, lipgloss.Style) {
+	switch {
+	case slices.Contains(result.TransferEncoding, "chunked"):
+		return "chunked", padded(infoStyle)
+	case result.ContentLength > 0:
+		return "length", cellStyle
+	default:
+		return "-", cellStyle
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Every fetch table cell needs cellStyle's padding to sit under its header,
+// whatever colour it is drawn in
+func TestFetchCellsArePadded(t *testing.T) {
+	pass, fail := true, false
+	results := map[string]FetchResult{
+		"200":           {URL: "https://a.example/", StatusCode: 200},
+		"302":           {URL: "https://a.example/", StatusCode: 302, Location: "/next"},
+		"404":           {URL: "https://a.example/", StatusCode: 404},
+		"4xx warning":   {URL: "https://a.example/", StatusCode: 404, ClientErrorWarning: true},
+		"SLA breach":    {URL: "https://a.example/", StatusCode: 200, SLABreach: true},
+		"downgrade":     {URL: "https://a.example/", StatusCode: 200, Downgrade: true},
+		"other domain":  {URL: "https://a.example/", StatusCode: 200, CrossDomain: true},
+		"short body":    {URL: "https://a.example/", StatusCode: 200, BodyLength: 10, ContentLength: 20},
+		"check passed":  {URL: "https://a.example/", StatusCode: 200, CheckOK: &pass},
+		"check failed":  {URL: "https://a.example/", StatusCode: 200, CheckOK: &fail, CheckFailure: "want 201"},
+		"chunked":       {URL: "https://a.example/", StatusCode: 200, TransferEncoding: []string{"chunked"}},
+		"tagged":        {URL: "https://a.example/", StatusCode: 200, Tags: []string{"prod"}},
+		"slow response": {URL: "https://a.example/", StatusCode: 200, TTFB: time.Second, FinalTime: time.Second},
+	}
+	for name, result := range results {
+		for _, column := range fetchColumns {
+			_, style := column.cell(result)
+			if style.GetPaddingLeft() != 1 || style.GetPaddingRight() != 1 {
+				t.Errorf("%s: %s cell is padded %d/%d, want 1/1", name, column.name, style.GetPaddingLeft(), style.GetPaddingRight())
+			}
+		}
+	}
+}
+
+func TestNotesCellLinesUp(t *testing.T) {
+	columns, err := selectFetchColumns("status,notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := renderFetchHeader(columns)
+	row := renderFetchRow(columns, FetchResult{URL: "https://a.example/", Name: "a", StatusCode: 200, SLABreach: true})
+	if got, want := strings.Index(row, "SLA breach"), strings.Index(header, "Notes"); got != want {
+		t.Errorf("notes start at %d, want under the header at %d:\n%s\n%s", got, want, header, row)
+	}
+}
+
+func TestFetchRowWidthWithWideText(t *testing.T) {
+	columns, err := selectFetchColumns("url,status,notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := renderFetchHeader(columns)
+	for _, name := range []string{"example.com", "日本語のサイト.jp", "日本語のとても長いサイト名.example.jp", "cafe\u0301.example", "cafe\u0301\u0301\u0301.example"} {
+		row := renderFetchRow(columns, FetchResult{URL: "https://a.example/", Name: name, StatusCode: 200, SLABreach: true})
+		if got, want := strings.Index(row, " 200 "), strings.Index(header, " Status"); lipgloss.Width(row[:got]) != lipgloss.Width(header[:want]) {
+			t.Errorf("%q: status starts at cell %d, want under the header at %d:\n%s\n%s", name, lipgloss.Width(row[:got]), lipgloss.Width(header[:want]), header, row)
+		}
+		if lipgloss.Width(row) != lipgloss.Width(header) {
+			t.Errorf("%q: row is %d cells wide, header %d:\n%s\n%s", name, lipgloss.Width(row), lipgloss.Width(header), header, row)
+		}
+	}
+}
+
+func TestTransferColumn(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first ")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "second")
+	})
+	mux.HandleFunc("/length", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		io.WriteString(w, "fixed")
+	})
+	// /close answers HTTP/1.0 style, the body running until the
+	// connection closes
+	mux.HandleFunc("/close", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		buf.WriteString("HTTP/1.0 200 OK\r\n\r\nuntil close")
+		buf.Flush()
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		encoding []string
+		cell     string
+		body     int
+	}{
+		{"/chunked", []string{"chunked"}, "chunked", len("first second")},
+		{"/length", nil, "length", len("fixed")},
+		{"/close", nil, "-", len("until close")},
+		{"/empty", nil, "-", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result := fetchData(context.Background(), newFetchClient(), Website{URL: server.URL + tt.path}, newLimiter(0))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if !slices.Equal(result.TransferEncoding, tt.encoding) {
+				t.Errorf("TransferEncoding = %q, want %q", result.TransferEncoding, tt.encoding)
+			}
+			if cell, _ := transferCell(result); cell != tt.cell {
+				t.Errorf("transfer cell = %q, want %q", cell, tt.cell)
+			}
+			if result.BodyLength != tt.body {
+				t.Errorf("read %d bytes, want %d", result.BodyLength, tt.body)
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved := strings.Contains(string(data), `"transfer_encoding":["chunked"]`); saved != (tt.cell == "chunked") {
+				t.Errorf("JSON records chunked = %v: %s", saved, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// runDiff prints the changes between two saved reports
+func runDiff(oldPath, newPath string) error {
+	oldRun, err := loadReport(oldPath)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", oldPath, err)
+	}
+	newRun, err := loadReport(newPath)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", newPath, err)
+	}
+
+	diffTitle := titleStyle.Render(" Report Diff ")
+	fmt.Fprintln(out, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(diffTitle))
+	fmt.Fprintln(out, infoStyle.Render(fmt.Sprintf(" %s (%s) → %s (%s)",
+		oldPath, oldRun.StartedAt.Format(time.RFC3339), newPath, newRun.StartedAt.Format(time.RFC3339))))
+
+	fmt.Fprintln(out, tableStyle.Render(diffTable(oldRun, newRun)))
+	return nil
+}
+
+// diffTable renders one row per URL seen in either run
+func diffTable(oldRun, newRun RunResult) string {
+	oldPings, newPings := pingsByURL(oldRun.Pings), pingsByURL(newRun.Pings)
+	oldFetches, newFetches := fetchesByURL(oldRun.Fetches), fetchesByURL(newRun.Fetches)
+
+	// Collect every URL from both runs in a stable order
+	seen := make(map[string]bool)
+	var urls []string
+	for _, run := range []RunResult{oldRun, newRun} {
+		for _, result := range run.Fetches {
+			if !seen[result.URL] {
+				seen[result.URL] = true
+				urls = append(urls, result.URL)
+			}
+		}
+		for _, result := range run.Pings {
+			if !seen[result.URL] {
+				seen[result.URL] = true
+				urls = append(urls, result.URL)
+			}
+		}
+	}
+	sort.Strings(urls)
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(labelWidth).Render("URL"),
+		headerStyle.Width(18).Render("Status"),
+		headerStyle.Width(16).Render("Avg Time Δ"),
+		headerStyle.Width(14).Render("Size Δ (MB)"),
+	)}
+
+	for _, url := range urls {
+		oldFetch, inOld := oldFetches[url]
+		newFetch, inNew := newFetches[url]
+
+		var statusCell string
+		switch {
+		case !inOld && !inNew:
+			statusCell = cellStyle.Width(18).Render("-")
+		case !inOld:
+			statusCell = padded(infoStyle).Width(18).Render("added " + fetchStatus(newFetch))
+		case !inNew:
+			statusCell = padded(warningStyle).Width(18).Render("removed")
+		default:
+			statusCell = padded(statusChangeStyle(oldFetch, newFetch)).Width(18).Render(statusTransition(oldFetch, newFetch))
+		}
+
+		rttCell := cellStyle.Width(16).Render("-")
+		oldPing, pingInOld := oldPings[url]
+		newPing, pingInNew := newPings[url]
+		if pingInOld && pingInNew && pingMeasured(oldPing) && pingMeasured(newPing) {
+			delta := newPing.AvgRtt - oldPing.AvgRtt
+			rttCell = padded(deltaStyle(float64(delta))).Width(16).Render(formatDurationDelta(delta))
+		}
+
+		sizeCell := cellStyle.Width(14).Render("-")
+		if inOld && inNew && oldFetch.Error == nil && newFetch.Error == nil {
+			sizeCell = padded(infoStyle).Width(14).Render(fmt.Sprintf("%+.*f", *decimals, newFetch.BodySize-oldFetch.BodySize))
+		}
+
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(labelWidth).Render(fitCell(url, labelWidth)),
+			statusCell,
+			rttCell,
+			sizeCell,
+		))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
+
+func pingsByURL(results []PingResult) map[string]PingResult {
+	byURL := make(map[string]PingResult, len(results))
+	for _, result := range results {
+		byURL[result.URL] = result
+	}
+	return byURL
+}
+
+func fetchesByURL(results []FetchResult) map[string]FetchResult {
+	byURL := make(map[string]FetchResult, len(results))
+	for _, result := range results {
+		byURL[result.URL] = result
+	}
+	return byURL
+}
+
+// pingMeasured reports whether a ping produced a usable average time
+func pingMeasured(result PingResult) bool {
+	return result.Error == nil && result.Skipped == "" && result.PacketsRecv > 0
+}
+
+// fetchStatus is a short label for a fetch outcome
+func fetchStatus(result FetchResult) string {
+	if result.Error != nil {
+		if result.ErrorKind != ErrorKindNone {
+			return string(result.ErrorKind)
+		}
+		return "error"
+	}
+	return fmt.Sprintf("%d", result.StatusCode)
+}
+
+// fetchHealthy reports whether a fetch succeeded with a non-error status
+func fetchHealthy(result FetchResult) bool {
+	return result.Error == nil && result.StatusCode < 400
+}
+
+func statusTransition(oldFetch, newFetch FetchResult) string {
+	oldStatus, newStatus := fetchStatus(oldFetch), fetchStatus(newFetch)
+	if oldStatus == newStatus {
+		return newStatus
+	}
+	return oldStatus + " → " + newStatus
+}
+
+// statusChangeStyle is green when a fetch recovered and red when it broke
+func statusChangeStyle(oldFetch, newFetch FetchResult) lipgloss.Style {
+	oldOK, newOK := fetchHealthy(oldFetch), fetchHealthy(newFetch)
+	switch {
+	case !oldOK && newOK:
+		return successStyle
+	case oldOK && !newOK:
+		return errorStyle
+	case fetchStatus(oldFetch) != fetchStatus(newFetch):
+		return warningStyle
+	}
+	return cellStyle
+}
+
+// deltaStyle colours a change where smaller values are better
+func deltaStyle(delta float64) lipgloss.Style {
+	switch {
+	case delta < 0:
+		return successStyle
+	case delta > 0:
+		return errorStyle
+	}
+	return cellStyle
+}
+
+func formatDurationDelta(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
+
+// padded gives a colour style the same padding as cellStyle so that
+// columns line up
+func padded(style lipgloss.Style) lipgloss.Style {
+	return style.PaddingLeft(1).PaddingRight(1)
+}
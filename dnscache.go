@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsEntry is a cached resolution and the time it stops being valid
+type dnsEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// dnsCache maps hostnames to resolved IPs for ttl so that large lists and
+// repeated watch runs don't hit the resolver once per ping
+type dnsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]dnsEntry
+}
+
+// newDNSCache returns an empty cache whose entries live for ttl
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// resolve returns the IPs of host, using the cached ones while they are
+// fresh. Failures are never cached.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{ips: ips, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return ips, nil
+}
+
+// lookupHost resolves host to its IPs with IPv4 addresses first, matching
+// what the pinger would choose when resolving the name itself. IP literals
+// are returned unchanged.
+func lookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	release, err := acquireDNSSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	var v4, v6 []string
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			v4 = append(v4, addr.IP.String())
+		} else {
+			v6 = append(v6, addr.IP.String())
+		}
+	}
+	return append(v4, v6...), nil
+}
+
+// resolver does every lookup of both phases: the system's, or one that
+// queries -dns-server
+var resolver = net.DefaultResolver
+
+// serverResolver returns a resolver that sends every query to server
+// (host:port) instead of the system's name servers. The hosts file still
+// applies, as it does for the system resolver.
+func serverResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dnsResolver is shared by every ping and by -pre-resolve; nil when
+// -dns-cache-ttl is 0
+var dnsResolver *dnsCache
+
+// dnsSlots bounds the lookups in flight across both phases under
+// -dns-concurrency; nil leaves them unbounded
+var dnsSlots chan struct{}
+
+// acquireDNSSlot waits for room under -dns-concurrency and returns the
+// function that gives it back, or ctx's error if it is cancelled first
+func acquireDNSSlot(ctx context.Context) (func(), error) {
+	if dnsSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case dnsSlots <- struct{}{}:
+		return func() { <-dnsSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolvingDial wraps dial so that hostnames are looked up with
+// resolveHost, and so within -dns-concurrency and through the DNS cache,
+// rather than by the dialer itself. The addresses are tried in order.
+func resolvingDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		ips, err := resolveHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// resolveHost resolves host through dnsResolver when caching is enabled
+func resolveHost(ctx context.Context, host string) ([]string, error) {
+	if dnsResolver != nil {
+		return dnsResolver.resolve(ctx, host)
+	}
+	return lookupHost(ctx, host)
+}
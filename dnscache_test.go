@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/time/rate"
+)
+
+// stubDNS is a UDP name server answering from a fixed table, counting the
+// A queries it gets for each name and how many it has in flight at once
+type stubDNS struct {
+	addr    string
+	answers map[string][]string
+	// delay holds each answer back, so overlapping lookups show in peak
+	delay time.Duration
+
+	mu       sync.Mutex
+	queries  map[string]int
+	inFlight int
+	peak     int
+}
+
+// newStubDNS serves answers, which maps fully qualified names to their
+// addresses, holding each A answer back for delay. IPv4 addresses answer A
+// queries and IPv6 ones AAAA queries; other names get NXDOMAIN.
+func newStubDNS(t *testing.T, answers map[string][]string, delay time.Duration) *stubDNS {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	stub := &stubDNS{addr: conn.LocalAddr().String(), answers: answers, delay: delay, queries: make(map[string]int)}
+
+	go func() {
+		for {
+			buf := make([]byte, 512)
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			go func() {
+				if msg := stub.answer(buf[:n]); msg != nil {
+					conn.WriteTo(msg, from)
+				}
+			}()
+		}
+	}()
+	return stub
+}
+
+// answer builds the reply to the query in packet, or nil for garbage
+func (s *stubDNS) answer(packet []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil {
+		return nil
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	name := question.Name.String()
+
+	if question.Type == dnsmessage.TypeA {
+		s.mu.Lock()
+		s.queries[name]++
+		s.inFlight++
+		s.peak = max(s.peak, s.inFlight)
+		s.mu.Unlock()
+		time.Sleep(s.delay)
+		defer func() {
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+		}()
+	}
+
+	header.Response = true
+	header.Authoritative = true
+	ips, known := s.answers[name]
+	if !known {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.StartQuestions()
+	b.Question(question)
+	b.StartAnswers()
+	rr := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		switch v4 := parsed.To4(); {
+		case question.Type == dnsmessage.TypeA && v4 != nil:
+			var a dnsmessage.AResource
+			copy(a.A[:], v4)
+			b.AResource(rr, a)
+		case question.Type == dnsmessage.TypeAAAA && v4 == nil:
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], parsed)
+			b.AAAAResource(rr, aaaa)
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// count returns how many A queries name has had
+func (s *stubDNS) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[name]
+}
+
+// peakInFlight returns the most A queries the stub was answering at once
+func (s *stubDNS) peakInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+func TestDNSCache(t *testing.T) {
+	stub := newStubDNS(t, map[string][]string{
+		"cached.test.": {"192.0.2.1"},
+		"other.test.":  {"192.0.2.2"},
+	}, 0)
+	setFlag(t, &resolver, serverResolver(stub.addr))
+
+	const ttl = 200 * time.Millisecond
+	tests := []struct {
+		name    string
+		hosts   []string
+		wait    time.Duration
+		queries map[string]int
+	}{
+		{"hit within the TTL", []string{"cached.test.", "cached.test.", "cached.test."}, 0, map[string]int{"cached.test.": 1}},
+		{"miss after the TTL", []string{"cached.test.", "cached.test."}, 2 * ttl, map[string]int{"cached.test.": 2}},
+		{"hosts cached apart", []string{"other.test.", "cached.test.", "other.test."}, 0, map[string]int{"cached.test.": 1, "other.test.": 1}},
+		{"failures not cached", []string{"missing.test.", "missing.test."}, 0, map[string]int{"missing.test.": 2}},
+	}
+	want := map[string]string{"cached.test.": "192.0.2.1", "other.test.": "192.0.2.2"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newDNSCache(ttl)
+			before := make(map[string]int)
+			for host := range tt.queries {
+				before[host] = stub.count(host)
+			}
+			for i, host := range tt.hosts {
+				if i > 0 {
+					time.Sleep(tt.wait)
+				}
+				ips, err := cache.resolve(context.Background(), host)
+				if ip, known := want[host]; !known {
+					if err == nil {
+						t.Errorf("%s resolved to %v, want an error", host, ips)
+					}
+				} else if err != nil || len(ips) != 1 || ips[0] != ip {
+					t.Errorf("%s resolved to %v, %v, want [%s]", host, ips, err, ip)
+				}
+			}
+			for host, queries := range tt.queries {
+				if got := stub.count(host) - before[host]; got != queries {
+					t.Errorf("%s was looked up %d times, want %d", host, got, queries)
+				}
+			}
+		})
+	}
+}
+
+func TestPingSiteUsesDNSCache(t *testing.T) {
+	stub := newStubDNS(t, map[string][]string{"pinged.test.": {"192.0.2.3"}}, 0)
+	setFlag(t, &resolver, serverResolver(stub.addr))
+	setFlag(t, &dnsResolver, newDNSCache(time.Minute))
+	if _, err := dnsResolver.resolve(context.Background(), "pinged.test."); err != nil {
+		t.Fatal(err)
+	}
+
+	// A spent limiter stops the ping before any packet goes out, by which
+	// point the pinger has taken the address
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result := pingSite(ctx, Website{URL: "http://pinged.test./"}, limiter)
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "exceed context deadline") {
+		t.Errorf("error = %v, want the ping to reach the limiter", result.Error)
+	}
+	if got := stub.count("pinged.test."); got != 1 {
+		t.Errorf("pinged.test. was looked up %d times, want the cached lookup only", got)
+	}
+}
+
+func TestLookupHostIPLiteral(t *testing.T) {
+	// No resolver at all, so any lookup would fail
+	setFlag(t, &resolver, serverResolver("127.0.0.1:1"))
+	for _, ip := range []string{"127.0.0.1", "::1", "2001:db8::1"} {
+		got, err := lookupHost(context.Background(), ip)
+		if err != nil || len(got) != 1 || got[0] != ip {
+			t.Errorf("lookupHost(%q) = %v, %v, want it returned unchanged", ip, got, err)
+		}
+	}
+}
+
+func TestDNSConcurrency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	answers := make(map[string][]string)
+	var pingSites, fetchSites []Website
+	for i := range 8 {
+		ping, fetch := fmt.Sprintf("p%d.test.", i), fmt.Sprintf("f%d.test.", i)
+		answers[ping], answers[fetch] = []string{"127.0.0.1"}, []string{"127.0.0.1"}
+		pingSites = append(pingSites, Website{URL: "http://" + ping + "/"})
+		fetchSites = append(fetchSites, Website{URL: "http://" + net.JoinHostPort(fetch, port) + "/"})
+	}
+	fakePinger(t, func(string) error { return nil })
+	setFlag(t, &dnsResolver, nil)
+
+	tests := []struct {
+		name           string
+		slots          int
+		pings, fetches bool
+	}{
+		{"pings", 2, true, false},
+		{"fetches", 2, false, true},
+		{"both phases share the bound", 3, true, true},
+		{"one at a time", 1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubDNS(t, answers, 30*time.Millisecond)
+			setFlag(t, &resolver, serverResolver(stub.addr))
+			setFlag(t, &dnsSlots, make(chan struct{}, tt.slots))
+
+			var wg sync.WaitGroup
+			if tt.pings {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for _, result := range resultsOf(pingAll(context.Background(), pingSites, newLimiter(0), &abortCounter{})) {
+						if result.Error != nil {
+							t.Errorf("ping %s: %v", result.URL, result.Error)
+						}
+					}
+				}()
+			}
+			if tt.fetches {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for _, result := range resultsOf(fetchAll(context.Background(), fetchSites, newFetchClient(), newLimiter(0), &abortCounter{})) {
+						if result.Error != nil {
+							t.Errorf("fetch %s: %v", result.URL, result.Error)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			if peak := stub.peakInFlight(); peak > tt.slots {
+				t.Errorf("%d lookups in flight at once, want at most %d", peak, tt.slots)
+			} else if tt.slots > 1 && peak < 2 {
+				t.Errorf("lookups never overlapped, want up to %d at once", tt.slots)
+			}
+			if len(dnsSlots) != 0 {
+				t.Errorf("%d slots still held after the run", len(dnsSlots))
+			}
+		})
+	}
+}
+
+// resultsOf drops the phase duration pingAll and fetchAll return
+func resultsOf[T any](results []T, _ time.Duration) []T {
+	return results
+}
+
+func TestAcquireDNSSlotCancelled(t *testing.T) {
+	setFlag(t, &dnsSlots, make(chan struct{}, 1))
+	release, err := acquireDNSSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := acquireDNSSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting on a full bound: error = %v, want the deadline", err)
+	}
+	release()
+	if release, err := acquireDNSSlot(context.Background()); err != nil {
+		t.Errorf("slot not given back: %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestDNSServerFlag(t *testing.T) {
+	tests := []struct {
+		value, want string
+		wantErr     bool
+	}{
+		{"8.8.8.8", "8.8.8.8:53", false},
+		{"8.8.8.8:5353", "8.8.8.8:5353", false},
+		{"2001:4860:4860::8888", "[2001:4860:4860::8888]:53", false},
+		{"[2001:4860:4860::8888]", "[2001:4860:4860::8888]:53", false},
+		{"[2001:4860:4860::8888]:5353", "[2001:4860:4860::8888]:5353", false},
+		{"dns.google", "", true},
+		{"dns.google:53", "", true},
+		{"8.8.8.8:dns", "", true},
+	}
+	for _, tt := range tests {
+		setFlag(t, dnsServer, tt.value)
+		err := validateFlags()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("-dns-server %s: error = %v, want error %v", tt.value, err, tt.wantErr)
+		} else if err == nil && *dnsServer != tt.want {
+			t.Errorf("-dns-server %s became %s, want %s", tt.value, *dnsServer, tt.want)
+		}
+	}
+
+	setFlag(t, dnsServer, "8.8.8.8")
+	setFlag(t, useHTTP3, true)
+	if err := validateFlags(); err == nil {
+		t.Error("-dns-server accepted with -http3")
+	}
+}
+
+// Every lookup of both phases goes to -dns-server, so a split-horizon name
+// reaches the address that server gives rather than the system's
+func TestDNSServer(t *testing.T) {
+	var seen atomic.Value
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	stub := newStubDNS(t, map[string][]string{"intranet.split.test.": {"127.0.0.3"}}, 0)
+	setFlag(t, &resolver, serverResolver(stub.addr))
+	setFlag(t, &dnsSlots, nil)
+	var pinged string
+	fakePinger(t, func(ip string) error {
+		pinged = ip
+		return nil
+	})
+
+	site := Website{URL: "http://intranet.split.test.:" + port + "/"}
+	tests := []struct {
+		name    string
+		cache   bool
+		resolve bool
+	}{
+		{"uncached", false, false},
+		{"through the cache", true, false},
+		{"pre-resolved", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &dnsResolver, nil)
+			if tt.cache {
+				dnsResolver = newDNSCache(time.Minute)
+			}
+			site := site
+			if tt.resolve {
+				kept, _, failures := resolveAll(context.Background(), []Website{site}, 1)
+				if len(failures) > 0 {
+					t.Fatalf("pre-resolve failed: %+v", failures)
+				}
+				site = kept[0]
+				if !slices.Equal(site.IPs, []string{"127.0.0.3"}) {
+					t.Errorf("pre-resolved to %v, want the stub's 127.0.0.3", site.IPs)
+				}
+			}
+			before := stub.count("intranet.split.test.")
+
+			pinged = ""
+			ping := pingUrl(context.Background(), site, newLimiter(0))
+			if ping.Error != nil || pinged != "127.0.0.3" {
+				t.Errorf("pinged %q (error %v), want the stub's 127.0.0.3", pinged, ping.Error)
+			}
+			fetch := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if fetch.Error != nil {
+				t.Fatal(fetch.Error)
+			}
+			if got, _ := seen.Load().(string); !strings.HasPrefix(got, "127.0.0.3:") {
+				t.Errorf("fetch arrived on %s, want the stub's 127.0.0.3", got)
+			}
+
+			want := 2
+			switch {
+			case tt.resolve:
+				want = 0
+			case tt.cache:
+				want = 1
+			}
+			if got := stub.count("intranet.split.test.") - before; got != want {
+				t.Errorf("stub answered %d lookups for the ping and fetch, want %d", got, want)
+			}
+		})
+	}
+
+	// Names the stub doesn't know fail rather than falling back to the
+	// system resolver
+	setFlag(t, &dnsResolver, nil)
+	unknown := Website{URL: "http://other.split.test.:" + port + "/", Retry: &RetryPolicy{Attempts: 1}}
+	var dnsErr *net.DNSError
+	if ping := pingUrl(context.Background(), unknown, newLimiter(0)); !errors.As(ping.Error, &dnsErr) {
+		t.Errorf("ping of an unknown name: error = %v, want a DNS error", ping.Error)
+	}
+	if fetch := fetchData(context.Background(), newFetchClient(), unknown, newLimiter(0)); fetch.ErrorKind != ErrorKindDNS {
+		t.Errorf("fetch of an unknown name: kind %q, want %q (%v)", fetch.ErrorKind, ErrorKindDNS, fetch.Error)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrorKind is a coarse category for a failed fetch, used to label and
+// colour error rows consistently
+type ErrorKind string
+
+const (
+	ErrorKindNone    ErrorKind = ""
+	ErrorKindDNS     ErrorKind = "DNS"
+	ErrorKindRefused ErrorKind = "REFUSED"
+	ErrorKindTLS     ErrorKind = "TLS"
+	ErrorKindTimeout ErrorKind = "TIMEOUT"
+	ErrorKindHTTP    ErrorKind = "HTTP"
+	ErrorKindHook    ErrorKind = "HOOK"
+)
+
+// classifyError inspects err to work out which stage of the request failed
+func classifyError(err error) ErrorKind {
+	if err == nil {
+		return ErrorKindNone
+	}
+
+	// A hook that times out is the hook's fault, not the site's
+	var hookErr *hookError
+	if errors.As(err, &hookErr) {
+		return ErrorKindHook
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// A resolver that times out is still a DNS problem
+		return ErrorKindDNS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorKindRefused
+	}
+
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		recordErr   tls.RecordHeaderError
+		alertErr    tls.AlertError
+		unknownAuth x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidCert x509.CertificateInvalidError
+	)
+	if errors.As(err, &verifyErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuth) || errors.As(err, &hostnameErr) || errors.As(err, &invalidCert) {
+		return ErrorKindTLS
+	}
+
+	return ErrorKindHTTP
+}
+
+// style returns the style used to render errors of this kind
+func (k ErrorKind) style() lipgloss.Style {
+	if k == ErrorKindTimeout {
+		return warningStyle
+	}
+	return errorStyle
+}
@@ -0,0 +1,42 @@
+package main
+
+// pingFailed reports whether a ping counts as a failure for -fail-on-error:
+// it errored, lost more packets than -loss-crit allows or was slower than
+// its -max-rtt
+func pingFailed(result PingResult) bool {
+	if result.Skipped != "" {
+		return false
+	}
+	return result.Error != nil || result.PacketLoss > *lossCrit || result.RTTBreach
+}
+
+// fetchFailed reports whether a fetch counts as a failure for
+// -fail-on-error: it errored, returned a 4xx/5xx status (unless 4xx are
+// warnings), breached its SLA, failed its assertion or ended on a host
+// other than expect_final_host
+func fetchFailed(result FetchResult) bool {
+	if result.CheckOK != nil && !*result.CheckOK {
+		return true
+	}
+	badStatus := result.StatusCode >= 400 && !result.ClientErrorWarning
+	return result.Error != nil || badStatus || result.SLABreach || result.FinalHostMismatch != ""
+}
+
+// runFailed reports whether any result of the run failed, counting hosts
+// that -pre-resolve could not resolve and -require-https violations
+func runFailed(run RunResult) bool {
+	if len(run.DNSFailures) > 0 || len(run.HTTPSViolations) > 0 {
+		return true
+	}
+	for _, result := range run.Pings {
+		if pingFailed(result) {
+			return true
+		}
+	}
+	for _, result := range run.Fetches {
+		if fetchFailed(result) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+)
+
+// ipVersion returns 4 or 6 for an IP address, or 0 when addr isn't one.
+// addr may carry a port, as a connection's remote address does.
+func ipVersion(addr string) int {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return 0
+	case ip.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// familyNetwork narrows a "tcp" or "ip" network to the -family chosen,
+// leaving it alone under auto
+func familyNetwork(network string) string {
+	if *family == "auto" {
+		return network
+	}
+	return network + *family
+}
+
+// filterFamily keeps the addresses of the -family chosen
+func filterFamily(ips []string) []string {
+	if *family == "auto" {
+		return ips
+	}
+	var kept []string
+	for _, ip := range ips {
+		if fmt.Sprint(ipVersion(ip)) == *family {
+			kept = append(kept, ip)
+		}
+	}
+	return kept
+}
+
+// familyDial wraps dial so every connection uses the -family chosen
+func familyDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp" {
+			network = familyNetwork(network)
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// withRemoteAddr records in *addr the remote address of each connection a
+// request made with the returned context uses, so after a redirect chain
+// it holds the final hop's
+func withRemoteAddr(ctx context.Context, addr *string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*addr = info.Conn.RemoteAddr().String()
+		},
+	})
+}
+
+// formatIPVersion renders an IP version as IPv4 or IPv6, or "-" if unknown
+func formatIPVersion(version int) string {
+	if version == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("IPv%d", version)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIPVersion(t *testing.T) {
+	tests := []struct {
+		addr string
+		want int
+	}{
+		{"192.0.2.1", 4},
+		{"192.0.2.1:443", 4},
+		{"::ffff:192.0.2.1", 4},
+		{"2001:db8::1", 6},
+		{"[2001:db8::1]:443", 6},
+		{"example.com", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := ipVersion(tt.addr); got != tt.want {
+			t.Errorf("ipVersion(%q) = %d, want %d", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFilterFamily(t *testing.T) {
+	ips := []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"}
+	tests := []struct {
+		family string
+		want   []string
+	}{
+		{"auto", ips},
+		{"4", []string{"192.0.2.1", "192.0.2.2"}},
+		{"6", []string{"2001:db8::1"}},
+	}
+	for _, tt := range tests {
+		setFlag(t, family, tt.family)
+		if got := filterFamily(ips); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("-family %s kept %v, want %v", tt.family, got, tt.want)
+		}
+	}
+}
+
+// dualStackServer serves on 127.0.0.1 and ::1 at the same port, sending
+// the local address each request arrived on down addrs
+func dualStackServer(t *testing.T, addrs chan<- string) (port string) {
+	t.Helper()
+	v4, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ = net.SplitHostPort(v4.Addr().String())
+	v6, err := net.Listen("tcp6", net.JoinHostPort("::1", port))
+	if err != nil {
+		v4.Close()
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrs <- r.Context().Value(http.LocalAddrContextKey).(net.Addr).String()
+	})}
+	go server.Serve(v4)
+	go server.Serve(v6)
+	t.Cleanup(func() { server.Close() })
+	return port
+}
+
+func TestFamily(t *testing.T) {
+	addrs := make(chan string, 1)
+	port := dualStackServer(t, addrs)
+	stub := newStubDNS(t, map[string][]string{
+		"dual.family.test.": {"127.0.0.1", "::1"},
+		"four.family.test.": {"127.0.0.1"},
+		"six.family.test.":  {"::1"},
+	}, 0)
+	setFlag(t, &resolver, serverResolver(stub.addr))
+	setFlag(t, &dnsResolver, nil)
+	setFlag(t, &dnsSlots, nil)
+	var pinged string
+	fakePinger(t, func(ip string) error {
+		pinged = ip
+		return nil
+	})
+
+	tests := []struct {
+		family, host string
+		// version is the family both operations should use, or 0 when
+		// the host has no address in the forced one
+		version int
+	}{
+		{"auto", "dual", 4},
+		{"4", "dual", 4},
+		{"6", "dual", 6},
+		{"auto", "six", 6},
+		{"4", "six", 0},
+		{"6", "four", 0},
+	}
+	for _, tt := range tests {
+		t.Run("-family "+tt.family+" "+tt.host, func(t *testing.T) {
+			setFlag(t, family, tt.family)
+			site := Website{URL: "http://" + tt.host + ".family.test.:" + port + "/", Retry: &RetryPolicy{Attempts: 1}}
+			wantIP := map[int]string{4: "127.0.0.1", 6: "::1"}[tt.version]
+
+			pinged = ""
+			ping := pingUrl(context.Background(), site, newLimiter(0))
+			fetch := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if tt.version == 0 {
+				if ping.Error == nil || fetch.Error == nil {
+					t.Fatalf("ping error %v, fetch error %v, want both to fail without an IPv%s address", ping.Error, fetch.Error, tt.family)
+				}
+				if pinged != "" {
+					t.Errorf("pinged %s outside -family %s", pinged, tt.family)
+				}
+				return
+			}
+
+			if ping.Error != nil || ping.IPVersion != tt.version || ping.IP != wantIP || pinged != wantIP {
+				t.Errorf("ping went to %s (IPv%d, pinger got %q, error %v), want %s", ping.IP, ping.IPVersion, pinged, ping.Error, wantIP)
+			}
+			if fetch.Error != nil {
+				t.Fatal(fetch.Error)
+			}
+			if got := <-addrs; ipVersion(got) != tt.version {
+				t.Errorf("server got the fetch on %s, want IPv%d", got, tt.version)
+			}
+			if fetch.IPVersion != tt.version {
+				t.Errorf("fetch recorded IPv%d, want IPv%d", fetch.IPVersion, tt.version)
+			}
+			column, _ := findFetchColumn("family")
+			if cell, _ := column.cell(fetch); cell != formatIPVersion(tt.version) {
+				t.Errorf("family column shows %q, want %q", cell, formatIPVersion(tt.version))
+			}
+		})
+	}
+}
+
+func TestFamilyFlag(t *testing.T) {
+	for _, tt := range []struct {
+		family  string
+		wantErr bool
+	}{
+		{"auto", false}, {"4", false}, {"6", false}, {"ipv4", true}, {"46", true}, {"", true},
+	} {
+		setFlag(t, family, tt.family)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-family %q: error = %v, want error %v", tt.family, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// healthScore condenses a run into one 0–100 number:
+//
+//	score = 100 × (w × reachable/pinged + (1 − w) × healthy/fetched)
+//
+// where w is -health-ping-weight, reachable counts pings that got at least
+// one reply, and healthy counts fetches that returned 2xx (or completed a
+// WebSocket handshake) without an error or SLA breach. Skipped pings are
+// left out of pinged. When a run has no pings (or no fetches) the other
+// half carries the whole score. ok is false when there is nothing to score.
+func healthScore(run RunResult, pingWeight float64) (score float64, ok bool) {
+	var pinged, reachable int
+	for _, result := range run.Pings {
+		if result.Skipped != "" {
+			continue
+		}
+		pinged++
+		if result.Error == nil && result.PacketsRecv > 0 {
+			reachable++
+		}
+	}
+	var healthy int
+	for _, result := range run.Fetches {
+		if result.Error == nil && statusOK(result) && !result.SLABreach {
+			healthy++
+		}
+	}
+	fetched := len(run.Fetches)
+
+	switch {
+	case pinged == 0 && fetched == 0:
+		return 0, false
+	case pinged == 0:
+		pingWeight = 0
+	case fetched == 0:
+		pingWeight = 1
+	}
+	var pingPart, fetchPart float64
+	if pinged > 0 {
+		pingPart = float64(reachable) / float64(pinged)
+	}
+	if fetched > 0 {
+		fetchPart = float64(healthy) / float64(fetched)
+	}
+	return 100 * (pingWeight*pingPart + (1-pingWeight)*fetchPart), true
+}
+
+// healthStyle colours a score: green from 90, yellow from 70, red below
+func healthStyle(score float64) lipgloss.Style {
+	switch {
+	case score >= 90:
+		return successStyle
+	case score >= 70:
+		return warningStyle
+	default:
+		return errorStyle
+	}
+}
+
+// renderHealth prints the run's health score as a banner for -health
+func renderHealth(w io.Writer, run RunResult) {
+	score, ok := healthScore(run, *healthPingWeight)
+	if !ok {
+		return
+	}
+	banner := healthStyle(score).Bold(true).Render(fmt.Sprintf(" Health %.0f/100 ", score))
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(banner))
+	fmt.Fprintln(w)
+}
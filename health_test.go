@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHealthScore(t *testing.T) {
+	up := PingResult{PacketsSent: 3, PacketsRecv: 3}
+	lossy := PingResult{PacketsSent: 3, PacketsRecv: 1}
+	down := PingResult{PacketsSent: 3}
+	failed := PingResult{Error: errors.New("no route")}
+	skipped := PingResult{Skipped: "unix socket"}
+	ok := FetchResult{StatusCode: 200}
+	created := FetchResult{StatusCode: 201}
+	notFound := FetchResult{StatusCode: 404}
+	redirect := FetchResult{StatusCode: 301}
+	slow := FetchResult{StatusCode: 200, SLABreach: true}
+	broken := FetchResult{StatusCode: 200, Error: errors.New("body regex missed")}
+
+	tests := []struct {
+		name    string
+		pings   []PingResult
+		fetches []FetchResult
+		weight  float64
+		want    float64
+		wantOK  bool
+	}{
+		{"all healthy", []PingResult{up, lossy}, []FetchResult{ok, created}, 0.3, 100, true},
+		{"all down", []PingResult{down, failed}, []FetchResult{notFound, broken}, 0.3, 0, true},
+		{"half and half", []PingResult{up, down}, []FetchResult{ok, notFound}, 0.3, 50, true},
+		{"pings only count for w", []PingResult{up}, []FetchResult{notFound}, 0.3, 30, true},
+		{"fetches get the rest", []PingResult{down}, []FetchResult{ok}, 0.3, 70, true},
+		{"weight 1 ignores fetches", []PingResult{up}, []FetchResult{notFound}, 1, 100, true},
+		{"weight 0 ignores pings", []PingResult{down}, []FetchResult{ok, ok, slow, redirect}, 0, 50, true},
+		{"no pings", nil, []FetchResult{ok, notFound}, 0.3, 50, true},
+		{"only skipped pings", []PingResult{skipped, skipped}, []FetchResult{ok}, 0.3, 100, true},
+		{"skipped left out", []PingResult{up, skipped}, []FetchResult{ok}, 0.5, 100, true},
+		{"no fetches", []PingResult{up, down, down, down}, nil, 0.3, 25, true},
+		{"nothing to score", nil, nil, 0.3, 0, false},
+		{"skipped and nothing else", []PingResult{skipped}, nil, 0.3, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := healthScore(RunResult{Pings: tt.pings, Fetches: tt.fetches}, tt.weight)
+			if ok != tt.wantOK || math.Abs(score-tt.want) > 1e-9 {
+				t.Errorf("score = %v, %v, want %v, %v", score, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHealthStyle(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{100, "green"}, {90, "green"}, {89.9, "yellow"}, {70, "yellow"}, {69.9, "red"}, {0, "red"},
+	}
+	styles := map[string]any{
+		"green":  successStyle.GetForeground(),
+		"yellow": warningStyle.GetForeground(),
+		"red":    errorStyle.GetForeground(),
+	}
+	for _, tt := range tests {
+		if got := healthStyle(tt.score).GetForeground(); got != styles[tt.want] {
+			t.Errorf("score %v coloured %v, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHealth(t *testing.T) {
+	run := RunResult{
+		Pings:   []PingResult{{URL: "https://a.example/", PacketsSent: 1, PacketsRecv: 1}},
+		Fetches: []FetchResult{{URL: "https://a.example/", StatusCode: 500}},
+	}
+	tests := []struct {
+		name   string
+		health bool
+		run    RunResult
+		want   string
+	}{
+		{"off", false, run, ""},
+		{"on", true, run, "Health 30/100"},
+		{"empty run", true, RunResult{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, health, tt.health)
+			setFlag(t, healthPingWeight, 0.3)
+			var out strings.Builder
+			renderRun(&out, tt.run)
+			index := strings.Index(out.String(), "Health ")
+			if tt.want == "" {
+				if index >= 0 {
+					t.Errorf("unexpected health banner:\n%s", out.String())
+				}
+				return
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Fatalf("output lacks %q:\n%s", tt.want, out.String())
+			}
+			if timing := strings.Index(out.String(), "Timing Information"); index > timing {
+				t.Errorf("health banner comes after the timing table:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestHealthPingWeightFlag(t *testing.T) {
+	for _, tt := range []struct {
+		weight  float64
+		wantErr bool
+	}{
+		{0, false}, {0.3, false}, {1, false}, {-0.1, true}, {1.5, true},
+	} {
+		setFlag(t, healthPingWeight, tt.weight)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-health-ping-weight %v: error = %v, want error %v", tt.weight, err, tt.wantErr)
+		}
+	}
+}
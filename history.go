@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// appendHistory adds run to the JSONL file at path as a single line
+func appendHistory(path string, run RunResult) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadHistory returns the latest run in the JSONL file at path that
+// started no later than at, or the latest run overall when at is zero.
+// Corrupt or partially written lines are skipped with a warning.
+func loadHistory(path string, at time.Time) (RunResult, error) {
+	var latest RunResult
+	file, err := os.Open(path)
+	if err != nil {
+		return latest, err
+	}
+	defer file.Close()
+
+	found := false
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return latest, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var run RunResult
+			if jsonErr := json.Unmarshal(line, &run); jsonErr != nil {
+				fmt.Fprintln(os.Stderr, warningStyle.Render(fmt.Sprintf("Skipping %s line %d: %v", path, lineNum, jsonErr)))
+			} else if (at.IsZero() || !run.StartedAt.After(at)) && (!found || !run.StartedAt.Before(latest.StartedAt)) {
+				latest, found = run, true
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if !found {
+		if at.IsZero() {
+			return latest, fmt.Errorf("%s has no runs", path)
+		}
+		return latest, fmt.Errorf("%s has no run at or before %s", path, at.Format(time.RFC3339))
+	}
+	return latest, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// hookOutputPlaceholder is replaced in header values by the pre_hook's output
+const hookOutputPlaceholder = "${pre_hook_output}"
+
+// maxHookOutput caps how much a pre_hook may print; a token is far smaller
+const maxHookOutput = 64 << 10
+
+// hookError marks a failure of the site's pre_hook rather than of the fetch
+type hookError struct {
+	err error
+}
+
+func (e *hookError) Error() string { return "pre_hook: " + e.err.Error() }
+func (e *hookError) Unwrap() error { return e.err }
+
+// cappedBuffer keeps the first limit bytes written to it and notes whether
+// anything was dropped, so a runaway hook can't exhaust memory
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// runPreHook runs the site's pre_hook through the system shell and returns
+// its trimmed stdout. The command gets no stdin, a minimal environment
+// (see hookEnv) and -hook-timeout to finish; any failure is a *hookError.
+func runPreHook(ctx context.Context, site Website) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, *hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", site.PreHook)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", site.PreHook)
+	}
+	cmd.Env = hookEnv(site)
+	// Stop waiting on pipes held open by children the shell left behind
+	cmd.WaitDelay = time.Second
+	stdout := &cappedBuffer{limit: maxHookOutput}
+	stderr := &cappedBuffer{limit: 4 << 10}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err := cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "", &hookError{fmt.Errorf("timed out after %s", *hookTimeout)}
+	case err != nil:
+		if message := lastLine(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return "", &hookError{err}
+	case stdout.truncated:
+		return "", &hookError{fmt.Errorf("printed more than %d bytes", maxHookOutput)}
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return "", &hookError{errors.New("printed nothing")}
+	}
+	// A line break would let the output smuggle in extra headers
+	if strings.ContainsAny(output, "\r\n") {
+		return "", &hookError{errors.New("printed more than one line")}
+	}
+	return output, nil
+}
+
+// hookEnv is the whole environment a pre_hook sees: enough to find
+// programs, plus the site being checked. Secrets in the monitor's own
+// environment are deliberately not passed on.
+func hookEnv(site Website) []string {
+	env := []string{"SITE_URL=" + site.URL, "SITE_NAME=" + site.Name}
+	for _, name := range []string{"PATH", "HOME", "SystemRoot", "TEMP", "TMPDIR"} {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// lastLine returns the last non-blank line of s, usually a command's error
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// applyHookOutput fills the pre_hook placeholder in every header value
+func applyHookOutput(header http.Header, output string) {
+	for _, values := range header {
+		for i, value := range values {
+			values[i] = strings.ReplaceAll(value, hookOutputPlaceholder, output)
+		}
+	}
+}
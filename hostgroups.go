@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// hostKey names the connection a site's fetch would use: its Unix socket,
+// or the scheme and host:port it is fetched from. Other ports or schemes on
+// the same host can't share a connection, so they key apart.
+func hostKey(site Website) string {
+	if socketPath, _, ok := site.unixSocket(); ok {
+		return "unix:" + socketPath
+	}
+	if u, err := url.Parse(site.URL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	return site.URL
+}
+
+// groupByHost splits the indexes of urls into groups sharing a hostKey,
+// in the order each host first appears
+func groupByHost(urls []Website) [][]int {
+	var groups [][]int
+	index := make(map[string]int)
+	for i, site := range urls {
+		key := hostKey(site)
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// clientCache holds the per-site clients fetchSite derives from the run's
+// client for Unix sockets and -pre-resolve, so sites on the same host
+// share one transport and its keep-alive connections instead of each
+// dialling afresh. A new base client (the next run) starts a new cache.
+type clientCache struct {
+	mu      sync.Mutex
+	base    *http.Client
+	clients map[string]*http.Client
+}
+
+// siteClients is shared by every fetch
+var siteClients clientCache
+
+// get returns the client cached under key for base, calling derive to
+// build it the first time
+func (c *clientCache) get(base *http.Client, key string, derive func() *http.Client) *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.base != base {
+		for _, client := range c.clients {
+			client.CloseIdleConnections()
+		}
+		c.base, c.clients = base, make(map[string]*http.Client)
+	}
+	client, ok := c.clients[key]
+	if !ok {
+		client = derive()
+		c.clients[key] = client
+	}
+	return client
+}
+
+// siteClient returns the client to fetch site with: base itself, or a
+// cached client that dials its Unix socket or -pre-resolve addresses
+// and presents its tls_server_name
+func siteClient(base *http.Client, site Website) *http.Client {
+	var key string
+	derive := func() *http.Client { return base }
+	if socketPath, _, ok := site.unixSocket(); ok {
+		key = hostKey(site)
+		derive = func() *http.Client { return unixClient(base, socketPath) }
+	} else if len(site.IPs) > 0 {
+		host := siteHosts(site)[0]
+		key = host + "=" + strings.Join(site.IPs, ",")
+		derive = func() *http.Client { return resolvedClient(base, host, site.IPs) }
+	}
+	if name := site.TLSServerName; name != "" {
+		key += " sni=" + name
+		dial := derive
+		derive = func() *http.Client { return serverNameClient(dial(), name) }
+	}
+	if key == "" {
+		return base
+	}
+	return siteClients.get(base, key, derive)
+}
+
+// siteTransport returns a copy of client's transport for a per-site
+// client, with tcp applied to its TCP side. Under -http3, h3 is applied to
+// the QUIC side as well, and a nil h3 means the site can't use QUIC, so its
+// client gets the TCP side alone.
+func siteTransport(client *http.Client, tcp func(*http.Transport), h3 func(*http3.Transport)) http.RoundTripper {
+	switch t := client.Transport.(type) {
+	case *http3Transport:
+		if h3 == nil {
+			fallback := t.fallback.Clone()
+			tcp(fallback)
+			return fallback
+		}
+		cloned := t.clone()
+		tcp(cloned.fallback)
+		h3(cloned.h3)
+		return cloned
+	case *http.Transport:
+		cloned := t.Clone()
+		tcp(cloned)
+		return cloned
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tcp(transport)
+	return transport
+}
+
+// withServerName returns a copy of config that sends name as the SNI and
+// verifies the certificate against it
+func withServerName(config *tls.Config, name string) *tls.Config {
+	named := &tls.Config{}
+	if config != nil {
+		named = config.Clone()
+	}
+	named.ServerName = name
+	return named
+}
+
+// serverNameClient returns a copy of client whose TLS handshakes send
+// name as the SNI and verify the certificate against it, whatever host
+// the URL names
+func serverNameClient(client *http.Client, name string) *http.Client {
+	named := *client
+	named.Transport = siteTransport(client, func(t *http.Transport) {
+		t.TLSClientConfig = withServerName(t.TLSClientConfig, name)
+	}, func(t *http3.Transport) {
+		t.TLSClientConfig = withServerName(t.TLSClientConfig, name)
+	})
+	return &named
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Per-site clients must keep everything the run's client was built with,
+// HTTP/3 and the pool limits included
+func TestSiteClientKeepsTransportSettings(t *testing.T) {
+	setFlag(t, maxConnsPerHost, 4)
+	tests := []struct {
+		name string
+		site Website
+		// quic is whether the site's client should still try HTTP/3
+		quic       bool
+		serverName string
+		resolved   bool
+	}{
+		{"tls_server_name", Website{URL: "https://a.example/", TLSServerName: "b.example"}, true, "b.example", false},
+		{"pre-resolved", Website{URL: "https://a.example/", IPs: []string{"192.0.2.1"}}, true, "", true},
+		{"pre-resolved with tls_server_name", Website{URL: "https://a.example/", IPs: []string{"192.0.2.1"}, TLSServerName: "b.example"}, true, "b.example", true},
+		{"unix socket", Website{URL: "unix:///run/app.sock:/health"}, false, "", false},
+	}
+	for _, h3 := range []bool{false, true} {
+		setFlag(t, useHTTP3, h3)
+		base := newFetchClient()
+		for _, tt := range tests {
+			client := siteClient(base, tt.site)
+			if client == base {
+				t.Fatalf("%s: got the base client back", tt.name)
+			}
+			var tcp *http.Transport
+			switch transport := client.Transport.(type) {
+			case *http3Transport:
+				if !h3 || !tt.quic {
+					t.Fatalf("%s -http3=%v: unexpected HTTP/3 transport", tt.name, h3)
+				}
+				tcp = transport.fallback
+				if tt.serverName != "" && (transport.h3.TLSClientConfig == nil || transport.h3.TLSClientConfig.ServerName != tt.serverName) {
+					t.Errorf("%s: QUIC side doesn't send the SNI %q", tt.name, tt.serverName)
+				}
+				if tt.resolved != (transport.h3.Dial != nil) {
+					t.Errorf("%s: QUIC side dials the resolved addresses = %v, want %v", tt.name, transport.h3.Dial != nil, tt.resolved)
+				}
+			case *http.Transport:
+				if h3 && tt.quic {
+					t.Fatalf("%s: -http3 was lost, transport is %T", tt.name, client.Transport)
+				}
+				tcp = transport
+			default:
+				t.Fatalf("%s: transport is %T", tt.name, client.Transport)
+			}
+			if tcp.MaxConnsPerHost != 4 {
+				t.Errorf("%s -http3=%v: MaxConnsPerHost = %d, want 4", tt.name, h3, tcp.MaxConnsPerHost)
+			}
+			if tt.serverName != "" && tcp.TLSClientConfig.ServerName != tt.serverName {
+				t.Errorf("%s -http3=%v: TCP side sends SNI %q, want %q", tt.name, h3, tcp.TLSClientConfig.ServerName, tt.serverName)
+			}
+		}
+		base.CloseIdleConnections()
+	}
+}
+
+func TestGroupByHost(t *testing.T) {
+	tests := []struct {
+		name string
+		urls []string
+		want [][]int
+	}{
+		{"one host", []string{"https://a.example/x", "https://a.example/y"}, [][]int{{0, 1}}},
+		{"first appearance order", []string{"https://b.example/", "https://a.example/", "https://b.example/z"}, [][]int{{0, 2}, {1}}},
+		{"host case", []string{"https://A.example/", "https://a.EXAMPLE/"}, [][]int{{0, 1}}},
+		{"ports apart", []string{"http://127.0.0.1:8080/", "http://127.0.0.1:8081/", "http://127.0.0.1:8080/b"}, [][]int{{0, 2}, {1}}},
+		{"schemes apart", []string{"http://a.example/", "https://a.example/"}, [][]int{{0}, {1}}},
+		{"unix socket", []string{"unix:///run/app.sock:/a", "unix:///run/app.sock:/b", "unix:///run/other.sock:/a"}, [][]int{{0, 1}, {2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sites := make([]Website, len(tt.urls))
+			for i, u := range tt.urls {
+				sites[i] = Website{URL: u}
+			}
+			if got := groupByHost(sites); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupByHost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// connServer counts the connections opened to it and the most requests it
+// has had in flight at once
+type connServer struct {
+	*httptest.Server
+	conns          atomic.Int32
+	inFlight, peak atomic.Int32
+}
+
+func newConnServer(t *testing.T) *connServer {
+	s := &connServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for peak := s.peak.Load(); n > peak && !s.peak.CompareAndSwap(peak, n); peak = s.peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, r.URL.Path)
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.conns.Add(1)
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestHostGroupsReuseConnection(t *testing.T) {
+	setFlag(t, hostGroups, true)
+	servers := []*connServer{newConnServer(t), newConnServer(t)}
+	var sites []Website
+	for i := range 5 {
+		for _, server := range servers {
+			sites = append(sites, Website{URL: fmt.Sprintf("%s/endpoint/%d", server.URL, i)})
+		}
+	}
+
+	results, _ := fetchAll(context.Background(), sites, newFetchClient(), newLimiter(0), &abortCounter{})
+	if len(results) != len(sites) {
+		t.Fatalf("got %d results for %d sites", len(results), len(sites))
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("%s: %v", result.URL, result.Error)
+		}
+		if path := result.URL[strings.Index(result.URL, "/endpoint"):]; result.BodyLength != len(path) {
+			t.Errorf("%s got a %d-byte body, not its own", result.URL, result.BodyLength)
+		}
+	}
+	for i, server := range servers {
+		if got := server.conns.Load(); got != 1 {
+			t.Errorf("server %d: %d connections for 5 endpoints, want 1", i, got)
+		}
+		if got := server.peak.Load(); got != 1 {
+			t.Errorf("server %d: %d requests at once, want them one after another", i, got)
+		}
+	}
+}
+
+func TestFetchTLSServerName(t *testing.T) {
+	snis := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		snis <- hello.ServerName
+		return nil, nil
+	}}
+	// Handshakes the client rejects are part of the test
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// The test certificate covers example.com and 127.0.0.1, and the
+	// client trusts it
+	client := newFetchClient()
+	client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+
+	tests := []struct {
+		name    string
+		site    Website
+		sni     string
+		wantErr bool
+	}{
+		{"by IP", Website{URL: server.URL}, "", false},
+		{"by IP presenting a name", Website{URL: server.URL, TLSServerName: "example.com"}, "example.com", false},
+		{"name the certificate lacks", Website{URL: server.URL, TLSServerName: "shop.example"}, "shop.example", true},
+		{"pre-resolved", Website{URL: "https://example.com:" + port + "/", IPs: []string{"127.0.0.1"}}, "example.com", false},
+		{"pre-resolved under another name", Website{URL: "https://unlisted.example:" + port + "/", IPs: []string{"127.0.0.1"}, TLSServerName: "example.com"}, "example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.site.Retry = &RetryPolicy{Attempts: 1}
+			result := fetchData(context.Background(), client, tt.site, newLimiter(0))
+			select {
+			case sni := <-snis:
+				if sni != tt.sni {
+					t.Errorf("server got SNI %q, want %q", sni, tt.sni)
+				}
+			default:
+				t.Errorf("no handshake reached the server (error %v)", result.Error)
+			}
+			var hostname x509.HostnameError
+			if tt.wantErr != errors.As(result.Error, &hostname) {
+				t.Errorf("error = %v, want a certificate name mismatch %v", result.Error, tt.wantErr)
+			}
+			if !tt.wantErr && result.StatusCode != http.StatusOK {
+				t.Errorf("status %d, error %v", result.StatusCode, result.Error)
+			}
+		})
+	}
+
+	t.Run("wss", func(t *testing.T) {
+		site := Website{URL: "wss://127.0.0.1:" + port + "/", TLSServerName: "example.com"}
+		fetchData(context.Background(), client, site, newLimiter(0))
+		select {
+		case sni := <-snis:
+			if sni != "example.com" {
+				t.Errorf("handshake sent SNI %q, want example.com", sni)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("no handshake reached the server")
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// hostSemaphores caps how many fetches may be in flight to each host, with
+// one semaphore per hostname created on first use
+type hostSemaphores struct {
+	mu    sync.Mutex
+	limit int
+	sems  map[string]chan struct{}
+}
+
+func newHostSemaphores(limit int) *hostSemaphores {
+	return &hostSemaphores{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// acquire waits for a free slot on host and returns the function that
+// frees it again, or ctx's error if it is cancelled first
+func (h *hostSemaphores) acquire(ctx context.Context, host string) (func(), error) {
+	h.mu.Lock()
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// hostSlots is shared by every fetch; nil when -per-host-concurrency is 0
+var hostSlots *hostSemaphores
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// peakServer records the most requests it was serving at once, per Host
+// header hostname and overall
+type peakServer struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	peak     map[string]int
+	total    int
+	peakAll  int
+}
+
+func (s *peakServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, _ := net.SplitHostPort(r.Host)
+	s.mu.Lock()
+	s.inFlight[host]++
+	s.total++
+	s.peak[host] = max(s.peak[host], s.inFlight[host])
+	s.peakAll = max(s.peakAll, s.total)
+	s.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight[host]--
+	s.total--
+	s.mu.Unlock()
+}
+
+func TestPerHostConcurrency(t *testing.T) {
+	tests := []struct {
+		limit   int
+		perHost int
+		overall int
+	}{
+		{0, 4, 8},
+		{1, 1, 2},
+		{2, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.limit), func(t *testing.T) {
+			peaks := &peakServer{inFlight: make(map[string]int), peak: make(map[string]int)}
+			server := httptest.NewServer(peaks)
+			t.Cleanup(server.Close)
+			_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+			var slots *hostSemaphores
+			if tt.limit > 0 {
+				slots = newHostSemaphores(tt.limit)
+			}
+			setFlag(t, &hostSlots, slots)
+
+			// Four URLs on each of two names for the one server
+			var sites []Website
+			for i := range 4 {
+				for _, host := range []string{"127.0.0.1", "localhost"} {
+					sites = append(sites, Website{Name: fmt.Sprint(host, i), URL: fmt.Sprintf("http://%s:%s/%d", host, port, i)})
+				}
+			}
+			results, _ := fetchAll(context.Background(), sites, newFetchClient(), newLimiter(0), &abortCounter{})
+			for _, result := range results {
+				if result.Error != nil {
+					t.Fatalf("%s: %v", result.URL, result.Error)
+				}
+			}
+
+			for _, host := range []string{"127.0.0.1", "localhost"} {
+				if got := peaks.peak[host]; got != tt.perHost {
+					t.Errorf("%s had %d fetches in flight at once, want %d", host, got, tt.perHost)
+				}
+			}
+			if peaks.peakAll != tt.overall {
+				t.Errorf("%d fetches in flight at once overall, want %d", peaks.peakAll, tt.overall)
+			}
+		})
+	}
+}
+
+func TestHostSemaphoresAcquire(t *testing.T) {
+	slots := newHostSemaphores(1)
+	release, err := slots.acquire(context.Background(), "a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another host has slots of its own
+	releaseB, err := slots.acquire(context.Background(), "b.example")
+	if err != nil {
+		t.Fatalf("b.example waited on a.example: %v", err)
+	}
+	releaseB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := slots.acquire(ctx, "a.example"); err != context.DeadlineExceeded {
+		t.Errorf("second acquire on a full host = %v, want it to wait out the context", err)
+	}
+
+	release()
+	if release, err := slots.acquire(context.Background(), "a.example"); err != nil {
+		t.Errorf("acquire after release = %v", err)
+	} else {
+		release()
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3HandshakeTimeout bounds how long an HTTP/3 attempt may take to
+// connect before fetches fall back to TCP
+const http3HandshakeTimeout = 3 * time.Second
+
+// noQUICFor is how long a host that failed over HTTP/3 goes straight to
+// the fallback before QUIC is tried again
+const noQUICFor = 10 * time.Minute
+
+// noQUIC maps each host:port whose HTTP/3 attempt failed to when it may be
+// tried again. It outlives each run's transport, so under -watch a host
+// without QUIC costs the handshake timeout once rather than every cycle.
+var noQUIC sync.Map
+
+// http3Transport tries HTTPS requests over HTTP/3 and falls back to the
+// regular HTTP/2 or HTTP/1.1 transport when the server doesn't answer over
+// QUIC. A request that failed after it was sent over QUIC is only resent
+// if its method is idempotent, so a POST is never sent twice. Plain http://
+// requests always use the fallback.
+type http3Transport struct {
+	h3       *http3.Transport
+	fallback *http.Transport
+}
+
+// newHTTP3Transport returns the transport used for -http3
+func newHTTP3Transport() *http3Transport {
+	return &http3Transport{
+		h3: &http3.Transport{
+			QUICConfig: &quic.Config{HandshakeIdleTimeout: http3HandshakeTimeout},
+		},
+		fallback: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+}
+
+// clone returns a copy of t with pools of its own, keeping the QUIC dial
+// and TLS settings, for the per-site clients of siteClient
+func (t *http3Transport) clone() *http3Transport {
+	h3 := &http3.Transport{QUICConfig: t.h3.QUICConfig, Dial: t.h3.Dial}
+	if t.h3.TLSClientConfig != nil {
+		h3.TLSClientConfig = t.h3.TLSClientConfig.Clone()
+	}
+	return &http3Transport{h3: h3, fallback: t.fallback.Clone()}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.fallback.RoundTrip(req)
+	}
+	host := req.URL.Host
+	if retryAt, ok := noQUIC.Load(host); ok && time.Now().Before(retryAt.(time.Time)) {
+		return t.fallback.RoundTrip(req)
+	}
+	// Once the request has gone out the server may already have acted on
+	// it, so after that only a request that is safe to repeat is resent
+	var sent atomic.Bool
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteHeaders: func() { sent.Store(true) },
+	})
+	resp, err := t.h3.RoundTrip(req.WithContext(ctx))
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+	if sent.Load() && !idempotent(req.Method) {
+		return nil, err
+	}
+	noQUIC.Store(host, time.Now().Add(noQUICFor))
+
+	// The QUIC attempt may have read some of the body, so send a fresh copy
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	// The result's Proto shows the fallback, which fetchNotes warns about
+	return t.fallback.RoundTrip(req)
+}
+
+// idempotent reports whether repeating a request with method has the same
+// effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// CloseIdleConnections closes the QUIC connections and the fallback's idle
+// ones, so a run's transport doesn't keep its pools once the run is over
+func (t *http3Transport) CloseIdleConnections() {
+	t.h3.Close()
+	t.fallback.CloseIdleConnections()
+}
+
+// resolvedQUICDial returns an http3.Transport Dial function that connects
+// to host through ips instead of looking it up again, as resolvedClient
+// does over TCP
+func resolvedQUICDial(host string, ips []string) func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		addrHost, port, err := net.SplitHostPort(addr)
+		if err != nil || addrHost != host {
+			return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+		}
+		for _, ip := range ips {
+			var conn *quic.Conn
+			conn, err = quic.DialAddrEarly(ctx, net.JoinHostPort(ip, port), tlsCfg, cfg)
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// missedHTTP3 reports whether -http3 was asked for but the fetch of an
+// https:// URL ended up on another protocol
+func missedHTTP3(result FetchResult) bool {
+	return *useHTTP3 && strings.HasPrefix(result.URL, "https://") && result.Proto != "HTTP/3.0"
+}
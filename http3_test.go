@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3FallsBackOnceAndResendsBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+	noQUIC.Clear()
+	t.Cleanup(noQUIC.Clear)
+
+	transport := newHTTP3Transport()
+	transport.h3.QUICConfig = &quic.Config{HandshakeIdleTimeout: 200 * time.Millisecond}
+	transport.fallback.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	post := func() (time.Duration, *http.Response) {
+		t.Helper()
+		start := time.Now()
+		resp, err := client.Post(server.URL, "text/plain", bytes.NewReader([]byte("payload")))
+		if err != nil {
+			t.Fatalf("fetch failed instead of falling back: %v", err)
+		}
+		resp.Body.Close()
+		return time.Since(start), resp
+	}
+
+	first, resp := post()
+	if resp.ProtoMajor == 3 {
+		t.Fatalf("a TCP-only server answered over %s", resp.Proto)
+	}
+	if first < 200*time.Millisecond {
+		t.Errorf("first fetch took %v, want it to wait out the QUIC handshake", first)
+	}
+	second, _ := post()
+	if second >= 200*time.Millisecond {
+		t.Errorf("second fetch took %v, want the host remembered as having no QUIC", second)
+	}
+	for i, body := range bodies {
+		if body != "payload" {
+			t.Errorf("request %d arrived with body %q, want %q", i+1, body, "payload")
+		}
+	}
+}
+
+func TestHTTP3TransportClosesIdleConnections(t *testing.T) {
+	// http.Client.CloseIdleConnections only reaches transports with the method
+	var transport http.RoundTripper = newHTTP3Transport()
+	closer, ok := transport.(interface{ CloseIdleConnections() })
+	if !ok {
+		t.Fatal("http3Transport has no CloseIdleConnections")
+	}
+	closer.CloseIdleConnections()
+}
+
+func TestHTTP3NoResendOnceSent(t *testing.T) {
+	var tcpRequests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tcpRequests.Add(1)
+	}))
+	defer server.Close()
+	noQUIC.Clear()
+	t.Cleanup(noQUIC.Clear)
+
+	// An HTTP/3 server on the same port that accepts the connection, then
+	// resets every request's stream, as if it failed partway through
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	conn, err := net.ListenPacket("udp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Skipf("no UDP port to pair with the TCP server: %v", err)
+	}
+	h3Server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(server.TLS.Clone()),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}),
+	}
+	go h3Server.Serve(conn)
+	defer h3Server.Close()
+
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	tests := []struct {
+		method  string
+		resends bool
+	}{
+		{http.MethodGet, true},
+		{http.MethodPut, true},
+		{http.MethodPost, false},
+		{http.MethodPatch, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			noQUIC.Clear()
+			tcpRequests.Store(0)
+			transport := newHTTP3Transport()
+			transport.h3.TLSClientConfig = tlsConfig.Clone()
+			transport.fallback.TLSClientConfig = tlsConfig
+			defer transport.CloseIdleConnections()
+
+			req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader("payload"))
+			resp, err := transport.RoundTrip(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if got := tcpRequests.Load() == 1; got != tt.resends {
+				t.Errorf("resent over TCP = %v (error %v), want %v", got, err, tt.resends)
+			}
+			if !tt.resends && err == nil {
+				t.Error("want the HTTP/3 error returned instead of a resend")
+			}
+		})
+	}
+}
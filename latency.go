@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http/httptrace"
+	"time"
+)
+
+// minServerLatency is the shortest wait for the first byte that is ever
+// called high server latency, so quick fetches of tiny bodies, which spend
+// nearly all their time waiting, aren't flagged
+const minServerLatency = 100 * time.Millisecond
+
+// withFirstByte records in *at when the first byte of each response to a
+// request made with the returned context arrives, so after a redirect
+// chain it holds the final hop's
+func withFirstByte(ctx context.Context, at *time.Time) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			*at = time.Now()
+		},
+	})
+}
+
+// highServerLatency reports whether the final request spent more than
+// -ttfb-ratio of its time waiting for the first byte. A slow first byte
+// followed by a quick download points at the server's think time rather
+// than the network. The wait can never exceed the request, so a ratio of 1
+// turns the note off.
+func highServerLatency(result FetchResult) bool {
+	if result.Error != nil || result.TTFB < minServerLatency {
+		return false
+	}
+	return result.TTFB.Seconds() > *ttfbRatio*result.FinalTime.Seconds()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHighServerLatency(t *testing.T) {
+	mux := http.NewServeMux()
+	// /think waits before its first byte, then sends the body at once
+	mux.HandleFunc("/think", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	// /trickle waits less before its first byte than it then takes over the
+	// rest, so under half its time is spent waiting
+	mux.HandleFunc("/trickle", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("start"))
+		w.(http.Flusher).Flush()
+		time.Sleep(250 * time.Millisecond)
+		w.Write([]byte("end"))
+	})
+	mux.HandleFunc("/quick", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path  string
+		ratio float64
+		want  bool
+	}{
+		{"/think", 0.8, true},
+		{"/think", 1, false},
+		{"/trickle", 0.3, true},
+		{"/trickle", 0.8, false},
+		{"/quick", 0.01, false}, // under the minServerLatency floor
+	}
+	for _, tt := range tests {
+		setFlag(t, ttfbRatio, tt.ratio)
+		result := fetchTest(t, server, Website{URL: tt.path})
+		if result.Error != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.path, result.Error)
+		}
+		got := slices.Contains(fetchNotes(result), "high server latency")
+		if got != tt.want {
+			t.Errorf("%s with -ttfb-ratio %v (ttfb %v of %v): note = %v, want %v", tt.path, tt.ratio, result.TTFB, result.FinalTime, got, tt.want)
+		}
+	}
+}
+
+func TestTTFBRatioFlag(t *testing.T) {
+	for _, tt := range []struct {
+		ratio   float64
+		wantErr bool
+	}{
+		{0.5, false}, {1, false}, {0, true}, {-0.2, true}, {1.5, true},
+	} {
+		setFlag(t, ttfbRatio, tt.ratio)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-ttfb-ratio %v: error = %v, want error %v", tt.ratio, err, tt.wantErr)
+		}
+	}
+}
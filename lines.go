@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// lineResult pairs the ping and fetch results for one URL
+type lineResult struct {
+	url   string
+	name  string
+	ping  *PingResult
+	fetch *FetchResult
+}
+
+// mergeByURL pairs up ping and fetch results, keeping the order of the
+// fetch results followed by any URLs that were only pinged
+func mergeByURL(run RunResult) []lineResult {
+	var merged []lineResult
+	index := make(map[string]int)
+	for i := range run.Fetches {
+		result := &run.Fetches[i]
+		index[result.URL] = len(merged)
+		merged = append(merged, lineResult{url: result.URL, name: result.Name, fetch: result})
+	}
+	for i := range run.Pings {
+		result := &run.Pings[i]
+		if j, ok := index[result.URL]; ok {
+			merged[j].ping = result
+			continue
+		}
+		index[result.URL] = len(merged)
+		merged = append(merged, lineResult{url: result.URL, name: result.Name, ping: result})
+	}
+	return merged
+}
+
+// renderLines prints one dense line per URL combining its ping and fetch,
+// e.g. "example.com  42.00 ms  0%loss  200  1.20MB"
+func renderLines(w io.Writer, run RunResult) {
+	merged := mergeByURL(run)
+
+	hostWidth := 0
+	hosts := make([]string, len(merged))
+	for i, line := range merged {
+		hosts[i] = lineLabel(line)
+		hostWidth = max(hostWidth, runewidth.StringWidth(hosts[i]))
+	}
+
+	for i, line := range merged {
+		fields := []string{runewidth.FillRight(hosts[i], hostWidth)}
+		fields = append(fields, linePing(line.ping)...)
+		fields = append(fields, lineFetch(line.fetch)...)
+		fmt.Fprintln(w, strings.Join(fields, "  "))
+	}
+	for _, site := range run.Disabled {
+		label := lineLabel(lineResult{url: site.URL, name: site.Name})
+		fmt.Fprintln(w, lipgloss.NewStyle().Faint(true).Render(label+"  disabled"))
+	}
+	for _, violation := range run.HTTPSViolations {
+		fmt.Fprintln(w, strings.Join([]string{lineHost(violation.URL), errorStyle.Render("plaintext-http")}, "  "))
+	}
+	for _, failure := range run.DNSFailures {
+		fmt.Fprintln(w, strings.Join([]string{lineHost(failure.URL), errorStyle.Render("dns-error"), failure.Error}, "  "))
+	}
+}
+
+// lineLabel identifies a line by its host, name or both under -show
+func lineLabel(line lineResult) string {
+	host := lineHost(line.url)
+	switch {
+	case line.name == "" || *show == "url":
+		return host
+	case *show == "both":
+		return line.name + " (" + host + ")"
+	}
+	return line.name
+}
+
+// lineHost shortens a URL to its host and path for the line output
+func lineHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host + strings.TrimSuffix(u.Path, "/")
+	}
+	return rawURL
+}
+
+func linePing(result *PingResult) []string {
+	switch {
+	case result == nil:
+		return []string{"-", "-"}
+	case result.Error != nil:
+		return []string{errorStyle.Render("ping-error"), "-"}
+	case result.Skipped != "":
+		return []string{infoStyle.Render("skipped"), "-"}
+	}
+
+	lossStyle := successStyle
+	if result.PacketLoss > *lossCrit {
+		lossStyle = errorStyle
+	} else if result.PacketLoss > *lossWarn {
+		lossStyle = warningStyle
+	}
+	rtt := formatDuration(result.AvgRtt)
+	if result.RTTBreach {
+		rtt = errorStyle.Render(rtt)
+	}
+	return []string{
+		rtt,
+		lossStyle.Render(fmt.Sprintf("%.0f%%loss", result.PacketLoss)),
+	}
+}
+
+func lineFetch(result *FetchResult) []string {
+	switch {
+	case result == nil:
+		return []string{"-", "-"}
+	case result.Error != nil:
+		return []string{result.ErrorKind.style().Render(string(result.ErrorKind)), "-", result.Error.Error()}
+	}
+
+	statusText, statusStyle := fetchStatusCell(*result)
+	fields := []string{statusStyle.UnsetPadding().Render(statusText), formatSize(result.BodySize) + "MB"}
+	if result.RequestSize > 0 {
+		fields = append(fields, fmt.Sprintf("sent %dB", result.RequestSize))
+	}
+	if result.CheckOK != nil {
+		text, style := checkCell(*result)
+		fields = append(fields, style.UnsetPadding().Render(text))
+	}
+	if len(result.Samples) > 0 {
+		fields = append(fields, repeatCell(*result))
+	}
+	if result.SLABreach {
+		fields = append(fields, errorStyle.Render("SLA breach"))
+	}
+	if result.FinalHostMismatch != "" {
+		fields = append(fields, errorStyle.Render("ended on "+result.FinalHostMismatch))
+	}
+	if lengthMismatch(*result) {
+		fields = append(fields, warningStyle.Render(fmt.Sprintf("body %d of %d B", result.BodyLength, result.ContentLength)))
+	}
+	return fields
+}
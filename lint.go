@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// lintIssue is one problem -lint found in the config file, on line (0
+// when the line isn't known)
+type lintIssue struct {
+	line    int
+	message string
+}
+
+// configEntry is one site of the config file and the line it starts on
+type configEntry struct {
+	line int
+	site Website
+}
+
+// runLint checks the config file at path and prints each issue as
+// path:line: message. It reports whether the file was free of issues.
+func runLint(w io.Writer, path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	issues := lintConfig(data, configFormat() == "txt")
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s:%d: %s\n", path, issue.line, issue.message)
+	}
+	if len(issues) > 0 {
+		fmt.Fprintln(w, errorStyle.Render(fmt.Sprintf("%d issue(s) in %s", len(issues), path)))
+		return false, nil
+	}
+	fmt.Fprintln(w, successStyle.Render("No issues in "+path))
+	return true, nil
+}
+
+// lintConfig finds the issues in a config file, ordered by line: fields
+// that don't load, unknown fields, bad or unsupported URLs, hosts that
+// look unreachable, and URLs that repeat or overlap an earlier site's
+func lintConfig(data []byte, txt bool) []lintIssue {
+	var entries []configEntry
+	var issues []lintIssue
+	if txt {
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, configEntry{line: i + 1, site: Website{URL: line}})
+			}
+		}
+	} else {
+		entries, issues = parseConfigEntries(data)
+	}
+
+	for _, entry := range entries {
+		for _, message := range lintSite(entry.site) {
+			issues = append(issues, lintIssue{entry.line, message})
+		}
+	}
+	issues = append(issues, lintDuplicates(entries)...)
+	slices.SortStableFunc(issues, func(a, b lintIssue) int { return a.line - b.line })
+	return issues
+}
+
+// parseConfigEntries decodes each site of a YAML config separately, so one
+// bad site doesn't hide the issues of the rest
+func parseConfigEntries(data []byte) ([]configEntry, []lintIssue) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, []lintIssue{yamlIssue(err, 0)}
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return nil, []lintIssue{{1, "no websites"}}
+	}
+
+	var entries []configEntry
+	var issues []lintIssue
+	topLevel := yamlKeyOrder(reflect.TypeOf(WebsitesFile{}))
+	for _, value := range mappingValues(file.Docs[0].Body) {
+		key := value.Key.String()
+		if _, ok := topLevel[key]; !ok {
+			issues = append(issues, lintIssue{value.Key.GetToken().Position.Line, fmt.Sprintf("unknown key %q", key)})
+			continue
+		}
+		if key != "websites" {
+			continue
+		}
+		sites, ok := value.Value.(*ast.SequenceNode)
+		if !ok {
+			issues = append(issues, lintIssue{value.Key.GetToken().Position.Line, "websites must be a list"})
+			continue
+		}
+		for _, node := range sites.Values {
+			entry := configEntry{line: node.GetToken().Position.Line}
+			// A strict decode catches misspelt fields; a lenient one still
+			// lets the site's URL be checked
+			if err := yaml.NodeToValue(node, &entry.site, yaml.Strict()); err != nil {
+				issues = append(issues, yamlIssue(err, entry.line))
+				entry.site = Website{}
+				if yaml.NodeToValue(node, &entry.site) != nil {
+					continue
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, issues
+}
+
+// yamlIssue turns a YAML error into an issue on the line it points at or,
+// for errors that point nowhere (such as a bad duration), on line
+func yamlIssue(err error, line int) lintIssue {
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		return lintIssue{yamlErr.GetToken().Position.Line, yamlErr.GetMessage()}
+	}
+	return lintIssue{line, err.Error()}
+}
+
+// mappingValues returns the key/value pairs of a YAML mapping node, or
+// nothing for other nodes
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+// lintSite returns the problems of one site that don't depend on the others
+func lintSite(site Website) []string {
+	var problems []string
+	if err := site.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if site.URL == "" {
+		return append(problems, "missing url")
+	}
+	if _, _, ok := site.unixSocket(); ok {
+		return problems
+	}
+
+	u, err := url.Parse(site.URL)
+	if err != nil {
+		return append(problems, fmt.Sprintf("invalid url %q: %v", site.URL, err))
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ws", "wss":
+	default:
+		return append(problems, fmt.Sprintf("%s: unsupported scheme %q (use http, https, ws, wss or %s)", site.URL, u.Scheme, unixScheme))
+	}
+	if u.Hostname() == "" {
+		return append(problems, site.URL+": url has no host")
+	}
+	if reason := unreachableHost(u); reason != "" {
+		problems = append(problems, site.URL+": "+reason)
+	}
+	return problems
+}
+
+// documentationNets are the address ranges reserved for examples, which
+// are never routed (RFC 5737 and RFC 3849)
+var documentationNets = []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"}
+
+// unreachableHost says why u's host looks like it can't be reached, or
+// returns "" when it looks fine
+func unreachableHost(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Sprintf("port %s is out of range", port)
+		}
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsUnspecified() {
+			return host + " is the unspecified address, not a host"
+		}
+		for _, cidr := range documentationNets {
+			if _, network, _ := net.ParseCIDR(cidr); network.Contains(ip) {
+				return host + " is in the documentation range " + cidr + ", which is never routed"
+			}
+		}
+		return ""
+	}
+	for _, domain := range []string{"example.com", "example.net", "example.org"} {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return host + " is a reserved example domain"
+		}
+	}
+	tld := host[strings.LastIndex(host, ".")+1:]
+	switch tld {
+	case "example", "invalid", "test":
+		return fmt.Sprintf("%s uses the reserved .%s TLD, which never resolves publicly", host, tld)
+	}
+	return ""
+}
+
+// lintDuplicates flags sites fetching the same URL with the same method
+// as an earlier one, and sites whose URL only differs from an earlier
+// one's by scheme or a trailing slash
+func lintDuplicates(entries []configEntry) []lintIssue {
+	var issues []lintIssue
+	seen := make(map[string]int)
+	similar := make(map[string]int)
+	for _, entry := range entries {
+		site := entry.site
+		if site.URL == "" {
+			continue
+		}
+		key := site.requestMethod() + " " + site.Socket + " " + normalizeURL(site.URL)
+		if line, ok := seen[key]; ok {
+			issues = append(issues, lintIssue{entry.line, fmt.Sprintf("%s: duplicate of line %d", site.URL, line)})
+			continue
+		}
+		seen[key] = entry.line
+
+		overlap := site.requestMethod() + " " + site.Socket + " " + overlapKey(site.URL)
+		if line, ok := similar[overlap]; ok {
+			issues = append(issues, lintIssue{entry.line, fmt.Sprintf("%s: overlaps line %d, differing only by scheme or trailing slash", site.URL, line)})
+			continue
+		}
+		similar[overlap] = entry.line
+	}
+	return issues
+}
+
+// splitURL splits an http(s) or ws(s) URL into its lower-cased scheme,
+// its user info (with the @), its host with the default port dropped, and
+// the rest exactly as written, so placeholders like ${now} survive. ok is
+// false for other URLs.
+func splitURL(raw string) (scheme, userinfo, host, rest string, ok bool) {
+	scheme, after, found := strings.Cut(strings.TrimSpace(raw), "://")
+	scheme = strings.ToLower(scheme)
+	defaultPort := map[string]string{"http": ":80", "ws": ":80", "https": ":443", "wss": ":443"}[scheme]
+	if !found || defaultPort == "" {
+		return "", "", "", "", false
+	}
+
+	end := strings.IndexAny(after, "/?#")
+	if end < 0 {
+		end = len(after)
+	}
+	host, rest = after[:end], after[end:]
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		userinfo, host = host[:i+1], host[i+1:]
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), defaultPort)
+	return scheme, userinfo, host, rest, true
+}
+
+// normalizeURL lower-cases the scheme and host of an http(s) or ws(s) URL
+// and drops a default port, leaving other URLs alone
+func normalizeURL(raw string) string {
+	scheme, userinfo, host, rest, ok := splitURL(raw)
+	if !ok {
+		return raw
+	}
+	return scheme + "://" + userinfo + host + rest
+}
+
+// overlapKey identifies a URL up to its scheme, fragment and a trailing
+// slash on the path
+func overlapKey(raw string) string {
+	_, userinfo, host, rest, ok := splitURL(raw)
+	if !ok {
+		return raw
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	path, query, hasQuery := strings.Cut(rest, "?")
+	key := userinfo + host + strings.TrimSuffix(path, "/")
+	if hasQuery {
+		key += "?" + query
+	}
+	return key
+}
+
+// runFormat prints the config file at path rewritten by formatConfig, or
+// with write rewrites the file in place
+func runFormat(w io.Writer, path string, write bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	formatted, err := formatConfig(data, configFormat() == "txt")
+	if err != nil {
+		return err
+	}
+	if !write {
+		_, err = w.Write(formatted)
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, formatted, info.Mode().Perm())
+}
+
+// formatConfig normalizes every URL of a config file (see normalizeURL).
+// In YAML it also puts the keys of the file and of each site in the order
+// the fields are documented, keeping comments and unknown keys, which go
+// last. Sites stay in their order, since it is the order they are shown in.
+func formatConfig(data []byte, txt bool) ([]byte, error) {
+	if txt {
+		lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				line = normalizeURL(line)
+			}
+			lines[i] = line
+		}
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	}
+
+	file, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return data, nil
+	}
+
+	sortMapping(file.Docs[0].Body, yamlKeyOrder(reflect.TypeOf(WebsitesFile{})))
+	siteOrder := yamlKeyOrder(reflect.TypeOf(Website{}))
+	for _, value := range mappingValues(file.Docs[0].Body) {
+		sites, ok := value.Value.(*ast.SequenceNode)
+		if value.Key.String() != "websites" || !ok {
+			continue
+		}
+		for _, site := range sites.Values {
+			sortMapping(site, siteOrder)
+			for _, field := range mappingValues(site) {
+				if s, ok := field.Value.(*ast.StringNode); ok && field.Key.String() == "url" {
+					s.Value = normalizeURL(s.Value)
+					s.Token.Value = s.Value
+				}
+			}
+		}
+	}
+	return []byte(strings.TrimRight(file.String(), "\n") + "\n"), nil
+}
+
+// yamlKeyOrder maps each YAML key of a struct type to its position among
+// the type's YAML fields
+func yamlKeyOrder(t reflect.Type) map[string]int {
+	order := make(map[string]int)
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key != "" && key != "-" {
+			order[key] = len(order)
+		}
+	}
+	return order
+}
+
+// sortMapping orders the keys of a mapping node by order, keys it doesn't
+// know last
+func sortMapping(node ast.Node, order map[string]int) {
+	mapping, ok := node.(*ast.MappingNode)
+	if !ok {
+		return
+	}
+	rank := func(value *ast.MappingValueNode) int {
+		if i, ok := order[value.Key.String()]; ok {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(mapping.Values, func(a, b *ast.MappingValueNode) int { return rank(a) - rank(b) })
+}
@@ -1,38 +1,357 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/goccy/go-yaml"
+	"github.com/mattn/go-runewidth"
 	probing "github.com/prometheus-community/pro-bing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Repeatable command-line flags, registered in init
+var tagFilter stringList
+
+func init() {
+	flag.Var(&tagFilter, "tag", "only check sites with this tag (repeatable)")
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Command-line flags
+var (
+	configPath             = flag.String("config", fileName, "websites file to load (YAML, or a .txt list of URLs)")
+	format                 = flag.String("format", "", "config file format: yaml or txt (default: from the file extension)")
+	fetchRPS               = flag.Float64("rps", 0, "maximum HTTP fetches per second across all workers (0 = unlimited)")
+	pingRPS                = flag.Float64("ping-rps", 0, "maximum pings started per second across all workers (0 = unlimited)")
+	noFollow               = flag.Bool("no-follow", false, "report the first response instead of following redirects")
+	pingSrc                = flag.String("ping-source", "", "local IP address to send pings from")
+	topN                   = flag.Int("top", 0, "show only the first N rows of each table after sorting (0 = all)")
+	report                 = flag.String("report", "", "also save the results as a JSON report to this file")
+	diffMode               = flag.Bool("diff", false, "compare two saved reports given as arguments instead of running checks")
+	conditional            = flag.Bool("conditional", false, "re-request each URL with its ETag/Last-Modified and check for a 304")
+	decimals               = flag.Int("precision", 2, "decimal places shown for times and sizes (0-6)")
+	throughput             = flag.Bool("throughput", false, "show download throughput (MB/s) for each fetch")
+	reverseDNS             = flag.Bool("reverse-dns", false, "look up and show the PTR record of each pinged IP")
+	parallelPhases         = flag.Bool("parallel-phases", false, "run the ping and fetch phases at the same time (their timings overlap)")
+	border                 = flag.String("border", "", "table border style: ascii, rounded or none (default: rounded, or ascii on dumb/non-UTF-8 terminals)")
+	columnSpec             = flag.String("columns", "", "comma-separated fetch table columns: url, status, check, proto, ip, family, size, sent, transfer, time, ttfb, redirect, final, repeat, throughput, checked, tags, notes")
+	watch                  = flag.Duration("watch", 0, "re-run the checks at this interval until interrupted (e.g. 30s)")
+	abortAfter             = flag.Int("abort-after", 0, "stop the run after this many consecutive failures in a phase (0 = never)")
+	tagMode                = flag.String("tag-mode", "any", "how multiple -tag filters combine: any or all")
+	lossWarn               = flag.Float64("loss-warn", 0, "packet loss percentage above which pings are shown as warnings")
+	lossCrit               = flag.Float64("loss-crit", 50, "packet loss percentage above which pings are shown as errors and count as failures")
+	failOnError            = flag.Bool("fail-on-error", false, "exit with status 1 if any ping or fetch failed")
+	output                 = flag.String("output", "table", "output format: table, line (one line per URL), json or alerts (failures only, as JSON lines)")
+	accept                 = flag.String("accept", "", "Accept header to send with every fetch (default: none)")
+	acceptLanguage         = flag.String("accept-language", "", "Accept-Language header to send with every fetch (default: none)")
+	dnsCacheTTL            = flag.Duration("dns-cache-ttl", 0, "cache ping DNS resolutions for this long (0 resolves every time)")
+	maxFetchTime           = flag.Duration("max-fetch-time", 0, "mark fetches slower than this as SLA breaches (0 disables)")
+	history                = flag.String("history", "", "append every run to this JSONL file")
+	replay                 = flag.String("replay", "", "render the latest run from this -history file instead of checking the sites")
+	replayAt               = flag.String("replay-at", "", "with -replay, pick the latest run started at or before this RFC 3339 time")
+	preResolve             = flag.Bool("pre-resolve", false, "resolve every host up front and reuse the addresses for pings and fetches")
+	resolveConcurrency     = flag.Int("resolve-concurrency", 16, "maximum DNS lookups in flight during -pre-resolve")
+	retryAttempts          = flag.Int("retry-attempts", 1, "total tries per fetch, including the first")
+	retryBackoff           = flag.Duration("retry-backoff", 500*time.Millisecond, "wait before the first retry, doubling after each")
+	retryOn                = flag.String("retry-on", "5xx,timeout,connection", "comma-separated failures to retry: 5xx, timeout, connection")
+	saveBodies             = flag.String("save-bodies", "", "write each fetched body to a file in this directory")
+	otelEndpoint           = flag.String("otel-endpoint", "", "export a trace span per ping and fetch to this OTLP/HTTP collector (host:port for HTTPS, or a URL such as http://localhost:4318)")
+	useHTTP3               = flag.Bool("http3", false, "fetch https:// URLs over HTTP/3 (QUIC), falling back to HTTP/2 or 1.1")
+	outPath                = flag.String("out", "", "write the dashboard or line output to this file instead of stdout, without colours")
+	pinIP                  = flag.Bool("pin-ip", false, "resolve each host once and ping and fetch that same IP (implies -pre-resolve)")
+	apiAddr                = flag.String("api", "", "serve the latest results as JSON on this address (e.g. :8080), re-running every -watch (default 30s)")
+	showVersion            = flag.Bool("version", false, "print the version and build details, then exit")
+	historyWindow          = flag.Int("history-window", 10, "in -watch mode, how many recent cycles the ping Trend sparkline covers")
+	show                   = flag.String("show", "url", "identify sites in the tables by url, name, or both (name, with the URL in the notes)")
+	clientErrorsAsWarnings = flag.Bool("4xx-as-warning", false, "show 4xx statuses as warnings and not count them for -fail-on-error")
+	preflightOn            = flag.Bool("preflight", false, "check connectivity against -preflight-ping and -preflight-url before running, aborting if offline")
+	preflightPing          = flag.String("preflight-ping", "1.1.1.1", "host pinged by -preflight (empty to skip)")
+	preflightURL           = flag.String("preflight-url", "https://example.com", "URL fetched by -preflight (empty to skip)")
+	showDisabled           = flag.Bool("show-disabled", false, "list sites with enabled: false as dimmed rows instead of hiding them")
+	perHostConcurrency     = flag.Int("per-host-concurrency", 0, "maximum simultaneous fetches to any one host (0 = unlimited)")
+	repeat                 = flag.Int("repeat", 1, "fetch each URL this many times in a row and show min/avg/max durations")
+	pingProto              = flag.String("ping-proto", "icmp", "ping with privileged raw ICMP (icmp) or unprivileged ICMP over UDP sockets (udp)")
+	showDNS                = flag.Bool("show-dns", false, "show a DNS Resolution table of every host, its addresses and lookup time (implies -pre-resolve)")
+	fetchInterface         = flag.String("interface", "", "send fetches from this local IP address or network interface (e.g. eth1)")
+	quiet                  = flag.Bool("quiet", false, "hide the progress spinners and don't clear the screen, printing only the results")
+	requireHTTPS           = flag.Bool("require-https", false, "list sites with plaintext http:// URLs as policy violations (see https_exempt)")
+	shuffle                = flag.Bool("shuffle", false, "dispatch the checks in a random order each run so no site always goes first")
+	seed                   = flag.Uint64("seed", 0, "seed for -shuffle, to repeat an order (0 picks a random seed)")
+	redirectNotes          = flag.String("redirect-notes", "compact", "how fetch notes describe redirects: compact (\"2 redirects\") or verbose (\"→ example.com (2 hops)\")")
+	groupByStatus          = flag.Bool("group-by-status", false, "split the fetch table into sections by status class: 2xx, 3xx, 4xx, 5xx, then errors")
+	watchdog               = flag.Bool("watchdog", false, "cancel fetches still running after their -max-fetch-time and report them as stalled")
+	asnOn                  = flag.Bool("asn", false, "show the autonomous system of each pinged IP, from the -asn-db database")
+	asnDBPath              = flag.String("asn-db", "GeoLite2-ASN.mmdb", "MaxMind-format ASN database used by -asn")
+	timeUnit               = flag.String("time-unit", "ns", "unit for durations in -output json: ns (integers), us, ms or s")
+	allowHooks             = flag.Bool("allow-hooks", false, "run the pre_hook commands in the websites file; without it a file with hooks is rejected")
+	hookTimeout            = flag.Duration("hook-timeout", 10*time.Second, "how long a site's pre_hook may run before the fetch fails")
+	health                 = flag.Bool("health", false, "show a 0-100 health score above the tables, from ping reachability and healthy fetches")
+	healthPingWeight       = flag.Float64("health-ping-weight", 0.3, "share of the -health score given to ping reachability (0-1); fetches get the rest")
+	hostGroups             = flag.Bool("host-groups", false, "fetch sites on the same host one after another so they reuse one keep-alive connection; hosts still run in parallel")
+	captureHeaders         = flag.Bool("capture-headers", false, "include the final response's full headers in JSON output (-output json, -report, -history)")
+	selftest               = flag.Bool("selftest", false, "fetch built-in local fixtures (200, redirects, 404, timeout), print PASS/FAIL for each and exit 1 on any failure")
+	dnsConcurrency         = flag.Int("dns-concurrency", 0, "maximum DNS lookups in flight across pings, fetches and -pre-resolve (0 = unlimited)")
+	hostHeader             = flag.String("host-header", "", "send this Host header on every fetch while still connecting to the URL's own address (sites can override with host_header)")
+	themeName              = flag.String("theme", "dark", "colour palette: dark, light (for light backgrounds) or mono (no colour)")
+	benchmark              = flag.String("benchmark", "", "load-test this URL instead of checking the websites file: send -n requests, -c at a time, and report requests/sec, latency percentiles and errors")
+	benchRequests          = flag.Int("n", 100, "number of requests -benchmark sends")
+	benchConcurrency       = flag.Int("c", 10, "number of -benchmark requests in flight at once")
+	slowLog                = flag.Duration("slow-log", 0, "log each ping or fetch still running after this long to stderr as it happens, and again with its final time (0 disables)")
+	textfile               = flag.String("textfile", "", "after each run, write Prometheus metrics to this .prom file for node_exporter's textfile collector")
+	maxIdleConns           = flag.Int("max-idle-conns", 100, "idle keep-alive connections the fetch client keeps across all hosts (0 = no limit)")
+	maxIdleConnsPerHost    = flag.Int("max-idle-conns-per-host", 2, "idle keep-alive connections kept per host")
+	maxConnsPerHost        = flag.Int("max-conns-per-host", 0, "connections per host, dialling, active and idle together (0 = no limit)")
+	maxRTT                 = flag.Duration("max-rtt", 0, "mark pings whose average RTT exceeds this as failures, even with no packet loss (0 disables)")
+	family                 = flag.String("family", "auto", "IP family to ping and fetch over: 4, 6 or auto")
+	showFamily             = flag.Bool("show-family", false, "add an IP column showing whether each ping and fetch went over IPv4 or IPv6")
+	lint                   = flag.Bool("lint", false, "check the config file for invalid fields, bad URLs and duplicate sites, print each issue with its line, then exit")
+	fmtConfig              = flag.Bool("fmt", false, "print the config file with normalized URLs and its keys in canonical order, then exit")
+	fmtWrite               = flag.Bool("w", false, "with -fmt, rewrite the config file in place instead of printing it")
+	tui                    = flag.Bool("tui", false, "show a live full-screen dashboard whose rows update in place as results arrive, re-running every -watch (default 30s); q quits")
+	progressive            = flag.Bool("progressive", false, "render the ping table as soon as the pings finish, without waiting for the fetches")
+	progressiveAfter       = flag.Duration("progressive-after", 0, "with -progressive, only render the ping table early once the fetches have run this long")
+	dnsServer              = flag.String("dns-server", "", "resolve every host through this DNS server (ip or ip:port) instead of the system resolver")
+	ttfbRatio              = flag.Float64("ttfb-ratio", 0.8, "note high server latency when waiting for the first byte takes more than this fraction of the final request's time (1 disables)")
 )
 
 type Website struct {
 	Name string `yaml:"name"`
 	URL  string `yaml:"url"`
+	// FollowRedirects defaults to true when omitted
+	FollowRedirects *bool `yaml:"follow_redirects"`
+	// Socket is a Unix domain socket to send the HTTP request over
+	Socket string `yaml:"socket"`
+	// Tags are free-form labels used to select sites with -tag
+	Tags []string `yaml:"tags"`
+	// Accept and AcceptLanguage override the -accept and -accept-language
+	// flags for this site
+	Accept         string `yaml:"accept"`
+	AcceptLanguage string `yaml:"accept_language"`
+	// MaxTime overrides -max-fetch-time for this site
+	MaxTime time.Duration `yaml:"max_time"`
+	// MaxRTT overrides -max-rtt for this site
+	MaxRTT time.Duration `yaml:"max_rtt"`
+	// Retry overrides the global retry flags for this site
+	Retry *RetryPolicy `yaml:"retry"`
+	// Assert is the success criterion shown in the Check column
+	Assert *Assertion `yaml:"assert"`
+	// ClientErrorsAsWarnings overrides -4xx-as-warning when set
+	ClientErrorsAsWarnings *bool `yaml:"4xx_as_warning"`
+	// Enabled defaults to true; disabled sites are never pinged or fetched
+	Enabled *bool `yaml:"enabled"`
+	// Method is the HTTP method to fetch with (default GET), and Body the
+	// request body sent with it
+	Method string `yaml:"method"`
+	Body   string `yaml:"body"`
+	// Headers are extra request headers. Values may use ${pre_hook_output}.
+	Headers map[string]string `yaml:"headers"`
+	// ExpectFinalHost is the host the fetch must end on once redirects
+	// have been followed, e.g. for canonicalisation checks
+	ExpectFinalHost string `yaml:"expect_final_host"`
+	// TLSServerName is the name sent in TLS SNI and checked against the
+	// certificate, in place of the URL's host
+	TLSServerName string `yaml:"tls_server_name"`
+	// HostHeader overrides -host-header: the Host sent in the request,
+	// while the connection still goes to the URL's own host
+	HostHeader string `yaml:"host_header"`
+	// PreHook is a shell command run before each fetch, whose output fills
+	// ${pre_hook_output}; it only runs with -allow-hooks
+	PreHook string `yaml:"pre_hook"`
+	// IPs and PingIPs are the addresses of the fetch and ping hosts found
+	// by -pre-resolve
+	IPs     []string `yaml:"-"`
+	PingIPs []string `yaml:"-"`
+}
+
+// validate checks the site's retry conditions and compiles its
+// assertion. Assert is a pointer, so the compiled pattern stays with the
+// site.
+func (w Website) validate() error {
+	if w.Retry != nil {
+		if err := validateRetryOn(w.Retry.RetryOn); err != nil {
+			return err
+		}
+	}
+	if w.Assert != nil {
+		if err := w.Assert.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxFetchTime returns the SLA for fetching the site, or 0 for none
+func (w Website) maxFetchTime() time.Duration {
+	return cmp.Or(w.MaxTime, *maxFetchTime)
+}
+
+// maxPingRTT returns the highest acceptable average RTT, or 0 for none
+func (w Website) maxPingRTT() time.Duration {
+	return cmp.Or(w.MaxRTT, *maxRTT)
+}
+
+// requestMethod returns the HTTP method to fetch the site with
+func (w Website) requestMethod() string {
+	return cmp.Or(strings.ToUpper(w.Method), http.MethodGet)
+}
+
+// requestHeader returns the headers to send when fetching the site
+func (w Website) requestHeader() http.Header {
+	header := make(http.Header)
+	if value := cmp.Or(w.Accept, *accept); value != "" {
+		header.Set("Accept", value)
+	}
+	if value := cmp.Or(w.AcceptLanguage, *acceptLanguage); value != "" {
+		header.Set("Accept-Language", value)
+	}
+	for name, value := range w.Headers {
+		header.Set(name, value)
+	}
+	if value := cmp.Or(w.HostHeader, *hostHeader); value != "" {
+		header.Set("Host", value)
+	}
+	return header
+}
+
+// hasTag reports whether the site is labelled with tag
+func (w Website) hasTag(tag string) bool {
+	for _, t := range w.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByTags keeps the websites matching any (or, with matchAll, every)
+// one of tags. With no tags every website is kept.
+func filterByTags(websites []Website, tags []string, matchAll bool) []Website {
+	if len(tags) == 0 {
+		return websites
+	}
+
+	var selected []Website
+	for _, website := range websites {
+		matches := 0
+		for _, tag := range tags {
+			if website.hasTag(tag) {
+				matches++
+			}
+		}
+		if (matchAll && matches == len(tags)) || (!matchAll && matches > 0) {
+			selected = append(selected, website)
+		}
+	}
+	return selected
+}
+
+// splitEnabled separates the websites to check from those disabled in the
+// config
+func splitEnabled(websites []Website) (enabled, disabled []Website) {
+	for _, website := range websites {
+		if website.Enabled == nil || *website.Enabled {
+			enabled = append(enabled, website)
+		} else {
+			disabled = append(disabled, website)
+		}
+	}
+	return enabled, disabled
+}
+
+// shownDisabled returns the rows -show-disabled lists for the disabled
+// websites, or none without it
+func shownDisabled(disabled []Website) []DisabledSite {
+	if !*showDisabled {
+		return nil
+	}
+	sites := make([]DisabledSite, 0, len(disabled))
+	for _, site := range disabled {
+		sites = append(sites, DisabledSite{URL: site.URL, Name: site.Name})
+	}
+	return sites
 }
 
-// Load the websites.yaml file
+// followsRedirects reports whether redirects should be followed for the site,
+// honouring the global -no-follow flag
+func (w Website) followsRedirects() bool {
+	if *noFollow {
+		return false
+	}
+	return w.FollowRedirects == nil || *w.FollowRedirects
+}
+
+// warnsOn4xx reports whether 4xx statuses are only warnings for the site,
+// with the site's setting taking precedence over -4xx-as-warning
+func (w Website) warnsOn4xx() bool {
+	if w.ClientErrorsAsWarnings != nil {
+		return *w.ClientErrorsAsWarnings
+	}
+	return *clientErrorsAsWarnings
+}
+
+// Load the websites.yaml file by default
 const fileName = "websites.yaml"
 
 // WebsitesFile represents the structure of the websites.yaml file
 type WebsitesFile struct {
 	Websites []Website `yaml:"websites"`
+	// HTTPSExempt lists hosts allowed to use http:// under -require-https
+	HTTPSExempt []string `yaml:"https_exempt"`
 }
 
-func loadWebsitesFile() []Website {
+func loadWebsitesFile() WebsitesFile {
 	// Read the file
-	fileHandle, err := os.Open(fileName)
+	fileHandle, err := os.Open(*configPath)
 	if err != nil {
 		panic(err)
 	}
+	defer fileHandle.Close()
+
+	// Plain text lists hold one URL per line
+	if configFormat() == "txt" {
+		websites, err := parseWebsitesText(fileHandle)
+		if err != nil {
+			panic(err)
+		}
+		return WebsitesFile{Websites: websites}
+	}
 
 	// Unmarshal the file
 	var websitesFile WebsitesFile
@@ -41,46 +360,176 @@ func loadWebsitesFile() []Website {
 		panic(err)
 	}
 
-	return websitesFile.Websites
+	for _, site := range websitesFile.Websites {
+		if err := site.validate(); err != nil {
+			panic(fmt.Errorf("%s: %w", site.URL, err))
+		}
+		if site.PreHook != "" && !*allowHooks {
+			panic(fmt.Errorf("%s: pre_hook needs -allow-hooks to run", site.URL))
+		}
+	}
+
+	return websitesFile
+}
+
+// configFormat returns the -format flag, or guesses it from the config
+// file's extension
+func configFormat() string {
+	if *format != "" {
+		return *format
+	}
+	if strings.EqualFold(filepath.Ext(*configPath), ".txt") {
+		return "txt"
+	}
+	return "yaml"
+}
+
+// parseWebsitesText reads one URL per line, skipping blank lines and
+// # comments. Each website is named after its URL's host.
+func parseWebsitesText(r io.Reader) ([]Website, error) {
+	var websites []Website
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := line
+		if u, err := url.Parse(line); err == nil && u.Host != "" {
+			name = u.Host
+		}
+		websites = append(websites, Website{Name: name, URL: line})
+	}
+	return websites, scanner.Err()
 }
 
 // PingResult stores the result of a ping operation
 type PingResult struct {
-	URL         string
-	Domain      string
-	PacketsSent int
-	PacketsRecv int
-	PacketLoss  float64
-	AvgRtt      time.Duration
-	Error       error
+	URL         string        `json:"url"`
+	Name        string        `json:"name,omitempty"`
+	Domain      string        `json:"domain"`
+	PacketsSent int           `json:"packets_sent"`
+	PacketsRecv int           `json:"packets_recv"`
+	PacketLoss  float64       `json:"packet_loss"`
+	AvgRtt      time.Duration `json:"avg_rtt"`
+	IP          string        `json:"ip,omitempty"`
+	PTR         string        `json:"ptr,omitempty"`
+	// ASN and ASOrg identify the autonomous system of IP under -asn
+	ASN   uint   `json:"asn,omitempty"`
+	ASOrg string `json:"as_org,omitempty"`
+	Error error  `json:"-"`
+	// Skipped explains why no ping was attempted
+	Skipped string `json:"skipped,omitempty"`
+	// CheckedAt is when the result was produced
+	CheckedAt time.Time `json:"checked_at"`
+	// Trend holds the average RTTs of recent -watch cycles, oldest first,
+	// with 0 for cycles where the ping failed
+	Trend []time.Duration `json:"trend,omitempty"`
+	// RTTBreach is set when the average RTT exceeded the site's -max-rtt
+	RTTBreach bool `json:"rtt_breach,omitempty"`
+	// IPVersion is 4 or 6 for the address pinged
+	IPVersion int `json:"ip_version,omitempty"`
 }
 
 // FetchResult stores the result of a fetch operation
 type FetchResult struct {
-	URL        string
-	StatusCode int
-	BodyLength int
-	BodySize   float64
-	Error      error
-	Redirects  []string
+	URL        string    `json:"url"`
+	Name       string    `json:"name,omitempty"`
+	StatusCode int       `json:"status_code"`
+	BodyLength int       `json:"body_length"`
+	BodySize   float64   `json:"body_size_mb"`
+	Error      error     `json:"-"`
+	ErrorKind  ErrorKind `json:"error_kind,omitempty"`
+	Redirects  []string  `json:"redirects,omitempty"`
+	// Location is the redirect target when redirects were not followed
+	Location string `json:"location,omitempty"`
+	// Duration is the wall-clock time from the first request until the
+	// final body was read, including any redirects
+	Duration time.Duration `json:"duration"`
+	// Throughput is the download rate in MB/s, or 0 for bodies too small
+	// to measure meaningfully
+	Throughput float64 `json:"throughput_mbps,omitempty"`
+	// CheckedAt is when the result was produced
+	CheckedAt time.Time `json:"checked_at"`
+	// RedirectKind summarises where the redirect chain led
+	RedirectKind RedirectKind `json:"redirect_kind,omitempty"`
+	// Downgrade is set when a redirect went from https:// to http://
+	Downgrade bool `json:"downgrade,omitempty"`
+	// CrossDomain is set when the redirects left the registered domain
+	CrossDomain bool `json:"cross_domain,omitempty"`
+	// FinalHostMismatch is the host the fetch ended on when it isn't the
+	// site's expect_final_host
+	FinalHostMismatch string `json:"final_host_mismatch,omitempty"`
+	// Tags are copied from the website that was fetched
+	Tags []string `json:"tags,omitempty"`
+	// ConditionalOK reports whether a conditional re-request got a 304,
+	// and is nil when not checked or the response had no validators
+	ConditionalOK *bool `json:"conditional_ok,omitempty"`
+	// SLABreach is set when a successful fetch took longer than the
+	// site's -max-fetch-time
+	SLABreach bool `json:"sla_breach,omitempty"`
+	// Attempts is how many times the fetch was tried
+	Attempts int `json:"attempts,omitempty"`
+	// BodyFile is where -save-bodies wrote the body
+	BodyFile string `json:"body_file,omitempty"`
+	// CheckOK is the outcome of the site's assertion, and nil when it has
+	// none; CheckFailure says which condition failed
+	CheckOK      *bool  `json:"check_ok,omitempty"`
+	CheckFailure string `json:"check_failure,omitempty"`
+	// Proto is the protocol of the final response, e.g. "HTTP/2.0"
+	Proto string `json:"proto,omitempty"`
+	// PinnedIP is the address -pin-ip sent both the ping and fetch to
+	PinnedIP string `json:"pinned_ip,omitempty"`
+	// ClientErrorWarning is set when a 4xx status only counts as a
+	// warning under -4xx-as-warning
+	ClientErrorWarning bool `json:"client_error_warning,omitempty"`
+	// Samples holds the duration of each successful fetch under -repeat,
+	// the cold first one included; RepeatFailures counts the others
+	Samples []time.Duration `json:"samples,omitempty"`
+	// RetryAfter is the wait a 429 or 503 asked for in its Retry-After
+	// header, and RetryAfterWaited the total time spent honouring it
+	RetryAfter       time.Duration `json:"-"`
+	RetryAfterWaited time.Duration `json:"retry_after_waited,omitempty"`
+	// RedirectTime is the part of Duration spent on the redirect hops, and
+	// FinalTime the rest, spent on the final request and its body
+	RedirectTime time.Duration `json:"redirect_time,omitempty"`
+	FinalTime    time.Duration `json:"final_time,omitempty"`
+	// TTFB is the time from the final request to its first response byte
+	TTFB time.Duration `json:"ttfb,omitempty"`
+	// ContentLength is the body length the final response advertised, or
+	// 0 when it didn't say
+	ContentLength int64 `json:"content_length,omitempty"`
+	// TransferEncoding lists the final response's transfer codings,
+	// e.g. ["chunked"]; empty for identity bodies and HTTP/2 and HTTP/3
+	TransferEncoding []string `json:"transfer_encoding,omitempty"`
+	// RequestSize is the length in bytes of the request body sent, 0 for
+	// requests without one
+	RequestSize    int `json:"request_size"`
+	RepeatFailures int `json:"repeat_failures,omitempty"`
+	// Headers are the final response's headers, kept for -capture-headers
+	Headers http.Header `json:"headers,omitempty"`
+	// IPVersion is 4 or 6 for the address the final response came from,
+	// or 0 when it isn't known (Unix sockets, WebSocket and HTTP/3)
+	IPVersion int `json:"ip_version,omitempty"`
 }
 
 // TUI Styles
 var (
 	titleStyle = lipgloss.NewStyle().
 			Bold(true).
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4")).
+			Foreground(darkTheme.onAccent).
+			Background(darkTheme.accent).
 			PaddingLeft(2).
 			PaddingRight(2).
 			MarginBottom(1)
 
 	headerStyle = lipgloss.NewStyle().
 			Bold(true).
-			Foreground(lipgloss.Color("#7D56F4")).
+			Foreground(darkTheme.accent).
 			BorderStyle(lipgloss.NormalBorder()).
 			BorderBottom(true).
-			BorderForeground(lipgloss.Color("#7D56F4")).
+			BorderForeground(darkTheme.accent).
 			PaddingLeft(1).
 			PaddingRight(1)
 
@@ -89,381 +538,1477 @@ var (
 			PaddingRight(1)
 
 	successStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#2ECC71"))
+			Foreground(darkTheme.success)
 
 	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E74C3C"))
+			Foreground(darkTheme.error)
 
 	infoStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#3498DB"))
+			Foreground(darkTheme.info)
 
 	warningStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#F39C12"))
+			Foreground(darkTheme.warning)
 
 	tableStyle = lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("#7D56F4")).
+			BorderForeground(darkTheme.accent).
 			MarginTop(1).
 			MarginBottom(1)
 )
 
-func main() {
-	// Clear the terminal
-	fmt.Print("\033[H\033[2J")
-
-	// Print app title
-	appTitle := titleStyle.Render(" Async Web Data Dashboard ")
-	fmt.Println(lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(appTitle))
-	fmt.Println()
+// runChecks runs the ping and fetch phases over urls, one after the other
+// or, with -parallel-phases, at the same time. Each phase is timed from its
+// own start to its own end, so parallel phase timings overlap.
+func runChecks(parent context.Context, urls []Website, disabled []DisabledSite, pingLimiter, fetchLimiter *rate.Limiter) RunResult {
+	run := RunResult{StartedAt: time.Now(), Build: currentBuild(), Disabled: disabled}
+	client := newFetchClient()
+	// Each run has a transport of its own; don't leave its pool behind
+	defer client.CloseIdleConnections()
+
+	// Either phase can cancel all remaining work after repeated failures,
+	// as can an interrupt through parent
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	pingAbort := &abortCounter{limit: *abortAfter, cancel: cancel}
+	fetchAbort := &abortCounter{limit: *abortAfter, cancel: cancel}
+
+	// Resolve every host once so both phases can reuse the addresses
+	if *preResolve || *pinIP || *showDNS {
+		resolveSpinner := startSpinner("Resolving hosts...")
+		start := time.Now()
+		urls, run.Resolutions, run.DNSFailures = resolveAll(ctx, urls, *resolveConcurrency)
+		run.ResolveTime = time.Since(start)
+		resolveSpinner.Stop()
+	}
 
-	// Load the websites
-	urls := loadWebsitesFile()
+	if *parallelPhases {
+		phaseSpinner := startSpinner("Pinging and fetching URLs...")
+		var wg sync.WaitGroup
+		var early *earlyPings
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			run.Pings, run.PingTime = pingAll(ctx, urls, pingLimiter, pingAbort)
+			// The fetch goroutine is still writing run, so hand over
+			// only what the ping table shows
+			early = startEarlyPings(RunResult{Pings: run.Pings, Disabled: run.Disabled})
+		}()
+		go func() {
+			defer wg.Done()
+			run.Fetches, run.FetchTime = fetchAll(ctx, urls, client, fetchLimiter, fetchAbort)
+		}()
+		wg.Wait()
+		phaseSpinner.Stop()
+		run.pingsShown = early.stop()
+		run.Aborted = pingAbort.tripped || fetchAbort.tripped
+		return run
+	}
 
-	// Start the timer
-	start := time.Now()
+	// Show loading spinner
+	pingSpinner := startSpinner("Pinging URLs...")
+	run.Pings, run.PingTime = pingAll(ctx, urls, pingLimiter, pingAbort)
+	pingSpinner.Stop()
+	if pingAbort.tripped {
+		run.Aborted = true
+		return run
+	}
 
 	// Show loading spinner
-	fmt.Println(infoStyle.Render(" ⏳ Pinging URLs..."))
+	early := startEarlyPings(run)
+	fetchSpinner := startSpinner("Fetching URL content...")
+	run.Fetches, run.FetchTime = fetchAll(ctx, urls, client, fetchLimiter, fetchAbort)
+	fetchSpinner.Stop()
+	run.pingsShown = early.stop()
+	run.Aborted = fetchAbort.tripped
+
+	return run
+}
 
-	// Channel for ping results
-	pingResults := make(chan PingResult, len(urls))
+// cancelled reports whether err is ctx having been cancelled, as opposed
+// to a failure of the check itself
+func cancelled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && errors.Is(err, context.Canceled)
+}
 
-	// First ping all the urls
-	for _, url := range urls {
-		go pingUrl(url.URL, pingResults)
+// errNoResult stands in for the result of a worker that exited without
+// returning one
+var errNoResult = errors.New("no result reported")
+
+// abortCounter tracks consecutive failures within a phase and cancels the
+// run once they reach limit. A zero limit never aborts.
+type abortCounter struct {
+	mu      sync.Mutex
+	limit   int
+	streak  int
+	tripped bool
+	cancel  context.CancelFunc
+}
+
+// record notes whether the latest result failed
+func (a *abortCounter) record(failed bool) {
+	if a.limit == 0 {
+		return
 	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !failed {
+		a.streak = 0
+		return
+	}
+	a.streak++
+	if a.streak >= a.limit && !a.tripped {
+		a.tripped = true
+		a.cancel()
+	}
+}
 
-	// Collect all ping results
-	allPingResults := make([]PingResult, 0, len(urls))
-	for i := 0; i < len(urls); i++ {
-		result := <-pingResults
-		allPingResults = append(allPingResults, result)
+// pingAll pings every url concurrently and returns the results sorted by
+// average time, along with how long the phase took
+func pingAll(ctx context.Context, urls []Website, limiter *rate.Limiter, abort *abortCounter) ([]PingResult, time.Duration) {
+	// Start the timer
+	start := time.Now()
+
+	// Each worker fills in its own slot, so every site gets exactly one
+	// result however the workers finish. A worker that exits without one,
+	// as runtime.Goexit would make it, leaves an errNoResult instead.
+	results := make([]PingResult, len(urls))
+	reported := make([]bool, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := pingUrl(ctx, url, limiter)
+			results[i], reported[i] = result, true
+			if !cancelled(ctx, result.Error) {
+				abort.record(result.Error != nil || (result.Skipped == "" && result.PacketsRecv == 0))
+				dashboard.pinged(result)
+			}
+		}()
 	}
+	wg.Wait()
+	for i, ok := range reported {
+		if !ok {
+			results[i] = PingResult{URL: urls[i].URL, Name: urls[i].Name, Error: errNoResult, CheckedAt: time.Now()}
+		}
+	}
+
+	// Leave out the pings an abort or interrupt cut off
+	allPingResults := slices.DeleteFunc(results, func(result PingResult) bool {
+		return cancelled(ctx, result.Error)
+	})
 
-	// Sort ping results by average time (descending)
-	sort.Slice(allPingResults, func(i, j int) bool {
+	// Sort ping results by average time (descending), breaking ties by
+	// URL so the order is the same from run to run
+	sort.SliceStable(allPingResults, func(i, j int) bool {
+		a, b := allPingResults[i], allPingResults[j]
 		// Handle errors (put errors at the end)
-		if allPingResults[i].Error != nil {
-			return false
-		}
-		if allPingResults[j].Error != nil {
-			return true
+		if (a.Error != nil) != (b.Error != nil) {
+			return b.Error != nil
 		}
 		// Sort by AvgRtt in descending order
-		return allPingResults[i].AvgRtt > allPingResults[j].AvgRtt
+		if a.AvgRtt != b.AvgRtt {
+			return a.AvgRtt > b.AvgRtt
+		}
+		return a.URL < b.URL
 	})
 
 	// End the timer for pinging the urls
-	pingTime := time.Since(start)
+	return allPingResults, time.Since(start)
+}
 
+// fetchAll fetches every url concurrently and returns the results sorted
+// by body size, along with how long the phase took
+func fetchAll(ctx context.Context, urls []Website, client *http.Client, limiter *rate.Limiter, abort *abortCounter) ([]FetchResult, time.Duration) {
 	// Start the timer for fetching the data
-	start = time.Now()
-
-	// Show loading spinner
-	fmt.Println(infoStyle.Render(" ⏳ Fetching URL content..."))
-
-	// Channel for fetch results
-	fetchResults := make(chan FetchResult, len(urls))
+	start := time.Now()
 
-	// Now fetch the data from all the urls
-	for _, url := range urls {
-		go fetchData(url.URL, fetchResults)
+	// Fill in one slot per site, as pingAll does
+	results := make([]FetchResult, len(urls))
+	reported := make([]bool, len(urls))
+	fetchOne := func(i int) {
+		result := fetchData(ctx, client, urls[i], limiter)
+		results[i], reported[i] = result, true
+		if !cancelled(ctx, result.Error) {
+			abort.record(result.Error != nil)
+			dashboard.fetched(result)
+		}
 	}
-
-	// Collect all fetch results
-	allFetchResults := make([]FetchResult, 0, len(urls))
-	for i := 0; i < len(urls); i++ {
-		result := <-fetchResults
-		allFetchResults = append(allFetchResults, result)
+	// With -host-groups each host's sites take turns on one connection
+	groups := make([][]int, len(urls))
+	if *hostGroups {
+		groups = groupByHost(urls)
+	} else {
+		for i := range urls {
+			groups[i] = []int{i}
+		}
+	}
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range group {
+				fetchOne(i)
+			}
+		}()
+	}
+	wg.Wait()
+	for i, ok := range reported {
+		if !ok {
+			site := urls[i]
+			results[i] = FetchResult{URL: site.URL, Name: site.Name, Tags: site.Tags, Error: errNoResult, ErrorKind: ErrorKindHTTP, CheckedAt: time.Now()}
+		}
 	}
 
-	// Sort fetch results by body size (descending)
-	sort.Slice(allFetchResults, func(i, j int) bool {
+	// Leave out the fetches an abort or interrupt cut off
+	allFetchResults := slices.DeleteFunc(results, func(result FetchResult) bool {
+		return cancelled(ctx, result.Error)
+	})
+
+	// Sort fetch results by body size (descending), breaking ties by URL
+	// as for pings
+	sort.SliceStable(allFetchResults, func(i, j int) bool {
+		a, b := allFetchResults[i], allFetchResults[j]
 		// Handle errors (put errors at the end)
-		if allFetchResults[i].Error != nil {
-			return false
-		}
-		if allFetchResults[j].Error != nil {
-			return true
+		if (a.Error != nil) != (b.Error != nil) {
+			return b.Error != nil
 		}
 		// Sort by BodySize in descending order
-		return allFetchResults[i].BodySize > allFetchResults[j].BodySize
+		if a.BodySize != b.BodySize {
+			return a.BodySize > b.BodySize
+		}
+		return a.URL < b.URL
 	})
 
 	// End the timer for fetching the data
-	fetchTime := time.Since(start)
-
-	// Display timing information
-	timingTitle := titleStyle.Render(" Timing Information ")
-	fmt.Println(lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(timingTitle))
-
-	// Properly align the timing table headers and values
-	operationHeader := headerStyle.Width(40).Render("Operation")
-	timeHeader := headerStyle.Width(40).Render("Time")
-	headerRow := lipgloss.JoinHorizontal(lipgloss.Top, operationHeader, timeHeader)
-
-	pingRow := lipgloss.JoinHorizontal(lipgloss.Top,
-		cellStyle.Width(40).Render("Ping All URLs"),
-		cellStyle.Width(40).Render(pingTime.String()),
-	)
-
-	fetchRow := lipgloss.JoinHorizontal(lipgloss.Top,
-		cellStyle.Width(40).Render("Fetch All URLs"),
-		cellStyle.Width(40).Render(fetchTime.String()),
-	)
-
-	timingTable := lipgloss.JoinVertical(lipgloss.Left,
-		headerRow,
-		pingRow,
-		fetchRow,
-	)
-
-	fmt.Println(tableStyle.Width(80).Render(timingTable))
-
-	// Print ping results table
-	pingTitle := titleStyle.Render(" Ping Results ")
-	fmt.Println(lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(pingTitle))
-
-	// Create ping table header
-	pingTableHeader := []string{
-		headerStyle.Width(30).Render("URL"),
-		headerStyle.Width(10).Render("Sent"),
-		headerStyle.Width(10).Render("Received"),
-		headerStyle.Width(10).Render("Loss %"),
-		headerStyle.Width(18).Render("Avg Time"),
-	}
-
-	pingHeaderRow := lipgloss.JoinHorizontal(lipgloss.Top, pingTableHeader...)
-
-	// Create ping table rows
-	var pingRows []string
-	pingRows = append(pingRows, pingHeaderRow)
-
-	for _, result := range allPingResults {
-		var row string
-		if result.Error != nil {
-			row = lipgloss.JoinHorizontal(lipgloss.Top,
-				cellStyle.Width(30).Render(truncateString(result.URL, 27)),
-				errorStyle.Width(48).Render(fmt.Sprintf("Error: %v", result.Error)),
-			)
-		} else {
-			recvStyle := cellStyle
-			if result.PacketsRecv == 0 {
-				recvStyle = errorStyle
-			} else if result.PacketsRecv < result.PacketsSent {
-				recvStyle = warningStyle
-			} else {
-				recvStyle = successStyle
-			}
+	return allFetchResults, time.Since(start)
+}
 
-			lossStyle := cellStyle
-			if result.PacketLoss > 50 {
-				lossStyle = errorStyle
-			} else if result.PacketLoss > 0 {
-				lossStyle = warningStyle
-			} else {
-				lossStyle = successStyle
-			}
+// borderMode returns the -border flag, falling back to ASCII boxes on
+// terminals unlikely to draw the rounded ones
+func borderMode() string {
+	if *border != "" {
+		return *border
+	}
+	if os.Getenv("TERM") == "dumb" || !utf8Locale() {
+		return "ascii"
+	}
+	return "rounded"
+}
 
-			row = lipgloss.JoinHorizontal(lipgloss.Top,
-				cellStyle.Width(30).Render(truncateString(result.URL, 27)),
-				cellStyle.Width(10).Render(fmt.Sprintf("%d", result.PacketsSent)),
-				recvStyle.Width(10).Render(fmt.Sprintf("%d", result.PacketsRecv)),
-				lossStyle.Width(10).Render(fmt.Sprintf("%.1f%%", result.PacketLoss)),
-				cellStyle.Width(18).Render(formatDuration(result.AvgRtt)),
-			)
+// utf8Locale reports whether the locale environment selects UTF-8
+func utf8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
 		}
-		pingRows = append(pingRows, row)
 	}
+	return false
+}
 
-	// Render ping table
-	pingTable := lipgloss.JoinVertical(lipgloss.Left, pingRows...)
-	fmt.Println(tableStyle.Render(pingTable))
+// applyBorder swaps the box characters used by the table styles
+func applyBorder(mode string) {
+	switch mode {
+	case "ascii":
+		tableStyle = tableStyle.BorderStyle(lipgloss.ASCIIBorder())
+		headerStyle = headerStyle.BorderStyle(lipgloss.ASCIIBorder())
+	case "none":
+		tableStyle = tableStyle.Border(lipgloss.NormalBorder(), false)
+	}
+}
 
-	// Print fetch results table
-	fetchTitle := titleStyle.Render(" HTTP Fetch Results ")
-	fmt.Println(lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(fetchTitle))
+func main() {
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(currentBuild())
+		return
+	}
 
-	// Create fetch table header
-	fetchTableHeader := []string{
-		headerStyle.Width(30).Render("URL"),
-		headerStyle.Width(12).Render("Status"),
-		headerStyle.Width(12).Render("Size (MB)"),
-		headerStyle.Width(24).Render("Notes"),
+	if err := validateFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render(err.Error()))
+		os.Exit(2)
 	}
 
-	fetchHeaderRow := lipgloss.JoinHorizontal(lipgloss.Top, fetchTableHeader...)
+	applyBorder(borderMode())
+	applyTheme(themes[*themeName])
 
-	// Create fetch table rows
-	var fetchRows []string
-	fetchRows = append(fetchRows, fetchHeaderRow)
+	shutdownTracing, err := setupTracing()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Setting up -otel-endpoint: %v", err)))
+		os.Exit(2)
+	}
+	defer shutdownTracing()
 
-	for _, result := range allFetchResults {
-		var statusStyle lipgloss.Style
+	if *outPath != "" {
+		file, err := openOutput(*outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Opening -out file: %v", err)))
+			os.Exit(2)
+		}
+		defer file.Close()
+	}
 
-		if result.Error != nil {
-			row := lipgloss.JoinHorizontal(lipgloss.Top,
-				cellStyle.Width(30).Render(truncateString(result.URL, 27)),
-				errorStyle.Width(48).Render(fmt.Sprintf("Error: %v", result.Error)),
-			)
-			fetchRows = append(fetchRows, row)
-			continue
+	if *diffMode {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("usage: -diff old.json new.json"))
+			os.Exit(2)
+		}
+		if err := runDiff(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(err.Error()))
+			os.Exit(1)
 		}
+		return
+	}
 
-		// Style based on status code
-		statusText := fmt.Sprintf("%d", result.StatusCode)
-		if result.StatusCode >= 200 && result.StatusCode < 300 {
-			statusStyle = successStyle
-		} else if result.StatusCode >= 300 && result.StatusCode < 400 {
-			statusStyle = warningStyle
-			statusText += " (Redirect)"
-		} else {
-			statusStyle = errorStyle
+	if *selftest {
+		if !runSelftest(out) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *lint {
+		ok, err := runLint(out, *configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Linting %s: %v", *configPath, err)))
+			os.Exit(2)
+		}
+		if !ok {
+			os.Exit(1)
 		}
+		return
+	}
 
-		notes := ""
-		if len(result.Redirects) > 0 {
-			notes = fmt.Sprintf("%d redirects", len(result.Redirects))
+	if *fmtConfig {
+		if err := runFormat(out, *configPath, *fmtWrite); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Formatting %s: %v", *configPath, err)))
+			os.Exit(1)
 		}
+		return
+	}
 
-		row := lipgloss.JoinHorizontal(lipgloss.Top,
-			cellStyle.Width(30).Render(truncateString(result.URL, 27)),
-			statusStyle.Width(12).Render(statusText),
-			cellStyle.Width(12).Render(fmt.Sprintf("%.2f", result.BodySize)),
-			cellStyle.Width(24).Render(notes),
-		)
-		fetchRows = append(fetchRows, row)
+	if *replay != "" {
+		// validateFlags has already checked the timestamp
+		at, _ := parseReplayAt()
+		run, err := loadHistory(*replay, at)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(err.Error()))
+			os.Exit(1)
+		}
+		if *output == "table" {
+			printTitle()
+			fmt.Fprintln(out, infoStyle.Render(" Replaying run from "+run.StartedAt.Format(time.RFC3339)))
+			fmt.Fprintln(out)
+		}
+		if err := reporters[*output].Report(out, run); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing output: %v", err)))
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Render fetch table
-	fetchTable := lipgloss.JoinVertical(lipgloss.Left, fetchRows...)
-	fmt.Println(tableStyle.Render(fetchTable))
+	if *saveBodies != "" {
+		if err := os.MkdirAll(*saveBodies, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Creating -save-bodies directory: %v", err)))
+			os.Exit(1)
+		}
+	}
 
-	// Print detailed redirect information if any
-	hasRedirects := false
-	for _, result := range allFetchResults {
-		if len(result.Redirects) > 0 {
-			hasRedirects = true
-			break
+	// Shared limiters pace the workers of each phase
+	fetchLimiter := newLimiter(*fetchRPS)
+	pingLimiter := newLimiter(*pingRPS)
+	if *dnsCacheTTL > 0 {
+		dnsResolver = newDNSCache(*dnsCacheTTL)
+	}
+	if *dnsConcurrency > 0 {
+		dnsSlots = make(chan struct{}, *dnsConcurrency)
+	}
+	if *dnsServer != "" {
+		resolver = serverResolver(*dnsServer)
+	}
+	if *perHostConcurrency > 0 {
+		hostSlots = newHostSemaphores(*perHostConcurrency)
+	}
+	// A missing database only costs the ASN column, so carry on without it
+	if *asnOn {
+		db, err := openASN(*asnDBPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, warningStyle.Render(fmt.Sprintf("Disabling -asn: %v", err)))
+		} else {
+			asnDB = db
+		}
+	}
+
+	// A benchmark hammers one URL and skips the websites file entirely
+	if *benchmark != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		bench := runBenchmark(ctx, *benchmark, *benchRequests, *benchConcurrency, fetchLimiter)
+		stop()
+		if err := reportBenchmark(out, bench); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing output: %v", err)))
+			os.Exit(1)
+		}
+		if bench.Interrupted {
+			os.Exit(130)
+		}
+		return
+	}
+
+	// Load the websites, setting aside any that are disabled
+	config := loadWebsitesFile()
+	urls, disabled := splitEnabled(filterByTags(config.Websites, tagFilter, *tagMode == "all"))
+	var violations []HTTPSViolation
+	if *requireHTTPS {
+		violations = auditHTTPS(urls, config.HTTPSExempt)
+	}
+
+	if *preflightOn {
+		if err := preflight(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(err.Error()))
+			os.Exit(1)
 		}
 	}
 
-	if hasRedirects {
-		redirectTitle := titleStyle.Render(" Redirect Details ")
-		fmt.Println(lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(redirectTitle))
+	// In API mode the results are served rather than rendered
+	var store *apiStore
+	if *apiAddr != "" {
+		store = &apiStore{}
+		startAPI(*apiAddr, store)
+	}
+
+	var shuffler *rand.Rand
+	if *shuffle {
+		shuffler = newShuffler(*seed)
+	}
+
+	// -show-disabled lists the disabled sites in every run
+	disabledSites := shownDisabled(disabled)
+
+	// Watching keeps a rolling window of RTTs for the Trend column
+	var trends *rttHistory
+	if *watch > 0 {
+		trends = newRTTHistory(*historyWindow)
+	}
+
+	// An interrupt cancels the run in progress, which is then saved and
+	// shown as partial. Once it has been seen, a second one kills the
+	// process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	// -tui draws its own screen and quitting it cancels the loop
+	if *tui {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		dashboard = startDashboard(urls, cancel)
+		defer dashboard.stop()
+	}
+
+	// In watch mode, repeat the checks until interrupted
+	for {
+		// Only the dashboard gets a screen of its own
+		if *output == "table" && store == nil && dashboard == nil {
+			// Clear the terminal, but not in a file or when asked to be quiet
+			if *outPath == "" && !*quiet {
+				fmt.Fprint(out, "\033[H\033[2J")
+			}
+
+			printTitle()
+			fmt.Fprintln(out)
+		}
+
+		// Ping and fetch everything; results are sorted afterwards, so
+		// shuffling only changes who gets resources first
+		shuffleSites(shuffler, urls)
+		dashboard.cycleStarted()
+		run := runChecks(ctx, urls, disabledSites, pingLimiter, fetchLimiter)
+		run.Interrupted = ctx.Err() != nil
+		if trends != nil {
+			trends.record(run.Pings)
+		}
+		run.HTTPSViolations = violations
+
+		// Save the report before rendering so it survives a broken terminal
+		if *report != "" {
+			if err := writeReport(*report, run); err != nil {
+				fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing report: %v", err)))
+			}
+		}
+		if *history != "" {
+			if err := appendHistory(*history, run); err != nil {
+				fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing history: %v", err)))
+			}
+		}
+		if *textfile != "" {
+			if err := writeTextfile(*textfile, run); err != nil {
+				fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing -textfile: %v", err)))
+			}
+		}
+
+		if store != nil {
+			store.set(run)
+		} else if dashboard != nil {
+			dashboard.cycleDone(run)
+		} else if err := reporters[*output].Report(out, run); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Writing output: %v", err)))
+		}
 
-		for _, result := range allFetchResults {
-			if len(result.Redirects) > 0 {
-				fmt.Println(infoStyle.Render(fmt.Sprintf(" → Redirects for %s:", result.URL)))
-				for i, redirect := range result.Redirects {
-					fmt.Println(cellStyle.Render(fmt.Sprintf("   %d. %s", i+1, redirect)))
+		// The partial run has been saved and shown; os.Exit skips the
+		// deferred flush
+		if run.Interrupted {
+			code := 130
+			if dashboard != nil {
+				// Quitting the dashboard with q is a normal exit
+				dashboard.stop()
+				if dashboard.quitKey == "q" {
+					code = 0
 				}
-				fmt.Println()
 			}
+			shutdownTracing()
+			os.Exit(code)
+		}
+
+		if *watch <= 0 {
+			// -output alerts exits non-zero exactly when it printed something
+			failed := *failOnError && runFailed(run)
+			if *output == "alerts" {
+				failed = failed || len(runAlerts(run)) > 0
+			}
+			if failed {
+				// os.Exit skips the deferred flush
+				shutdownTracing()
+				os.Exit(1)
+			}
+			return
+		}
+		if !sleepContext(ctx, *watch) {
+			return
 		}
 	}
 }
 
-// Helper function to truncate long strings
+// validateFlags checks flag values that cannot be expressed by their types
+func validateFlags() error {
+	if *replayAt != "" && *replay == "" {
+		return fmt.Errorf("-replay-at requires -replay")
+	}
+	if _, err := parseReplayAt(); err != nil {
+		return fmt.Errorf("-replay-at must be an RFC 3339 time such as 2006-01-02T15:04:05Z: %v", err)
+	}
+	if *apiAddr != "" && *watch == 0 {
+		*watch = defaultAPIInterval
+	}
+	if *progressive && (*output != "table" || *apiAddr != "" || *tui) {
+		return fmt.Errorf("-progressive only applies to the table output, without -api or -tui")
+	}
+	if *progressiveAfter < 0 {
+		return fmt.Errorf("-progressive-after must not be negative")
+	}
+	if *tui {
+		if *apiAddr != "" || *output != "table" || *outPath != "" {
+			return fmt.Errorf("-tui draws to the terminal and cannot be combined with -api, -output or -out")
+		}
+		if *watch == 0 {
+			*watch = defaultAPIInterval
+		}
+	}
+	if *replay != "" && (*watch > 0 || *diffMode) {
+		return fmt.Errorf("-replay cannot be combined with -watch or -diff")
+	}
+	if *fetchRPS < 0 || *pingRPS < 0 {
+		return fmt.Errorf("-rps and -ping-rps must not be negative")
+	}
+	if *topN < 0 {
+		return fmt.Errorf("-top must not be negative")
+	}
+	if *lossWarn < 0 || *lossCrit > 100 || *lossWarn > *lossCrit {
+		return fmt.Errorf("-loss-warn and -loss-crit must satisfy 0 <= warn <= crit <= 100")
+	}
+	if *show != "url" && *show != "name" && *show != "both" {
+		return fmt.Errorf("-show must be url, name or both")
+	}
+	if _, ok := reporters[*output]; !ok {
+		return fmt.Errorf("-output must be one of %s", reporterNames())
+	}
+	if *abortAfter < 0 {
+		return fmt.Errorf("-abort-after must not be negative")
+	}
+	if *tagMode != "any" && *tagMode != "all" {
+		return fmt.Errorf("-tag-mode must be any or all")
+	}
+	if *maxFetchTime < 0 {
+		return fmt.Errorf("-max-fetch-time must not be negative")
+	}
+	if *maxRTT < 0 {
+		return fmt.Errorf("-max-rtt must not be negative")
+	}
+	if *retryAttempts < 1 || *retryBackoff < 0 {
+		return fmt.Errorf("-retry-attempts must be at least 1 and -retry-backoff must not be negative")
+	}
+	if err := validateRetryOn(splitRetryOn(*retryOn)); err != nil {
+		return fmt.Errorf("-retry-on: %w", err)
+	}
+	if *preflightOn && *preflightPing == "" && *preflightURL == "" {
+		return fmt.Errorf("-preflight needs -preflight-ping or -preflight-url")
+	}
+	if *perHostConcurrency < 0 {
+		return fmt.Errorf("-per-host-concurrency must not be negative")
+	}
+	if *pingProto != "icmp" && *pingProto != "udp" {
+		return fmt.Errorf("-ping-proto must be icmp or udp")
+	}
+	if *pingProto == "udp" && runtime.GOOS == "windows" {
+		return fmt.Errorf("-ping-proto udp is not supported on Windows, which only has raw ICMP")
+	}
+	if *fetchInterface != "" {
+		if *useHTTP3 {
+			return fmt.Errorf("-interface cannot be combined with -http3")
+		}
+		if _, err := sourceIP(*fetchInterface); err != nil {
+			return fmt.Errorf("-interface: %w", err)
+		}
+	}
+	if *redirectNotes != "compact" && *redirectNotes != "verbose" {
+		return fmt.Errorf("-redirect-notes must be compact or verbose")
+	}
+	if _, ok := timeUnits[*timeUnit]; !ok {
+		return fmt.Errorf("-time-unit must be ns, us, ms or s")
+	}
+	if *hookTimeout <= 0 {
+		return fmt.Errorf("-hook-timeout must be positive")
+	}
+	if *healthPingWeight < 0 || *healthPingWeight > 1 {
+		return fmt.Errorf("-health-ping-weight must be between 0 and 1")
+	}
+	if *captureHeaders && *output != "json" && *report == "" && *history == "" {
+		return fmt.Errorf("-capture-headers only shows in JSON; use it with -output json, -report or -history")
+	}
+	if *dnsConcurrency < 0 {
+		return fmt.Errorf("-dns-concurrency must not be negative")
+	}
+	if *dnsServer != "" {
+		// A bare IP means the standard port
+		if _, _, err := net.SplitHostPort(*dnsServer); err != nil {
+			*dnsServer = net.JoinHostPort(strings.Trim(*dnsServer, "[]"), "53")
+		}
+		if _, err := netip.ParseAddrPort(*dnsServer); err != nil {
+			return fmt.Errorf("-dns-server must be an IP address, optionally with a port, such as 8.8.8.8 or [2001:4860:4860::8888]:53")
+		}
+		if *useHTTP3 {
+			return fmt.Errorf("-dns-server cannot be combined with -http3, whose QUIC dialer does its own lookups")
+		}
+	}
+	if *dnsConcurrency > 0 && *useHTTP3 {
+		return fmt.Errorf("-dns-concurrency cannot be combined with -http3, whose QUIC dialer does its own lookups")
+	}
+	if _, ok := themes[*themeName]; !ok {
+		return fmt.Errorf("-theme must be dark, light or mono")
+	}
+	if *benchmark != "" {
+		if *benchRequests < 1 || *benchConcurrency < 1 {
+			return fmt.Errorf("-n and -c must be at least 1")
+		}
+		if *output != "table" && *output != "json" {
+			return fmt.Errorf("-benchmark only supports -output table or json")
+		}
+	}
+	if *maxIdleConns < 0 || *maxIdleConnsPerHost < 0 || *maxConnsPerHost < 0 {
+		return fmt.Errorf("-max-idle-conns, -max-idle-conns-per-host and -max-conns-per-host must not be negative")
+	}
+	if *family != "auto" && *family != "4" && *family != "6" {
+		return fmt.Errorf("-family must be 4, 6 or auto")
+	}
+	if *family != "auto" {
+		if *useHTTP3 {
+			return fmt.Errorf("-family cannot be combined with -http3, whose QUIC dialer picks its own family")
+		}
+		// Fetches from -interface can only go out over its address' family
+		if ip, err := sourceIP(*fetchInterface); *fetchInterface != "" && err == nil && fmt.Sprint(ipVersion(ip.String())) != *family {
+			return fmt.Errorf("-interface %s has no IPv%s address for -family %s", *fetchInterface, *family, *family)
+		}
+	}
+	if *lint && *fmtConfig {
+		return fmt.Errorf("-lint and -fmt cannot be combined")
+	}
+	if *fmtWrite && !*fmtConfig {
+		return fmt.Errorf("-w only applies to -fmt")
+	}
+	if *ttfbRatio <= 0 || *ttfbRatio > 1 {
+		return fmt.Errorf("-ttfb-ratio must be above 0 and at most 1")
+	}
+	if *repeat < 1 {
+		return fmt.Errorf("-repeat must be at least 1")
+	}
+	if *resolveConcurrency < 1 {
+		return fmt.Errorf("-resolve-concurrency must be at least 1")
+	}
+	if *dnsCacheTTL < 0 {
+		return fmt.Errorf("-dns-cache-ttl must not be negative")
+	}
+	if *watch < 0 {
+		return fmt.Errorf("-watch must not be negative")
+	}
+	if *historyWindow < 1 {
+		return fmt.Errorf("-history-window must be at least 1")
+	}
+	if *decimals < 0 || *decimals > 6 {
+		return fmt.Errorf("-precision must be between 0 and 6")
+	}
+	if *columnSpec != "" {
+		if _, err := selectFetchColumns(*columnSpec); err != nil {
+			return fmt.Errorf("-columns: %w", err)
+		}
+	}
+	if *format != "" && *format != "yaml" && *format != "txt" {
+		return fmt.Errorf("-format must be yaml or txt")
+	}
+	switch *border {
+	case "", "ascii", "rounded", "none":
+	default:
+		return fmt.Errorf("-border must be ascii, rounded or none")
+	}
+	if *pingSrc != "" && net.ParseIP(*pingSrc) == nil {
+		return fmt.Errorf("-ping-source %q is not a valid IP address", *pingSrc)
+	}
+	return nil
+}
+
+// printTitle prints the centred app title
+func printTitle() {
+	appTitle := titleStyle.Render(" Async Web Data Dashboard ")
+	fmt.Fprintln(out, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(appTitle))
+}
+
+// parseReplayAt returns the -replay-at time, or the zero time when unset.
+// A time without fractional seconds covers its whole second so that the
+// timestamps printed when replaying can be pasted back in.
+func parseReplayAt() (time.Time, error) {
+	if *replayAt == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, *replayAt)
+	if err == nil && at.Nanosecond() == 0 {
+		at = at.Add(time.Second - 1)
+	}
+	return at, err
+}
+
+// newLimiter returns a limiter allowing rps events per second, or an
+// unlimited one when rps is zero
+func newLimiter(rps float64) *rate.Limiter {
+	if rps == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(rps), 1)
+}
+
+// limitRows returns the first n rows, or all of them when n is zero
+func limitRows[T any](rows []T, n int) []T {
+	if n > 0 && n < len(rows) {
+		return rows[:n]
+	}
+	return rows
+}
+
+// tableSummary describes how many rows a trimmed table shows, counting
+// errors across every result rather than just the visible rows
+func tableSummary(shown, total, errors int) string {
+	return fmt.Sprintf(" Showing %d of %d results (%d errors)", shown, total, errors)
+}
+
+// Helper function to truncate long strings to maxLen terminal cells, so
+// wide (e.g. CJK) and combining characters are measured as displayed
 func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+	return runewidth.Truncate(s, maxLen, "...")
+}
+
+// labelWidth is the width of the first column of every table, which
+// identifies the site (or host) each row is about
+const labelWidth = 30
+
+// fitCell truncates s to fit a cellStyle cell of the given width, after
+// its padding and a one-cell gap before the next column
+func fitCell(s string, width int) string {
+	return truncateString(s, width-cellStyle.GetHorizontalPadding()-1)
+}
+
+// pingHost extracts the host to ping from a website URL. IP literals are
+// returned as-is, while hostnames have any www. prefix stripped.
+func pingHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	// Bare hosts such as "example.com" parse as a path, and "[::1]" not at all
+	if !strings.Contains(rawURL, "://") && (err != nil || u.Host == "") {
+		u, err = url.Parse("//" + rawURL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hostname := u.Hostname()
+	if hostname == "" {
+		return "", fmt.Errorf("no host in URL %q", rawURL)
+	}
+	if net.ParseIP(hostname) != nil {
+		return hostname, nil
+	}
+	return strings.TrimPrefix(hostname, "www."), nil
+}
+
+// pingUrl pings the site. A panic in the pinger becomes the result's
+// error, so one host that blew up can't take the whole run down with it.
+func pingUrl(ctx context.Context, site Website, limiter *rate.Limiter) (result PingResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = PingResult{
+				URL:       site.URL,
+				Name:      site.Name,
+				Error:     fmt.Errorf("pinger panicked: %v", r),
+				CheckedAt: time.Now(),
+			}
+		}
+	}()
+	defer watchSlow("ping", site.URL)()
+	return ping(ctx, site, limiter)
+}
+
+// ping pings the host of the site's URL once the limiter allows it
+func ping(ctx context.Context, site Website, limiter *rate.Limiter) PingResult {
+	ctx, span := tracer.Start(ctx, "ping", trace.WithAttributes(semconv.URLFull(site.URL)))
+	result := pingSite(ctx, site, limiter)
+	if limit := site.maxPingRTT(); limit > 0 && result.Error == nil && result.PacketsRecv > 0 {
+		result.RTTBreach = result.AvgRtt > limit
 	}
-	return s[:maxLen-3] + "..."
+	result.CheckedAt = time.Now()
+	span.SetAttributes(pingSpanAttributes(result)...)
+	endSpan(span, result.Error)
+	return result
 }
 
-func pingUrl(url string, results chan<- PingResult) {
+// pingSite does the work of ping, leaving bookkeeping to it
+func pingSite(ctx context.Context, site Website, limiter *rate.Limiter) PingResult {
 	result := PingResult{
-		URL: url,
+		URL:  site.URL,
+		Name: site.Name,
 	}
 
-	// Extract hostname from URL
-	hostname := url
-	if len(url) > 8 && url[:8] == "https://" {
-		hostname = url[8:]
-	} else if len(url) > 7 && url[:7] == "http://" {
-		hostname = url[7:]
+	// There is no host to ping behind a Unix socket
+	if _, _, ok := site.unixSocket(); ok {
+		result.Skipped = "unix socket"
+		return result
 	}
 
-	// Strip www. prefix if present
-	if len(hostname) > 4 && hostname[:4] == "www." {
-		hostname = hostname[4:]
+	// Extract hostname from URL
+	hostname, err := pingHost(site.URL)
+	if err != nil {
+		result.Error = err
+		return result
 	}
 
 	result.Domain = hostname
 
-	pinger, err := probing.NewPinger(hostname)
-	if err != nil {
+	// Hand the pinger an IP when one is known so it skips its own lookup
+	target := hostname
+	ips := site.PingIPs
+	if len(ips) == 0 && (dnsResolver != nil || dnsSlots != nil || resolver != net.DefaultResolver) {
+		// Resolving here rather than in the pinger keeps the lookup
+		// cached, within -dns-concurrency and on -dns-server
+		if ips, err = resolveHost(ctx, hostname); err != nil {
+			result.Error = err
+			return result
+		}
+	}
+	if len(ips) > 0 {
+		if ips = filterFamily(ips); len(ips) == 0 {
+			result.Error = fmt.Errorf("%s has no IPv%s address", hostname, *family)
+			return result
+		}
+		target = ips[0]
+	}
+
+	pinger := probing.New(target)
+	pinger.SetNetwork(familyNetwork("ip"))
+	if err := pinger.Resolve(); err != nil {
 		result.Error = err
-		results <- result
-		return
+		return result
+	}
+
+	// Wait for our turn before sending any packets
+	if err := limiter.Wait(ctx); err != nil {
+		result.Error = err
+		return result
 	}
 
 	// Set pinger options
 	pinger.Count = 3
 	pinger.Timeout = time.Second * 5
-	// Need to set this for Windows
-	pinger.SetPrivileged(true)
+	// Raw ICMP is needed on Windows and is the default; udp uses the
+	// unprivileged ping sockets Linux and macOS offer
+	pinger.SetPrivileged(*pingProto == "icmp")
+	if *pingSrc != "" {
+		pinger.Source = *pingSrc
+	}
 
-	err = pinger.Run()
+	err = runPinger(pinger, ctx)
 	if err != nil {
+		if *pingSrc != "" {
+			err = fmt.Errorf("ping from source %s: %w", *pingSrc, err)
+		}
+		if errors.Is(err, os.ErrPermission) {
+			err = fmt.Errorf("%w (%s)", err, pingPermissionHint())
+		}
 		result.Error = err
-		results <- result
-		return
+		return result
 	}
 
-	stats := pinger.Statistics()
+	stats := pingStats(pinger)
 	result.PacketsSent = stats.PacketsSent
 	result.PacketsRecv = stats.PacketsRecv
 	result.PacketLoss = stats.PacketLoss
 	result.AvgRtt = stats.AvgRtt
 
-	results <- result
+	if addr := pinger.IPAddr(); addr != nil {
+		result.IP = addr.IP.String()
+		result.IPVersion = ipVersion(result.IP)
+		if asnDB != nil {
+			info := asnDB.lookup(result.IP)
+			result.ASN, result.ASOrg = info.Number, info.Org
+		}
+		if *reverseDNS {
+			result.PTR = lookupPTR(ctx, result.IP)
+		}
+	}
+
+	return result
 }
 
-func fetchData(url string, results chan<- FetchResult) {
-	result := FetchResult{
-		URL: url,
+// runPinger sends the pings; tests replace it to stand in for the network
+var runPinger = (*probing.Pinger).RunWithContext
+
+// pingStats reads back what runPinger measured, and is replaced with it
+var pingStats = (*probing.Pinger).Statistics
+
+// pingPermissionHint explains what a ping that was refused permission
+// needs under the chosen -ping-proto
+func pingPermissionHint() string {
+	if *pingProto == "udp" {
+		return "unprivileged ping needs your group ID inside the net.ipv4.ping_group_range sysctl"
 	}
+	return "raw ICMP needs root or CAP_NET_RAW; try -ping-proto udp"
+}
 
-	resp, err := http.Get(url)
+// lookupPTR returns the first PTR record for ip, or "" when it has none
+func lookupPTR(ctx context.Context, ip string) string {
+	release, err := acquireDNSSlot(ctx)
 	if err != nil {
+		return ""
+	}
+	defer release()
+	names, err := resolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// newShuffler returns the random source for -shuffle, seeded with seed or,
+// when it is 0, randomly
+func newShuffler(seed uint64) *rand.Rand {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
+
+// shuffleSites reorders urls in place with r, or leaves them be when r is
+// nil (no -shuffle)
+func shuffleSites(r *rand.Rand, urls []Website) {
+	if r != nil {
+		r.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	}
+}
+
+// defaultAPIInterval is how often -api re-runs the checks without -watch
+const defaultAPIInterval = 30 * time.Second
+
+// minThroughputBytes is the smallest body for which throughput is reported
+const minThroughputBytes = 64 * 1024
+
+// maxRedirects caps how many redirects fetch will follow for one URL
+const maxRedirects = 10
+
+// newFetchClient returns a client that never follows redirects itself so
+// that fetch can record each hop (or stop at the first one when
+// following is disabled)
+func newFetchClient() *http.Client {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if *useHTTP3 {
+		h3 := newHTTP3Transport()
+		applyPoolLimits(h3.fallback)
+		client.Transport = h3
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// validateFlags has already checked the address
+	if *fetchInterface != "" {
+		ip, _ := sourceIP(*fetchInterface)
+		transport = boundTransport(ip)
+	}
+	if *family != "auto" {
+		transport.DialContext = familyDial(transport.DialContext)
+	}
+	if dnsSlots != nil || resolver != net.DefaultResolver {
+		transport.DialContext = resolvingDial(transport.DialContext)
+	}
+	applyPoolLimits(transport)
+	client.Transport = transport
+	return client
+}
+
+// applyPoolLimits sets the -max-idle-conns, -max-idle-conns-per-host and
+// -max-conns-per-host connection pool limits on transport
+func applyPoolLimits(transport *http.Transport) {
+	transport.MaxIdleConns = *maxIdleConns
+	transport.MaxIdleConnsPerHost = *maxIdleConnsPerHost
+	transport.MaxConnsPerHost = *maxConnsPerHost
+}
+
+// fetchData fetches the site, -repeat times when asked. The client should
+// not follow redirects on its own (see newFetchClient).
+func fetchData(ctx context.Context, client *http.Client, site Website, limiter *rate.Limiter) FetchResult {
+	defer watchSlow("fetch", site.URL)()
+	return fetchRepeated(ctx, client, site, limiter)
+}
+
+// fetch fetches the site with the given client once the limiter allows it,
+// following redirects unless the site disables them
+func fetch(ctx context.Context, client *http.Client, site Website, limiter *rate.Limiter) FetchResult {
+	ctx, span := tracer.Start(ctx, "fetch", trace.WithAttributes(semconv.URLFull(site.URL)))
+	policy := site.retryPolicy()
+	var result FetchResult
+	var retryAfterWaited time.Duration
+	// Retry failures the policy covers, backing off between tries
+	for attempt := 1; ; attempt++ {
+		result = fetchSite(ctx, client, site, limiter)
+		result.ErrorKind = classifyError(result.Error)
+		result.Attempts = attempt
+		if attempt >= policy.Attempts || !policy.shouldRetry(result) {
+			break
+		}
+		wait, ok := retryWait(ctx, policy, attempt, result)
+		if !ok || !sleepContext(ctx, wait) {
+			break
+		}
+		if result.RetryAfter > 0 {
+			retryAfterWaited += wait
+		}
+	}
+	result.RetryAfterWaited = retryAfterWaited
+	if result.Error != nil && result.Attempts > 1 {
+		result.Error = fmt.Errorf("after %d attempts: %w", result.Attempts, result.Error)
+	}
+	result.RedirectKind = classifyRedirects(result)
+	result.Downgrade, result.CrossDomain = scanRedirectChain(result)
+	if site.ExpectFinalHost != "" && result.Error == nil {
+		if host := finalHost(result); !sameHost(host, site.ExpectFinalHost) {
+			result.FinalHostMismatch = host
+		}
+	}
+	if limit := site.maxFetchTime(); limit > 0 && result.Error == nil {
+		result.SLABreach = result.Duration > limit
+	}
+	result.CheckedAt = time.Now()
+	span.SetAttributes(fetchSpanAttributes(result)...)
+	endSpan(span, result.Error)
+	return result
+}
+
+// fetchSite does the work of fetch, leaving error classification and
+// bookkeeping to it
+func fetchSite(ctx context.Context, client *http.Client, site Website, limiter *rate.Limiter) (result FetchResult) {
+	result = FetchResult{
+		URL:  site.URL,
+		Name: site.Name,
+		Tags: site.Tags,
+	}
+
+	target := site.URL
+	client = siteClient(client, site)
+	if _, httpURL, ok := site.unixSocket(); ok {
+		target = httpURL
+	} else if len(site.IPs) > 0 && *pinIP {
+		result.PinnedIP = site.IPs[0]
+	}
+	target = expandPlaceholders(target)
+
+	// Mint whatever the headers need before queueing for the host
+	header := site.requestHeader()
+	if site.PreHook != "" {
+		output, err := runPreHook(ctx, site)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		applyHookOutput(header, output)
+	}
+
+	// Take one of the host's slots for the whole fetch, including the body
+	if hosts := siteHosts(site); hostSlots != nil && len(hosts) > 0 {
+		release, err := hostSlots.acquire(ctx, hosts[0])
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		defer release()
+	}
+
+	// Wait for our turn before issuing the request
+	if err := limiter.Wait(ctx); err != nil {
 		result.Error = err
-		results <- result
-		return
+		return result
+	}
+
+	// The watchdog cuts off a fetch that outlives its SLA, even one whose
+	// body is still trickling in too steadily for a timeout to fire
+	if limit := site.maxFetchTime(); *watchdog && limit > 0 {
+		parent := ctx
+		watched, cancel := context.WithTimeout(parent, limit)
+		defer cancel()
+		defer func() {
+			if result.Error != nil && errors.Is(watched.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+				result.Error = fmt.Errorf("stalled after %s: %w", limit, result.Error)
+			}
+		}()
+		ctx = watched
+	}
+
+	// WebSocket endpoints only get the upgrade handshake
+	if isWebSocket(target) {
+		return fetchWebSocket(ctx, target, site.TLSServerName, header, result)
+	}
+
+	start := time.Now()
+	// finalStart moves to each hop's request, ending on the final one
+	finalStart := start
+	method, payload := site.requestMethod(), []byte(site.Body)
+	result.RequestSize = len(payload)
+	// remote ends up holding the address of the final hop's connection
+	var remote string
+	ctx = withRemoteAddr(ctx, &remote)
+	// firstByte ends up holding when the final hop's response began
+	var firstByte time.Time
+	ctx = withFirstByte(ctx, &firstByte)
+	resp, err := get(ctx, client, method, target, header, payload)
+	if err != nil {
+		result.Error = err
+		return result
 	}
 
 	// Check if the response is a redirect
-	for resp.StatusCode == 301 || resp.StatusCode == 302 {
-		result.Redirects = append(result.Redirects, resp.Header.Get("Location"))
-		resp, err = http.Get(resp.Header.Get("Location"))
+	for site.followsRedirects() && isRedirect(resp.StatusCode) {
+		location := resp.Header.Get("Location")
+		resp.Body.Close()
+
+		// Resolving an empty Location would just request the same URL again
+		if location == "" {
+			result.StatusCode = resp.StatusCode
+			result.Error = fmt.Errorf("%d redirect without Location header", resp.StatusCode)
+			return result
+		}
+		if len(location) > maxFollowedLocation {
+			result.StatusCode = resp.StatusCode
+			result.Redirects = append(result.Redirects, clipLocation(location))
+			result.Error = fmt.Errorf("%d redirect with a %d-byte Location header, not following", resp.StatusCode, len(location))
+			return result
+		}
+
+		// Location may be relative to the URL that was just requested
+		next, err := resp.Request.URL.Parse(location)
 		if err != nil {
+			result.Redirects = append(result.Redirects, clipLocation(location))
 			result.Error = err
-			results <- result
-			return
+			return result
+		}
+		result.Redirects = append(result.Redirects, clipLocation(next.String()))
+		// The Host override names the site's own server, not a redirect target's
+		if next.Host != resp.Request.URL.Host {
+			header.Del("Host")
+		}
+
+		if len(result.Redirects) > maxRedirects {
+			result.Error = fmt.Errorf("stopped after %d redirects", maxRedirects)
+			return result
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			result.Error = err
+			return result
+		}
+		// Like browsers, only 307 and 308 repeat the method and body
+		if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect && method != http.MethodHead {
+			method, payload = http.MethodGet, nil
+		}
+		finalStart = time.Now()
+		resp, err = get(ctx, client, method, next.String(), header, payload)
+		if err != nil {
+			result.Error = err
+			return result
 		}
 	}
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Without following, report where the redirect would have gone
+	if isRedirect(resp.StatusCode) {
+		result.Location = clipLocation(resp.Header.Get("Location"))
+	}
+	if *captureHeaders {
+		result.Headers = resp.Header
+	}
+
+	// Count the body as it streams in, copying it to disk for -save-bodies
+	var sink io.Writer = io.Discard
+	var saved *bodyFile
+	if *saveBodies != "" && method != http.MethodHead {
+		saved = &bodyFile{path: bodyPath(*saveBodies, site.URL)}
+		defer saved.Close()
+		sink = saved
+	}
+	// Only keep the body in memory when an assertion needs to search it
+	var body bytes.Buffer
+	if site.Assert != nil && site.Assert.needsBody() {
+		sink = io.MultiWriter(sink, &body)
+	}
+	n, err := io.Copy(sink, resp.Body)
+	// A body cut short of its Content-Length is still measured, and shown
+	// as a mismatch rather than failing the fetch
+	if errors.Is(err, io.ErrUnexpectedEOF) && resp.ContentLength > n {
+		err = nil
+	}
+	if saved != nil && saved.file != nil {
+		result.BodyFile = saved.path
+	}
 	if err != nil {
 		result.Error = err
-		results <- result
-		return
+		return result
+	}
+
+	result.Duration = time.Since(start)
+	result.RedirectTime = finalStart.Sub(start)
+	result.FinalTime = result.Duration - result.RedirectTime
+	if firstByte.After(finalStart) {
+		result.TTFB = firstByte.Sub(finalStart)
 	}
 
-	bodySize := len(body)
+	bodySize := int(n)
 	result.StatusCode = resp.StatusCode
+	result.Proto = resp.Proto
+	result.TransferEncoding = resp.TransferEncoding
+	result.IPVersion = ipVersion(remote)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		result.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	result.ClientErrorWarning = resp.StatusCode >= 400 && resp.StatusCode < 500 && site.warnsOn4xx()
 	result.BodyLength = bodySize
 	result.BodySize = float64(bodySize) / 1024 / 1024
+	// Chunked and transparently decompressed bodies have no length to
+	// compare, and neither do responses that never carry a body
+	if method != http.MethodHead && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		result.ContentLength = max(resp.ContentLength, 0)
+	}
 
-	results <- result
+	// Tiny bodies finish too quickly to say anything about bandwidth
+	if bodySize >= minThroughputBytes && result.Duration > 0 {
+		result.Throughput = result.BodySize / result.Duration.Seconds()
+	}
+
+	if site.Assert != nil {
+		ok, failure := site.Assert.check(resp.StatusCode, body.Bytes())
+		result.CheckOK, result.CheckFailure = &ok, failure
+	}
+
+	// Validators only make sense for GET, which is what gets re-requested
+	if *conditional && method == http.MethodGet {
+		result.ConditionalOK = checkConditional(ctx, client, resp, limiter)
+	}
+
+	return result
+}
+
+// get issues a request for url bound to ctx, sending header and body
+func get(ctx context.Context, client *http.Client, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(withConnectionSpans(ctx), method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	// net/http ignores a Host header field; the override goes on req.Host
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+	return client.Do(req)
+}
+
+// fetchNotes lists the remarks shown in the Notes column for a fetch
+func fetchNotes(result FetchResult) []string {
+	var notes []string
+	if showURLInNotes(result.Name) {
+		notes = append(notes, truncateString(result.URL, 22))
+	}
+	if result.CheckFailure != "" {
+		notes = append(notes, result.CheckFailure)
+	}
+	if result.SLABreach {
+		notes = append(notes, "SLA breach")
+	}
+	if result.Attempts > 1 {
+		notes = append(notes, fmt.Sprintf("%d attempts", result.Attempts))
+	}
+	if result.RetryAfterWaited > 0 {
+		notes = append(notes, "Retry-After "+result.RetryAfterWaited.Round(time.Second).String())
+	}
+	if highServerLatency(result) {
+		notes = append(notes, "high server latency")
+	}
+	if missedHTTP3(result) {
+		notes = append(notes, "no HTTP/3")
+	}
+	if lengthMismatch(result) {
+		notes = append(notes, fmt.Sprintf("body %d of %d B", result.BodyLength, result.ContentLength))
+	}
+	if result.Downgrade {
+		notes = append(notes, "DOWNGRADE")
+	}
+	if result.FinalHostMismatch != "" {
+		notes = append(notes, "ended on "+truncateString(result.FinalHostMismatch, 20))
+	}
+	if result.CrossDomain {
+		notes = append(notes, "other domain")
+	}
+	if len(result.Redirects) > 0 {
+		notes = append(notes, redirectNote(result.Redirects))
+	} else if result.Location != "" {
+		notes = append(notes, "→ "+truncateString(result.Location, 19))
+	}
+	if *conditional {
+		switch {
+		case result.ConditionalOK == nil:
+			notes = append(notes, "no validators")
+		case *result.ConditionalOK:
+			notes = append(notes, "304 OK")
+		default:
+			notes = append(notes, "no 304")
+		}
+	}
+	return notes
+}
+
+// checkConditional repeats the request that produced resp with its ETag and
+// Last-Modified validators and reports whether the server answered 304. It
+// returns nil when the response carried no validators to test.
+func checkConditional(ctx context.Context, client *http.Client, resp *http.Response, limiter *rate.Limiter) *bool {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+
+	ok := false
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resp.Request.URL.String(), nil)
+	if err != nil {
+		return &ok
+	}
+	req.Header = resp.Request.Header.Clone()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return &ok
+	}
+	conditionalResp, err := client.Do(req)
+	if err != nil {
+		return &ok
+	}
+	conditionalResp.Body.Close()
+
+	ok = conditionalResp.StatusCode == http.StatusNotModified
+	return &ok
+}
+
+// lengthMismatch reports whether a fetch received a different number of
+// bytes than its Content-Length promised, i.e. the body was truncated
+func lengthMismatch(result FetchResult) bool {
+	return result.Error == nil && result.ContentLength > 0 && int64(result.BodyLength) != result.ContentLength
+}
+
+// redirectNote summarises a followed redirect chain for the notes: its
+// length, or under -redirect-notes verbose the host it ended on
+func redirectNote(redirects []string) string {
+	if *redirectNotes == "verbose" {
+		if u, err := url.Parse(redirects[len(redirects)-1]); err == nil && u.Hostname() != "" {
+			return fmt.Sprintf("→ %s (%d %s)", truncateString(u.Hostname(), 19), len(redirects), plural(len(redirects), "hop"))
+		}
+	}
+	return fmt.Sprintf("%d %s", len(redirects), plural(len(redirects), "redirect"))
+}
+
+// plural returns noun, with an s unless n is 1
+func plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// isRedirect reports whether an HTTP status code carries a Location to follow
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// formatAgo describes how long ago t was, to the second
+func formatAgo(t time.Time) string {
+	ago := time.Since(t).Round(time.Second)
+	if ago < time.Second {
+		return "just now"
+	}
+	return ago.String() + " ago"
+}
+
+// isStale reports whether a result is older than the watch interval
+func isStale(checkedAt time.Time) bool {
+	return *watch > 0 && time.Since(checkedAt) > *watch
 }
 
 // Helper function to format duration in a consistent way
 func formatDuration(d time.Duration) string {
 	// Convert everything to milliseconds for consistency
-	ms := d.Milliseconds()
-	return fmt.Sprintf("%.2f ms", float64(ms))
+	ms := float64(d) / float64(time.Millisecond)
+	return fmt.Sprintf("%.*f ms", *decimals, ms)
+}
+
+// Helper function to format a size in MB with the configured precision
+func formatSize(mb float64) string {
+	return fmt.Sprintf("%.*f", *decimals, mb)
 }
@@ -0,0 +1,1197 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// setFlag sets a flag variable for the rest of the test
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	t.Helper()
+	old := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = old })
+}
+
+// newTestServer serves the fixtures the fetch tests share
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/hop1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop2", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/hop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(2*1024*1024))
+		w.Write([]byte(strings.Repeat("x", 2*1024*1024)))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fetchTest fetches path from server through the same client main uses
+func fetchTest(t *testing.T, server *httptest.Server, site Website) FetchResult {
+	t.Helper()
+	site.URL = server.URL + site.URL
+	return fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+}
+
+func TestFetchDataStatus(t *testing.T) {
+	server := newTestServer(t)
+	tests := []struct {
+		path       string
+		status     int
+		bodyLength int
+		failed     bool
+	}{
+		{"/ok", http.StatusOK, 5, false},
+		{"/missing", http.StatusNotFound, len("404 page not found\n"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result := fetchTest(t, server, Website{URL: tt.path})
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", result.StatusCode, tt.status)
+			}
+			if result.BodyLength != tt.bodyLength {
+				t.Errorf("body length = %d, want %d", result.BodyLength, tt.bodyLength)
+			}
+			if got := fetchFailed(result); got != tt.failed {
+				t.Errorf("fetchFailed = %v, want %v", got, tt.failed)
+			}
+			if len(result.Redirects) != 0 {
+				t.Errorf("redirects = %v, want none", result.Redirects)
+			}
+		})
+	}
+}
+
+func TestFetchDataRedirectChain(t *testing.T) {
+	server := newTestServer(t)
+	result := fetchTest(t, server, Website{URL: "/hop1"})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", result.StatusCode)
+	}
+	want := []string{server.URL + "/hop2", server.URL + "/ok"}
+	if strings.Join(result.Redirects, " ") != strings.Join(want, " ") {
+		t.Errorf("redirects = %v, want %v", result.Redirects, want)
+	}
+	if result.RedirectTime <= 0 || result.FinalTime <= 0 || result.RedirectTime+result.FinalTime != result.Duration {
+		t.Errorf("redirect time %v and final time %v don't split duration %v", result.RedirectTime, result.FinalTime, result.Duration)
+	}
+}
+
+func TestFetchDataRedirectLoop(t *testing.T) {
+	server := newTestServer(t)
+	result := fetchTest(t, server, Website{URL: "/loop"})
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "stopped after") {
+		t.Fatalf("error = %v, want the redirect cap to stop the loop", result.Error)
+	}
+	if len(result.Redirects) != maxRedirects+1 {
+		t.Errorf("recorded %d redirects, want %d", len(result.Redirects), maxRedirects+1)
+	}
+}
+
+func TestFetchDataTimeout(t *testing.T) {
+	server := newTestServer(t)
+	client := newFetchClient()
+	client.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	result := fetchData(context.Background(), client, Website{URL: server.URL + "/slow"}, newLimiter(0))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %v, want it cut off near the client timeout", elapsed)
+	}
+	if result.Error == nil {
+		t.Fatal("want a timeout error, got none")
+	}
+	if result.ErrorKind != ErrorKindTimeout {
+		t.Errorf("error kind = %q, want %q (%v)", result.ErrorKind, ErrorKindTimeout, result.Error)
+	}
+	if !fetchFailed(result) {
+		t.Error("a timed out fetch should count as failed")
+	}
+}
+
+func TestFetchDataBodySize(t *testing.T) {
+	server := newTestServer(t)
+	result := fetchTest(t, server, Website{URL: "/large"})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	if result.BodyLength != 2*1024*1024 {
+		t.Errorf("body length = %d, want %d", result.BodyLength, 2*1024*1024)
+	}
+	if result.BodySize != 2 {
+		t.Errorf("body size = %g MB, want 2", result.BodySize)
+	}
+	if result.ContentLength != int64(result.BodyLength) {
+		t.Errorf("content length = %d, want it to match the body", result.ContentLength)
+	}
+	if result.Throughput <= 0 {
+		t.Errorf("throughput = %g, want it measured for a body this size", result.Throughput)
+	}
+}
+
+// stubTransport answers every request itself, recording what it was asked
+type stubTransport struct {
+	requests []string
+}
+
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req.Method+" "+req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusTeapot,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("from the stub")),
+		Request:    req,
+	}, nil
+}
+
+func TestFetchDataUsesInjectedClient(t *testing.T) {
+	// Nothing listens on this host, so only the injected client can answer
+	stub := &stubTransport{}
+	client := newFetchClient()
+	client.Transport = stub
+	result := fetchData(context.Background(), client, Website{URL: "http://injected.invalid/page"}, newLimiter(0))
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	if result.StatusCode != http.StatusTeapot || result.BodyLength != len("from the stub") {
+		t.Errorf("status %d with a %d-byte body, want the stub's 418 and body", result.StatusCode, result.BodyLength)
+	}
+	if want := []string{"GET http://injected.invalid/page"}; !slices.Equal(stub.requests, want) {
+		t.Errorf("client was asked for %q, want %q", stub.requests, want)
+	}
+}
+
+func TestNewFetchClientPoolLimits(t *testing.T) {
+	setFlag(t, maxIdleConns, 7)
+	setFlag(t, maxIdleConnsPerHost, 3)
+	setFlag(t, maxConnsPerHost, 5)
+	for _, h3 := range []bool{false, true} {
+		setFlag(t, useHTTP3, h3)
+		client := newFetchClient()
+		transport, ok := client.Transport.(*http.Transport)
+		if h3 {
+			transport = client.Transport.(*http3Transport).fallback
+			ok = true
+		}
+		if !ok {
+			t.Fatalf("-http3=%v: transport is %T", h3, client.Transport)
+		}
+		if transport.MaxIdleConns != 7 || transport.MaxIdleConnsPerHost != 3 || transport.MaxConnsPerHost != 5 {
+			t.Errorf("-http3=%v: limits are %d/%d/%d, want 7/3/5", h3, transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+		}
+	}
+}
+
+func TestFetchDataHostHeader(t *testing.T) {
+	// hosts records the Host each server saw, in request order
+	var mu sync.Mutex
+	var hosts []string
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hosts = append(hosts, r.Host)
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.Write([]byte("elsewhere"))
+	}))
+	t.Cleanup(other.Close)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/local", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.Redirect(w, r, other.URL+"/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	otherHost := strings.TrimPrefix(other.URL, "http://")
+
+	tests := []struct {
+		name   string
+		site   Website
+		global string
+		want   []string
+	}{
+		{"host_header", Website{URL: "/ok", HostHeader: "vhost.example"}, "", []string{"vhost.example"}},
+		{"-host-header", Website{URL: "/ok"}, "global.example", []string{"global.example"}},
+		{"host_header beats -host-header", Website{URL: "/ok", HostHeader: "vhost.example"}, "global.example", []string{"vhost.example"}},
+		{"kept on a same-host redirect", Website{URL: "/local", HostHeader: "vhost.example"}, "", []string{"vhost.example", "vhost.example"}},
+		{"dropped on a cross-host redirect", Website{URL: "/away", HostHeader: "vhost.example"}, "", []string{"vhost.example", otherHost}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, hostHeader, tt.global)
+			hosts = nil
+			result := fetchTest(t, server, tt.site)
+			if result.Error != nil || result.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, error %v", result.StatusCode, result.Error)
+			}
+			if !slices.Equal(hosts, tt.want) {
+				t.Errorf("servers saw Host %q, want %q", hosts, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchDataNoFollow(t *testing.T) {
+	server := newTestServer(t)
+	follow := false
+	tests := []struct {
+		name   string
+		site   Website
+		global bool
+	}{
+		{"follow_redirects: false", Website{URL: "/hop1", FollowRedirects: &follow}, false},
+		{"-no-follow", Website{URL: "/hop1"}, true},
+	}
+	columns, err := selectFetchColumns("url,status,size,notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, noFollow, tt.global)
+			result := fetchTest(t, server, tt.site)
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.StatusCode != http.StatusMovedPermanently || result.Location != "/hop2" {
+				t.Errorf("got %d to %q, want the raw 301 to /hop2", result.StatusCode, result.Location)
+			}
+			if len(result.Redirects) != 0 {
+				t.Errorf("followed %v", result.Redirects)
+			}
+
+			row := renderFetchRow(columns, result)
+			if strings.Contains(row, "\n") {
+				t.Errorf("row wraps:\n%s", row)
+			}
+			for _, want := range []string{" 301 (Redirect) ", "→ /hop2"} {
+				if !strings.Contains(row, want) {
+					t.Errorf("row lacks %q:\n%s", want, row)
+				}
+			}
+		})
+	}
+}
+
+func TestSelftestFixtures(t *testing.T) {
+	server := newSelftestServer()
+	t.Cleanup(server.Close)
+	setFlag(t, watchdog, false)
+
+	cases := selftestCases(server.URL)
+	results := fetchSelftest(cases)
+	if *watchdog {
+		t.Error("fetchSelftest left -watchdog on")
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, ok := results[c.name]
+			if !ok {
+				t.Fatal("no result")
+			}
+			if err := c.check(result); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRunSelftest(t *testing.T) {
+	setFlag(t, watchdog, false)
+	var out strings.Builder
+	if !runSelftest(&out) {
+		t.Errorf("self-test failed:\n%s", out.String())
+	}
+	if *watchdog {
+		t.Error("runSelftest left -watchdog on")
+	}
+	if got := strings.Count(out.String(), "PASS"); got != len(selftestCases("")) {
+		t.Errorf("%d cases passed, want %d:\n%s", got, len(selftestCases("")), out.String())
+	}
+}
+
+func TestPingHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://127.0.0.1/", "127.0.0.1"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"https://192.168.1.1:8443/status", "192.168.1.1"},
+		{"http://[::1]/", "::1"},
+		{"http://[::1]:8080/health", "::1"},
+		{"[::1]", "::1"},
+		{"https://www.example.com/", "example.com"},
+		{"www.example.com", "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := pingHost(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("pingHost(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+	if _, err := pingHost("http:///path"); err == nil {
+		t.Error("a URL without a host should be an error")
+	}
+}
+
+func TestPingSiteIPLiteral(t *testing.T) {
+	// A cancelled context stops the ping after the pinger has taken the
+	// host but before any packet goes out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct{ url, host string }{
+		{"http://127.0.0.1/", "127.0.0.1"},
+		{"http://[::1]/", "::1"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			result := pingSite(ctx, Website{URL: tt.url}, newLimiter(0))
+			if result.Domain != tt.host {
+				t.Errorf("pinged %q, want %q unchanged", result.Domain, tt.host)
+			}
+			if !errors.Is(result.Error, context.Canceled) {
+				t.Errorf("error = %v, want the pinger to accept %s and stop at the cancelled context", result.Error, tt.host)
+			}
+		})
+	}
+}
+
+func TestFetchDataConditional(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/last-modified", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", modified, strings.NewReader("hello"))
+	})
+	mux.HandleFunc("/ignores", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ok, notOK := true, false
+	tests := []struct {
+		path string
+		want *bool
+		note string
+	}{
+		{"/etag", &ok, "304 OK"},
+		{"/last-modified", &ok, "304 OK"},
+		{"/ignores", &notOK, "no 304"},
+		{"/plain", nil, "no validators"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			setFlag(t, conditional, true)
+			result := fetchTest(t, server, Website{URL: tt.path})
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.StatusCode != http.StatusOK || result.BodyLength != 5 {
+				t.Errorf("got %d with %d bytes, want the first GET's 200 and body", result.StatusCode, result.BodyLength)
+			}
+			switch {
+			case tt.want == nil && result.ConditionalOK != nil:
+				t.Errorf("ConditionalOK = %v, want nil", *result.ConditionalOK)
+			case tt.want != nil && (result.ConditionalOK == nil || *result.ConditionalOK != *tt.want):
+				t.Errorf("ConditionalOK = %v, want %v", result.ConditionalOK, *tt.want)
+			}
+			if notes := strings.Join(fetchNotes(result), ", "); !strings.Contains(notes, tt.note) {
+				t.Errorf("notes %q lack %q", notes, tt.note)
+			}
+		})
+	}
+
+	t.Run("off", func(t *testing.T) {
+		setFlag(t, conditional, false)
+		result := fetchTest(t, server, Website{URL: "/etag"})
+		if result.ConditionalOK != nil {
+			t.Errorf("ConditionalOK = %v without -conditional", *result.ConditionalOK)
+		}
+	})
+}
+
+func TestLoadWebsitesText(t *testing.T) {
+	fixture := "# services to watch\n" +
+		"\n" +
+		"https://example.com/\n" +
+		"   # indented comment\n" +
+		"  http://localhost:8080/health  \r\n" +
+		"\t\n" +
+		"example.org\n"
+	want := []Website{
+		{Name: "example.com", URL: "https://example.com/"},
+		{Name: "localhost:8080", URL: "http://localhost:8080/health"},
+		{Name: "example.org", URL: "example.org"},
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name, file, format string
+	}{
+		{"txt extension", "websites.txt", ""},
+		{"upper-case extension", "WEBSITES.TXT", ""},
+		{"-format txt", "websites.list", "txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(fixture), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			setFlag(t, configPath, path)
+			setFlag(t, format, tt.format)
+			if got := configFormat(); got != "txt" {
+				t.Fatalf("configFormat() = %q, want txt", got)
+			}
+			got := loadWebsitesFile().Websites
+			if len(got) != len(want) {
+				t.Fatalf("loaded %d websites, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range want {
+				if got[i].Name != want[i].Name || got[i].URL != want[i].URL {
+					t.Errorf("website %d = %q %q, want %q %q", i, got[i].Name, got[i].URL, want[i].Name, want[i].URL)
+				}
+			}
+		})
+	}
+
+	t.Run("yaml by default", func(t *testing.T) {
+		setFlag(t, configPath, filepath.Join(dir, "websites.yaml"))
+		setFlag(t, format, "")
+		if got := configFormat(); got != "yaml" {
+			t.Errorf("configFormat() = %q, want yaml", got)
+		}
+	})
+}
+
+func TestFetchDataAcceptHeaders(t *testing.T) {
+	type seen struct{ accept, language []string }
+	requests := make(chan seen, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{r.Header.Values("Accept"), r.Header.Values("Accept-Language")}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name                 string
+		flagAccept, flagLang string
+		site                 Website
+		accept, language     string
+	}{
+		{"unset", "", "", Website{}, "", ""},
+		{"flags", "application/json", "fr-FR", Website{}, "application/json", "fr-FR"},
+		{"site only", "", "", Website{Accept: "text/html", AcceptLanguage: "de"}, "text/html", "de"},
+		{"site overrides flags", "application/json", "fr-FR", Website{Accept: "text/html"}, "text/html", "fr-FR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, accept, tt.flagAccept)
+			setFlag(t, acceptLanguage, tt.flagLang)
+			tt.site.URL = server.URL
+			if result := fetchData(context.Background(), newFetchClient(), tt.site, newLimiter(0)); result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			got := <-requests
+			if strings.Join(got.accept, ",") != tt.accept {
+				t.Errorf("Accept = %q, want %q", got.accept, tt.accept)
+			}
+			if strings.Join(got.language, ",") != tt.language {
+				t.Errorf("Accept-Language = %q, want %q", got.language, tt.language)
+			}
+		})
+	}
+}
+
+func TestFetchDataSLA(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("slow but fine"))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		flag    time.Duration
+		maxTime time.Duration
+		breach  bool
+	}{
+		{"no SLA", 0, 0, false},
+		{"-max-fetch-time breached", 50 * time.Millisecond, 0, true},
+		{"-max-fetch-time met", 5 * time.Second, 0, false},
+		{"max_time breached", 0, 50 * time.Millisecond, true},
+		{"max_time overrides the flag", 50 * time.Millisecond, 5 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, maxFetchTime, tt.flag)
+			result := fetchData(context.Background(), newFetchClient(), Website{URL: server.URL, MaxTime: tt.maxTime}, newLimiter(0))
+			if result.Error != nil || result.StatusCode != http.StatusOK {
+				t.Fatalf("got %d, %v, want a plain 200", result.StatusCode, result.Error)
+			}
+			if result.SLABreach != tt.breach {
+				t.Errorf("SLABreach = %v after %v, want %v", result.SLABreach, result.Duration, tt.breach)
+			}
+			if got := fetchFailed(result); got != tt.breach {
+				t.Errorf("fetchFailed = %v, want %v", got, tt.breach)
+			}
+			if got := runFailed(RunResult{Fetches: []FetchResult{result}}); got != tt.breach {
+				t.Errorf("runFailed = %v, want -fail-on-error to follow the breach", got)
+			}
+			notes := fetchNotes(result)
+			if got := slices.Contains(notes, "SLA breach"); got != tt.breach {
+				t.Errorf("notes %q, want the SLA breach note %v", notes, tt.breach)
+			}
+			if tt.breach && notesStyle(result).GetForeground() != errorStyle.GetForeground() {
+				t.Error("an SLA breach should be noted in errorStyle")
+			}
+		})
+	}
+}
+
+func TestTruncateStringWidth(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"ascii fits", "example.com", 11, "example.com"},
+		{"ascii cut", "example.com/long", 10, "example..."},
+		{"CJK fits", "例え.jp", 7, "例え.jp"},
+		{"CJK cut", "日本語のサイト.jp", 9, "日本語..."},
+		{"CJK cut mid-character", "日本語のサイト.jp", 8, "日本..."},
+		{"combining marks fit", "cafe\u0301.example", 12, "cafe\u0301.example"},
+		{"combining marks cut", "cafe\u0301.example/menu", 10, "cafe\u0301.ex..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateString(tt.in, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("truncateString(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+			}
+			if width := runewidth.StringWidth(got); width > tt.maxLen {
+				t.Errorf("%q is %d cells wide, over %d", got, width, tt.maxLen)
+			}
+		})
+	}
+}
+
+// goexitTransport ends the fetching goroutine for one host without a
+// response, an error or a panic
+type goexitTransport struct {
+	host string
+	next http.RoundTripper
+}
+
+func (t goexitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		runtime.Goexit()
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestFetchAllReportsMissingResults(t *testing.T) {
+	server := newTestServer(t)
+	for _, groups := range []bool{false, true} {
+		t.Run(fmt.Sprintf("-host-groups=%v", groups), func(t *testing.T) {
+			setFlag(t, hostGroups, groups)
+			client := newFetchClient()
+			client.Transport = goexitTransport{host: "silent.test", next: client.Transport}
+			sites := []Website{
+				{Name: "ok", URL: server.URL + "/ok", Tags: []string{"a"}},
+				{Name: "silent", URL: "http://silent.test/", Tags: []string{"b"}},
+				{Name: "missing", URL: server.URL + "/missing"},
+			}
+
+			done := make(chan []FetchResult)
+			go func() {
+				results, _ := fetchAll(context.Background(), sites, client, newLimiter(0), &abortCounter{})
+				done <- results
+			}()
+			var results []FetchResult
+			select {
+			case results = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("fetchAll hung on the silent worker")
+			}
+
+			if len(results) != len(sites) {
+				t.Fatalf("got %d results, want one per site: %+v", len(results), results)
+			}
+			for _, result := range results {
+				wantErr := result.Name == "silent"
+				if got := errors.Is(result.Error, errNoResult); got != wantErr {
+					t.Errorf("%s: error = %v, want errNoResult %v", result.Name, result.Error, wantErr)
+				}
+				if wantErr && (result.URL != "http://silent.test/" || !slices.Equal(result.Tags, []string{"b"}) || !fetchFailed(result)) {
+					t.Errorf("the synthetic result %+v lost its site or doesn't count as failed", result)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchDataRedirectWithoutLocation(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bare/{status}", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		status, _ := strconv.Atoi(r.PathValue("status"))
+		w.WriteHeader(status)
+	})
+	mux.HandleFunc("/hop", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Redirect(w, r, "/bare/302", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path      string
+		status    int
+		redirects int
+		requests  int
+	}{
+		{"/bare/301", 301, 0, 1},
+		{"/bare/302", 302, 0, 1},
+		{"/bare/303", 303, 0, 1},
+		{"/bare/307", 307, 0, 1},
+		{"/bare/308", 308, 0, 1},
+		{"/hop", 302, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			requests.Store(0)
+			result := fetchTest(t, server, Website{URL: tt.path, Retry: &RetryPolicy{Attempts: 1}})
+			want := fmt.Sprintf("%d redirect without Location header", tt.status)
+			if result.Error == nil || result.Error.Error() != want {
+				t.Errorf("error = %v, want %q", result.Error, want)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d recorded", result.StatusCode, tt.status)
+			}
+			if len(result.Redirects) != tt.redirects {
+				t.Errorf("redirects = %v, want %d", result.Redirects, tt.redirects)
+			}
+			if got := int(requests.Load()); got != tt.requests {
+				t.Errorf("server saw %d requests, want %d", got, tt.requests)
+			}
+			if !fetchFailed(result) {
+				t.Error("a redirect without Location should count as failed")
+			}
+		})
+	}
+
+	t.Run("not followed", func(t *testing.T) {
+		follow := false
+		result := fetchTest(t, server, Website{URL: "/bare/302", FollowRedirects: &follow})
+		if result.Error != nil || result.StatusCode != 302 || result.Location != "" {
+			t.Errorf("got %d to %q, %v, want the bare 302 reported as is", result.StatusCode, result.Location, result.Error)
+		}
+	})
+}
+
+func TestDisabledSitesAreSkipped(t *testing.T) {
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var fetched, pinged []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	fakePinger(t, func(ip string) error {
+		mu.Lock()
+		pinged = append(pinged, ip)
+		mu.Unlock()
+		return nil
+	})
+
+	config := fmt.Sprintf(`websites:
+  - name: default
+    url: http://127.0.0.1:%[1]s/default
+  - name: enabled
+    url: http://127.0.0.2:%[1]s/enabled
+    enabled: true
+  - name: off
+    url: http://127.0.0.3:%[1]s/off
+    enabled: false
+`, port)
+	path := filepath.Join(t.TempDir(), "websites.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, configPath, path)
+	setFlag(t, quiet, true)
+
+	for _, show := range []bool{false, true} {
+		t.Run(fmt.Sprintf("-show-disabled=%v", show), func(t *testing.T) {
+			setFlag(t, showDisabled, show)
+			fetched, pinged = nil, nil
+			urls, disabled := splitEnabled(loadWebsitesFile().Websites)
+			if len(urls) != 2 || len(disabled) != 1 || disabled[0].Name != "off" {
+				t.Fatalf("split into %d enabled and %+v disabled, want the off site set aside", len(urls), disabled)
+			}
+
+			run := runChecks(context.Background(), urls, shownDisabled(disabled), newLimiter(0), newLimiter(0))
+			slices.Sort(fetched)
+			slices.Sort(pinged)
+			if !slices.Equal(fetched, []string{"/default", "/enabled"}) {
+				t.Errorf("fetched %v, want the disabled site left out", fetched)
+			}
+			if !slices.Equal(pinged, []string{"127.0.0.1", "127.0.0.2"}) {
+				t.Errorf("pinged %v, want the disabled site left out", pinged)
+			}
+			for _, result := range run.Pings {
+				if result.Name == "off" {
+					t.Error("the disabled site has a ping result")
+				}
+			}
+			for _, result := range run.Fetches {
+				if result.Name == "off" {
+					t.Error("the disabled site has a fetch result")
+				}
+			}
+
+			var out strings.Builder
+			renderRun(&out, run)
+			var row string
+			for line := range strings.Lines(out.String()) {
+				if strings.Contains(line, "off") && strings.Contains(line, "disabled") {
+					row = line
+				}
+			}
+			if show != (row != "") {
+				t.Errorf("disabled row shown %v, want %v:\n%s", row != "", show, out.String())
+			}
+		})
+	}
+}
+
+func TestFetchDataContentLengthMismatch(t *testing.T) {
+	body := strings.Repeat("x", 40)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		// Promise 100 bytes, send 40 and hang up
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n%s", body)
+		buf.Flush()
+	})
+	mux.HandleFunc("/honest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "40")
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body[:20]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[20:]))
+	})
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write([]byte(body))
+		zw.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		w.Write(compressed.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path          string
+		contentLength int64
+		mismatch      bool
+	}{
+		{"/short", 100, true},
+		{"/honest", 40, false},
+		{"/chunked", 0, false},
+		{"/gzip", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result := fetchTest(t, server, Website{URL: tt.path})
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.BodyLength != 40 || result.ContentLength != tt.contentLength {
+				t.Errorf("got %d of %d bytes, want 40 of %d", result.BodyLength, result.ContentLength, tt.contentLength)
+			}
+			if got := lengthMismatch(result); got != tt.mismatch {
+				t.Errorf("lengthMismatch = %v, want %v", got, tt.mismatch)
+			}
+			notes := fetchNotes(result)
+			if got := slices.Contains(notes, "body 40 of 100 B"); got != tt.mismatch {
+				t.Errorf("notes %q, want the mismatch noted %v", notes, tt.mismatch)
+			}
+			if tt.mismatch && notesStyle(result).GetForeground() != warningStyle.GetForeground() {
+				t.Error("a short body should be noted as a warning")
+			}
+		})
+	}
+}
+
+func TestShuffleSites(t *testing.T) {
+	sites := make([]Website, 20)
+	for i := range sites {
+		sites[i] = Website{URL: fmt.Sprintf("https://%02d.example/", i)}
+	}
+	// order shuffles a copy of sites cycles times with one shuffler, as
+	// -watch does, and returns the URLs of the last cycle
+	order := func(r *rand.Rand, cycles int) []string {
+		urls := slices.Clone(sites)
+		for range cycles {
+			shuffleSites(r, urls)
+		}
+		order := make([]string, len(urls))
+		for i, site := range urls {
+			order[i] = site.URL
+		}
+		return order
+	}
+	fileOrder := order(nil, 1)
+
+	tests := []struct {
+		name string
+		a, b []string
+		same bool
+	}{
+		{"same seed", order(newShuffler(42), 1), order(newShuffler(42), 1), true},
+		{"same seed, later cycle", order(newShuffler(42), 3), order(newShuffler(42), 3), true},
+		{"different seeds", order(newShuffler(42), 1), order(newShuffler(43), 1), false},
+		{"cycles differ", order(newShuffler(42), 1), order(newShuffler(42), 2), false},
+		{"shuffled", order(newShuffler(42), 1), fileOrder, false},
+		{"random seeds", order(newShuffler(0), 1), order(newShuffler(0), 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slices.Equal(tt.a, tt.b); got != tt.same {
+				t.Errorf("orders equal = %v, want %v:\n%v\n%v", got, tt.same, tt.a, tt.b)
+			}
+			sorted := slices.Clone(tt.a)
+			slices.Sort(sorted)
+			if !slices.Equal(sorted, fileOrder) {
+				t.Errorf("%v is not a permutation of the sites", tt.a)
+			}
+		})
+	}
+
+	if !slices.Equal(fileOrder, order(nil, 1)) {
+		t.Error("without -shuffle the sites should keep file order")
+	}
+}
+
+func TestFetchDataRedirectTiming(t *testing.T) {
+	const hopDelay, finalDelay = 60 * time.Millisecond, 150 * time.Millisecond
+	mux := http.NewServeMux()
+	// /{mode}/hop/{n} redirects down to /{mode}/final, the slow side
+	// taking its delay on every request
+	handle := func(mode string, hopWait, finalWait time.Duration) {
+		mux.HandleFunc("/"+mode+"/hop/{n}", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(hopWait)
+			n, _ := strconv.Atoi(r.PathValue("n"))
+			next := fmt.Sprintf("/%s/hop/%d", mode, n-1)
+			if n == 1 {
+				next = "/" + mode + "/final"
+			}
+			http.Redirect(w, r, next, http.StatusFound)
+		})
+		mux.HandleFunc("/"+mode+"/final", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(finalWait)
+			w.Write([]byte("done"))
+		})
+	}
+	handle("slow-hops", hopDelay, 0)
+	handle("slow-final", 0, finalDelay)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path                     string
+		hops                     int
+		minRedirect, maxRedirect time.Duration
+		minFinal, maxFinal       time.Duration
+	}{
+		{"/slow-hops/hop/3", 3, 3 * hopDelay, 3*hopDelay + finalDelay, 0, hopDelay},
+		{"/slow-final/hop/3", 3, 0, hopDelay, finalDelay, finalDelay + 3*hopDelay},
+		{"/slow-final/final", 0, 0, 0, finalDelay, finalDelay + 3*hopDelay},
+	}
+	columns, err := selectFetchColumns("redirect,final")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result := fetchTest(t, server, Website{URL: tt.path})
+			if result.Error != nil || result.StatusCode != http.StatusOK {
+				t.Fatalf("got %d, %v, want 200", result.StatusCode, result.Error)
+			}
+			if len(result.Redirects) != tt.hops {
+				t.Errorf("followed %d hops, want %d", len(result.Redirects), tt.hops)
+			}
+			if result.RedirectTime < tt.minRedirect || result.RedirectTime > tt.maxRedirect {
+				t.Errorf("redirect time %v, want %v to %v", result.RedirectTime, tt.minRedirect, tt.maxRedirect)
+			}
+			if result.FinalTime < tt.minFinal || result.FinalTime > tt.maxFinal {
+				t.Errorf("final time %v, want %v to %v", result.FinalTime, tt.minFinal, tt.maxFinal)
+			}
+			if result.RedirectTime+result.FinalTime != result.Duration {
+				t.Errorf("%v + %v doesn't add up to the duration %v", result.RedirectTime, result.FinalTime, result.Duration)
+			}
+
+			row := renderFetchRow(columns, result)
+			for _, want := range []string{formatDuration(result.RedirectTime), formatDuration(result.FinalTime)} {
+				if !strings.Contains(row, want) {
+					t.Errorf("row lacks %q:\n%s", want, row)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectNotes(t *testing.T) {
+	tests := []struct {
+		format    string
+		redirects []string
+		want      string
+	}{
+		{"compact", []string{"https://b.example/"}, "1 redirect"},
+		{"compact", []string{"https://b.example/", "https://c.example/x"}, "2 redirects"},
+		{"verbose", []string{"https://b.example/"}, "→ b.example (1 hop)"},
+		{"verbose", []string{"https://b.example/", "https://www.c.example:8443/x"}, "→ www.c.example (2 hops)"},
+		{"verbose", []string{"https://b.example/", "https://a-very-long-subdomain.example.com/"}, "→ a-very-long-subd... (2 hops)"},
+		// Without a host to name, verbose falls back to the count
+		{"verbose", []string{"/relative"}, "1 redirect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.want, func(t *testing.T) {
+			setFlag(t, redirectNotes, tt.format)
+			if got := redirectNote(tt.redirects); got != tt.want {
+				t.Errorf("redirectNote(%q) = %q, want %q", tt.redirects, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectNotesFlag(t *testing.T) {
+	server := newTestServer(t)
+	tests := []struct {
+		format string
+		want   string
+		err    bool
+	}{
+		{"compact", "2 redirects", false},
+		{"verbose", "→ 127.0.0.1 (2 hops)", false},
+		{"fancy", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			setFlag(t, redirectNotes, tt.format)
+			if err := validateFlags(); (err != nil) != tt.err {
+				t.Fatalf("validateFlags() = %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			notes := fetchNotes(fetchTest(t, server, Website{URL: "/hop1"}))
+			if !slices.Contains(notes, tt.want) {
+				t.Errorf("notes %q lack %q", notes, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchAllManyURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.Write(bytes.Repeat([]byte("x"), n))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, n := range []int{1, 50, 500} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			// Each site's body is as long as its index, and the last URL
+			// appears twice
+			sites := make([]Website, n, n+1)
+			for i := range sites {
+				sites[i] = Website{Name: strconv.Itoa(i), URL: fmt.Sprintf("%s/%d", server.URL, i)}
+			}
+			sites = append(sites, sites[n-1])
+
+			results, _ := fetchAll(context.Background(), sites, newFetchClient(), newLimiter(0), &abortCounter{})
+			if len(results) != len(sites) {
+				t.Fatalf("got %d results for %d sites", len(results), len(sites))
+			}
+			seen := make(map[string]int)
+			for _, result := range results {
+				if result.Error != nil {
+					t.Fatalf("%s: %v", result.URL, result.Error)
+				}
+				seen[result.Name]++
+				if want, _ := strconv.Atoi(result.Name); result.BodyLength != want || result.URL != fmt.Sprintf("%s/%d", server.URL, want) {
+					t.Errorf("site %s got %s with %d bytes, someone else's result", result.Name, result.URL, result.BodyLength)
+				}
+			}
+			for i := range n {
+				want := 1
+				if i == n-1 {
+					want = 2
+				}
+				if got := seen[strconv.Itoa(i)]; got != want {
+					t.Errorf("site %d has %d results, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	mux := http.NewServeMux()
+	// /trickle sends a byte every 10ms for as long as the client listens,
+	// steady enough that an idle or header timeout never fires
+	mux.HandleFunc("/trickle", func(w http.ResponseWriter, r *http.Request) {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				io.WriteString(w, "x")
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		watchdog bool
+		flag     time.Duration
+		site     Website
+		parent   time.Duration
+		stalled  bool
+	}{
+		{"trickle", true, 100 * time.Millisecond, Website{URL: server.URL + "/trickle"}, 0, true},
+		{"site max_time", true, 0, Website{URL: server.URL + "/trickle", MaxTime: 100 * time.Millisecond}, 0, true},
+		{"fast", true, 100 * time.Millisecond, Website{URL: server.URL + "/fast"}, 0, false},
+		{"watchdog off", false, 100 * time.Millisecond, Website{URL: server.URL + "/trickle"}, 300 * time.Millisecond, false},
+		{"no limit", true, 0, Website{URL: server.URL + "/trickle"}, 300 * time.Millisecond, false},
+		{"run cancelled first", true, time.Second, Website{URL: server.URL + "/trickle"}, 100 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, watchdog, tt.watchdog)
+			setFlag(t, maxFetchTime, tt.flag)
+			ctx := context.Background()
+			if tt.parent > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.parent)
+				defer cancel()
+			}
+
+			start := time.Now()
+			result := fetchData(ctx, newFetchClient(), tt.site, newLimiter(0))
+			elapsed := time.Since(start)
+
+			stalled := result.Error != nil && strings.Contains(result.Error.Error(), "stalled after")
+			if stalled != tt.stalled {
+				t.Fatalf("got error %v, want stalled %v", result.Error, tt.stalled)
+			}
+			if !stalled && strings.HasSuffix(tt.site.URL, "/fast") && result.Error != nil {
+				t.Fatalf("fast fetch failed: %v", result.Error)
+			}
+			if strings.HasSuffix(tt.site.URL, "/trickle") && result.Error == nil {
+				t.Fatal("endless body reported as a success")
+			}
+			if limit := tt.site.maxFetchTime(); stalled && elapsed > limit+time.Second {
+				t.Errorf("stalled fetch took %s to give up, limit %s", elapsed, limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// out receives the rendered dashboard, line output and diffs: stdout, or
+// the -out file
+var out io.Writer = os.Stdout
+
+// openOutput points out at a new file at path. Files get plain text, so
+// colours are turned off; spinners move to stderr (see spinnerOut).
+func openOutput(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	out = file
+	lipgloss.SetColorProfile(termenv.Ascii)
+	return file, nil
+}
+
+// spinnerOut is where progress spinners are drawn, keeping them out of an
+// -out file
+func spinnerOut() *os.File {
+	if *outPath != "" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
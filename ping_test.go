@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	probing "github.com/prometheus-community/pro-bing"
+)
+
+// fakePinger replaces the network with behave, which is called with each
+// address pinged
+func fakePinger(t *testing.T, behave func(ip string) error) {
+	t.Helper()
+	setFlag(t, &runPinger, func(p *probing.Pinger, ctx context.Context) error {
+		return behave(p.IPAddr().IP.String())
+	})
+}
+
+func TestPingAllRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic func()
+		want  string
+	}{
+		{"string", func() { panic("socket gone") }, "pinger panicked: socket gone"},
+		{"error", func() { panic(errors.New("permission revoked")) }, "pinger panicked: permission revoked"},
+		{"nil map", func() {
+			var m map[string]int
+			m["x"]++
+		}, "pinger panicked: assignment to entry in nil map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePinger(t, func(ip string) error {
+				if ip == "127.0.0.2" {
+					tt.panic()
+				}
+				return nil
+			})
+			sites := []Website{
+				{Name: "a", URL: "http://127.0.0.1/"},
+				{Name: "bad", URL: "http://127.0.0.2/"},
+				{Name: "c", URL: "http://127.0.0.3/"},
+			}
+
+			done := make(chan []PingResult)
+			go func() {
+				results, _ := pingAll(context.Background(), sites, newLimiter(0), &abortCounter{})
+				done <- results
+			}()
+			var results []PingResult
+			select {
+			case results = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("pingAll hung on the panicking host")
+			}
+
+			if len(results) != len(sites) {
+				t.Fatalf("got %d results, want one per site: %+v", len(results), results)
+			}
+			for _, result := range results {
+				switch {
+				case result.Name == "bad":
+					if result.Error == nil || !strings.HasPrefix(result.Error.Error(), tt.want) {
+						t.Errorf("bad host's error = %v, want %q", result.Error, tt.want)
+					}
+					if result.URL != "http://127.0.0.2/" || result.CheckedAt.IsZero() {
+						t.Errorf("bad host's result lost its site: %+v", result)
+					}
+				case result.Error != nil:
+					t.Errorf("%s: unexpected error %v", result.Name, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestPingAllReportsMissingResults(t *testing.T) {
+	// Goexit ends the worker without a panic to recover or a result
+	fakePinger(t, func(ip string) error {
+		if ip == "127.0.0.2" {
+			runtime.Goexit()
+		}
+		return nil
+	})
+	sites := []Website{
+		{Name: "a", URL: "http://127.0.0.1/"},
+		{Name: "silent", URL: "http://127.0.0.2/"},
+	}
+	results, _ := pingAll(context.Background(), sites, newLimiter(0), &abortCounter{})
+	if len(results) != len(sites) {
+		t.Fatalf("got %d results, want one per site: %+v", len(results), results)
+	}
+	for _, result := range results {
+		wantErr := result.Name == "silent"
+		if got := errors.Is(result.Error, errNoResult); got != wantErr {
+			t.Errorf("%s: error = %v, want errNoResult %v", result.Name, result.Error, wantErr)
+		}
+	}
+	if results[1].URL != "http://127.0.0.2/" {
+		t.Errorf("the missing result is for %q, want the silent site", results[1].URL)
+	}
+}
+
+func TestPingAllManyURLs(t *testing.T) {
+	fakePinger(t, func(string) error { return nil })
+	sites := make([]Website, 500)
+	for i := range sites {
+		sites[i] = Website{Name: strconv.Itoa(i), URL: fmt.Sprintf("http://127.0.%d.%d/", i/250, i%250+1)}
+	}
+	results, _ := pingAll(context.Background(), sites, newLimiter(0), &abortCounter{})
+	if len(results) != len(sites) {
+		t.Fatalf("got %d results for %d sites", len(results), len(sites))
+	}
+	seen := make(map[string]bool)
+	for _, result := range results {
+		i, _ := strconv.Atoi(result.Name)
+		if seen[result.Name] {
+			t.Errorf("site %s reported twice", result.Name)
+		}
+		seen[result.Name] = true
+		if result.URL != sites[i].URL || result.IP != strings.Trim(sites[i].URL[len("http:"):], "/") {
+			t.Errorf("site %s got the result for %s at %s", result.Name, result.URL, result.IP)
+		}
+	}
+}
+
+func TestPingMaxRTT(t *testing.T) {
+	fakePinger(t, func(string) error { return nil })
+	tests := []struct {
+		name   string
+		flag   time.Duration
+		site   time.Duration
+		stats  probing.Statistics
+		breach bool
+	}{
+		{"under", 100 * time.Millisecond, 0, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 40 * time.Millisecond}, false},
+		{"at the limit", 100 * time.Millisecond, 0, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 100 * time.Millisecond}, false},
+		{"over with no loss", 100 * time.Millisecond, 0, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 250 * time.Millisecond}, true},
+		{"site max_rtt wins", 500 * time.Millisecond, 100 * time.Millisecond, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 250 * time.Millisecond}, true},
+		{"site allows more", 100 * time.Millisecond, time.Second, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 250 * time.Millisecond}, false},
+		{"no limit", 0, 0, probing.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 5 * time.Second}, false},
+		{"no replies", 100 * time.Millisecond, 0, probing.Statistics{PacketsSent: 3, PacketLoss: 100}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, maxRTT, tt.flag)
+			setFlag(t, &pingStats, func(*probing.Pinger) *probing.Statistics { return &tt.stats })
+			result := pingUrl(context.Background(), Website{URL: "http://127.0.0.1/", MaxRTT: tt.site}, newLimiter(0))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if result.AvgRtt != tt.stats.AvgRtt || result.RTTBreach != tt.breach {
+				t.Fatalf("avg %s breach %v, want %s breach %v", result.AvgRtt, result.RTTBreach, tt.stats.AvgRtt, tt.breach)
+			}
+			// A breach fails the run under -fail-on-error and is drawn and
+			// alerted on as one, loss or not
+			if tt.stats.PacketLoss == 0 && pingFailed(result) != tt.breach {
+				t.Errorf("pingFailed = %v, want %v", pingFailed(result), tt.breach)
+			}
+			if red := rttStyle(result).GetForeground() == errorStyle.GetForeground(); red != tt.breach {
+				t.Errorf("RTT cell red = %v, want %v", red, tt.breach)
+			}
+			alerts := runAlerts(RunResult{Pings: []PingResult{result}})
+			if rtt := len(alerts) == 1 && alerts[0].Kind == "rtt"; rtt != tt.breach {
+				t.Errorf("alerts %+v, want an rtt alert %v", alerts, tt.breach)
+			}
+		})
+	}
+
+	setFlag(t, maxRTT, -time.Millisecond)
+	if err := validateFlags(); err == nil {
+		t.Error("negative -max-rtt accepted")
+	}
+}
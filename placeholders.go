@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// placeholderPattern matches the ${name} placeholders allowed in URLs
+var placeholderPattern = regexp.MustCompile(`\$\{(now|uuid|rand)\}`)
+
+// expandPlaceholders replaces each placeholder in s with a fresh value:
+//
+//	${now}  the current Unix time in seconds
+//	${uuid} a random UUID
+//	${rand} a random non-negative integer
+func expandPlaceholders(s string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		switch match {
+		case "${now}":
+			return strconv.FormatInt(time.Now().Unix(), 10)
+		case "${uuid}":
+			return uuid.NewString()
+		default:
+			return strconv.FormatUint(rand.Uint64()>>1, 10)
+		}
+	})
+}
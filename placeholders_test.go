@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *regexp.Regexp
+	}{
+		{"/a?t=${now}", regexp.MustCompile(`^/a\?t=\d{10,}$`)},
+		{"/a?id=${uuid}", regexp.MustCompile(`^/a\?id=[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)},
+		{"/a?r=${rand}", regexp.MustCompile(`^/a\?r=\d+$`)},
+		{"/${now}/${rand}", regexp.MustCompile(`^/\d+/\d+$`)},
+		{"/a?x=${unknown}&y=$now", regexp.MustCompile(`^/a\?x=\$\{unknown\}&y=\$now$`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := expandPlaceholders(tt.in); !tt.want.MatchString(got) {
+				t.Errorf("expandPlaceholders(%q) = %q, want a match of %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchDataExpandsPlaceholders(t *testing.T) {
+	queries := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+	}))
+	t.Cleanup(server.Close)
+
+	site := Website{URL: server.URL + "/?t=${now}&id=${uuid}"}
+	pattern := regexp.MustCompile(`^t=(\d+)&id=([0-9a-f-]{36})$`)
+	var ids []string
+	for range 2 {
+		before := time.Now().Unix()
+		result := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+		after := time.Now().Unix()
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		if result.URL != site.URL {
+			t.Errorf("result URL = %q, want the template %q", result.URL, site.URL)
+		}
+
+		query := <-queries
+		m := pattern.FindStringSubmatch(query)
+		if m == nil {
+			t.Fatalf("server saw %q, want the placeholders expanded", query)
+		}
+		if now, _ := strconv.ParseInt(m[1], 10, 64); now < before || now > after {
+			t.Errorf("${now} = %d, want a timestamp between %d and %d", now, before, after)
+		}
+		ids = append(ids, m[2])
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("both requests sent ${uuid} %s, want it fresh per request", ids[0])
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// preflight checks that this machine is online before the real run, so
+// "everything is down" can be told apart from "we are offline". It pings
+// -preflight-ping and fetches -preflight-url, either of which may be empty
+// to skip it. A successful fetch is enough, since it needs both DNS and a
+// route; the ping only helps explain what is broken when the fetch fails.
+func preflight(ctx context.Context) error {
+	var pingErr error
+	if *preflightPing != "" {
+		result := pingSite(ctx, Website{URL: preflightPingURL(*preflightPing)}, newLimiter(0))
+		pingErr = result.Error
+		if pingErr == nil && result.PacketsRecv == 0 {
+			pingErr = fmt.Errorf("no replies from %s", *preflightPing)
+		}
+	}
+	if *preflightURL == "" {
+		if pingErr != nil {
+			return fmt.Errorf("no network connectivity: ping %s: %v", *preflightPing, pingErr)
+		}
+		return nil
+	}
+
+	result := fetch(ctx, newFetchClient(), Website{URL: *preflightURL}, newLimiter(0))
+	switch {
+	case result.Error == nil:
+		return nil
+	case result.ErrorKind == ErrorKindDNS && *preflightPing != "" && pingErr == nil:
+		return fmt.Errorf("no DNS resolution: %s answers pings but fetching %s failed: %v", *preflightPing, *preflightURL, result.Error)
+	}
+	return errors.Join(
+		fmt.Errorf("no network connectivity: fetching %s failed: %v", *preflightURL, result.Error),
+		pingErr,
+	)
+}
+
+// preflightPingURL turns the -preflight-ping host into the URL pingSite
+// takes, bracketing IPv6 literals such as ::1 so they parse as a host
+func preflightPingURL(host string) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return (&url.URL{Scheme: "http", Host: host}).String()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreflightPingURL(t *testing.T) {
+	tests := []struct {
+		host, url string
+	}{
+		{"1.1.1.1", "http://1.1.1.1"},
+		{"example.com", "http://example.com"},
+		{"::1", "http://[::1]"},
+		{"[::1]", "http://[::1]"},
+		{"2606:4700:4700::1111", "http://[2606:4700:4700::1111]"},
+	}
+	for _, tt := range tests {
+		got := preflightPingURL(tt.host)
+		if got != tt.url {
+			t.Errorf("preflightPingURL(%q) = %q, want %q", tt.host, got, tt.url)
+		}
+		// The pinger must get the address back unchanged
+		pinged, err := pingHost(got)
+		if want := strings.Trim(tt.host, "[]"); err != nil || pinged != want {
+			t.Errorf("%q pings %q (%v), want %q", tt.host, pinged, err, want)
+		}
+	}
+}
+
+func TestPreflightFetch(t *testing.T) {
+	// Pinging needs privileges tests can't count on
+	setFlag(t, preflightPing, "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	setFlag(t, preflightURL, server.URL)
+	if err := preflight(context.Background()); err != nil {
+		t.Errorf("online: preflight failed: %v", err)
+	}
+
+	server.Close()
+	err := preflight(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no network connectivity") {
+		t.Errorf("offline: got %v, want a no network connectivity error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// earlyPings renders a run's ping table while its fetches are still
+// running, for -progressive
+type earlyPings struct {
+	timer   *time.Timer
+	mu      sync.Mutex
+	stopped bool
+	shown   bool
+}
+
+// startEarlyPings renders the ping table of run once the fetch phase has
+// run for -progressive-after, unless stop is called first. It returns
+// nil without -progressive.
+func startEarlyPings(run RunResult) *earlyPings {
+	if !*progressive {
+		return nil
+	}
+	e := &earlyPings{}
+	e.timer = time.AfterFunc(*progressiveAfter, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.stopped {
+			return
+		}
+		// One write, so it can't land in the middle of a spinner frame;
+		// the spinner carries on below the table
+		var buf bytes.Buffer
+		if *outPath == "" && !*quiet && isatty.IsTerminal(os.Stdout.Fd()) {
+			buf.WriteString("\r\033[K")
+		}
+		renderPingTable(&buf, run)
+		out.Write(buf.Bytes())
+		e.shown = true
+	})
+	return e
+}
+
+// stop cancels the render if it hasn't happened and reports whether the
+// ping table was shown
+func (e *earlyPings) stop() bool {
+	if e == nil {
+		return false
+	}
+	e.timer.Stop()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	return e.shown
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is an out the early render can write to while the test reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProgressivePingTable(t *testing.T) {
+	fakePinger(t, func(string) error { return nil })
+	setFlag(t, quiet, true)
+
+	tests := []struct {
+		name     string
+		progress bool
+		after    time.Duration
+		parallel bool
+		// early is whether the ping table should be out while the fetch is
+		// still held
+		early bool
+	}{
+		{"off", false, 0, false, false},
+		{"straight away", true, 0, false, true},
+		{"after a while", true, 50 * time.Millisecond, false, true},
+		{"fetches beat the threshold", true, time.Hour, false, false},
+		{"parallel phases", true, 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, progressive, tt.progress)
+			setFlag(t, progressiveAfter, tt.after)
+			setFlag(t, parallelPhases, tt.parallel)
+			var early syncBuffer
+			setFlag[io.Writer](t, &out, &early)
+
+			// The fetch is held until the test has looked for the table
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			defer server.Close()
+			sites := []Website{{Name: "local", URL: server.URL + "/"}}
+
+			start := time.Now()
+			done := make(chan RunResult)
+			go func() { done <- runChecks(context.Background(), sites, nil, newLimiter(0), newLimiter(0)) }()
+
+			deadline := time.Now().Add(time.Second)
+			for !strings.Contains(early.String(), "Ping Results") && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			shown := strings.Contains(early.String(), "Ping Results")
+			waited := time.Since(start)
+			close(release)
+			run := <-done
+
+			if shown != tt.early {
+				t.Fatalf("ping table out before the fetch finished = %v, want %v:\n%s", shown, tt.early, early.String())
+			}
+			if shown && waited < tt.after {
+				t.Errorf("ping table out after %s, before -progressive-after %s", waited, tt.after)
+			}
+			if strings.Contains(early.String(), "HTTP Fetch Results") {
+				t.Error("the early render included the fetch table")
+			}
+			if run.pingsShown != tt.early {
+				t.Errorf("pingsShown = %v, want %v", run.pingsShown, tt.early)
+			}
+			if len(run.Fetches) != 1 || run.Fetches[0].Error != nil {
+				t.Errorf("fetches = %+v", run.Fetches)
+			}
+
+			// The final render adds the fetch table and shows the ping table
+			// exactly once across both
+			var final strings.Builder
+			renderRun(&final, run)
+			both := early.String() + final.String()
+			if n := strings.Count(both, "Ping Results"); n != 1 {
+				t.Errorf("ping table rendered %d times", n)
+			}
+			if !strings.Contains(final.String(), "HTTP Fetch Results") {
+				t.Error("final render lacks the fetch table")
+			}
+			if tt.early && strings.Index(both, "Ping Results") > strings.Index(both, "HTTP Fetch Results") {
+				t.Error("ping table came after the fetch table")
+			}
+		})
+	}
+}
+
+func TestProgressiveFlags(t *testing.T) {
+	tests := []struct {
+		output  string
+		tui     bool
+		after   time.Duration
+		wantErr bool
+	}{
+		{"table", false, 0, false},
+		{"table", false, time.Second, false},
+		{"json", false, 0, true},
+		{"table", true, 0, true},
+		{"table", false, -time.Second, true},
+	}
+	setFlag(t, progressive, true)
+	for _, tt := range tests {
+		setFlag(t, output, tt.output)
+		setFlag(t, tui, tt.tui)
+		setFlag(t, progressiveAfter, tt.after)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-output %s -tui=%v -progressive-after %s: error = %v, want error %v", tt.output, tt.tui, tt.after, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// maxStoredLocation caps how much of a Location is kept in Redirects
+	// and Location, so a huge header can't bloat the results or tables
+	maxStoredLocation = 2 << 10
+	// maxFollowedLocation is the longest Location fetch will follow;
+	// anything longer is far past what real servers accept in a URL
+	maxFollowedLocation = 16 << 10
+)
+
+// clipLocation shortens location to maxStoredLocation bytes, marking how
+// much was cut
+func clipLocation(location string) string {
+	if len(location) <= maxStoredLocation {
+		return location
+	}
+	clipped := strings.ToValidUTF8(location[:maxStoredLocation], "")
+	return fmt.Sprintf("%s…[%d bytes truncated]", clipped, len(location)-len(clipped))
+}
+
+// RedirectKind classifies a fetch's redirect chain by comparing the URL
+// that was requested with the one it ended on
+type RedirectKind string
+
+const (
+	RedirectNone        RedirectKind = "no redirect"
+	RedirectNotFollowed RedirectKind = "not followed"
+	RedirectHTTPS       RedirectKind = "http→https upgrade"
+	RedirectWWWToApex   RedirectKind = "www→apex"
+	RedirectApexToWWW   RedirectKind = "apex→www"
+	RedirectCrossHost   RedirectKind = "cross-host"
+	RedirectSameHost    RedirectKind = "same host"
+)
+
+// redirectKinds is the order kinds are listed in the summary
+var redirectKinds = []RedirectKind{
+	RedirectHTTPS, RedirectWWWToApex, RedirectApexToWWW, RedirectCrossHost,
+	RedirectSameHost, RedirectNotFollowed, RedirectNone,
+}
+
+// classifyRedirects works out the RedirectKind of a fetch. Failed fetches
+// are left unclassified.
+func classifyRedirects(result FetchResult) RedirectKind {
+	if result.Error != nil {
+		return ""
+	}
+	if len(result.Redirects) == 0 {
+		if result.Location != "" {
+			return RedirectNotFollowed
+		}
+		return RedirectNone
+	}
+
+	from, err := url.Parse(result.URL)
+	if err != nil {
+		return RedirectSameHost
+	}
+	to, err := url.Parse(result.Redirects[len(result.Redirects)-1])
+	if err != nil {
+		return RedirectSameHost
+	}
+
+	fromHost, toHost := strings.ToLower(from.Hostname()), strings.ToLower(to.Hostname())
+	switch {
+	case from.Scheme == "http" && to.Scheme == "https" &&
+		strings.TrimPrefix(fromHost, "www.") == strings.TrimPrefix(toHost, "www."):
+		return RedirectHTTPS
+	case fromHost == "www."+toHost:
+		return RedirectWWWToApex
+	case toHost == "www."+fromHost:
+		return RedirectApexToWWW
+	case fromHost != toHost:
+		return RedirectCrossHost
+	}
+	return RedirectSameHost
+}
+
+// finalScheme returns the scheme of the URL a fetch ended on
+func finalScheme(result FetchResult) string {
+	final := result.URL
+	if len(result.Redirects) > 0 {
+		final = result.Redirects[len(result.Redirects)-1]
+	}
+	u, err := url.Parse(final)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
+
+// notUpgraded reports whether a plain http:// URL failed to end on https://
+func notUpgraded(result FetchResult) bool {
+	return result.Error == nil && strings.HasPrefix(strings.ToLower(result.URL), "http://") &&
+		finalScheme(result) != "https"
+}
+
+// renderRedirectSummary prints how many fetches fell into each redirect
+// kind, followed by any http:// URLs that were not upgraded to https://
+func renderRedirectSummary(w io.Writer, results []FetchResult) {
+	counts := make(map[RedirectKind]int)
+	for _, result := range results {
+		if result.RedirectKind != "" {
+			counts[result.RedirectKind]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	summaryTitle := titleStyle.Render(" Redirect Summary ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(summaryTitle))
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(30).Render("Kind"),
+		headerStyle.Width(10).Render("Count"),
+	)}
+	for _, kind := range redirectKinds {
+		if counts[kind] == 0 {
+			continue
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(30).Render(string(kind)),
+			cellStyle.Width(10).Render(fmt.Sprintf("%d", counts[kind])),
+		))
+	}
+	fmt.Fprintln(w, tableStyle.Render(lipgloss.JoinVertical(lipgloss.Left, rows...)))
+
+	for _, result := range results {
+		if notUpgraded(result) {
+			fmt.Fprintln(w, warningStyle.Render(fmt.Sprintf(" ⚠ %s does not upgrade to https://", result.URL)))
+		}
+	}
+}
+
+// scanRedirectChain looks for hops that drop from https:// to http://, and
+// for chains that leave the registered domain of the requested URL
+func scanRedirectChain(result FetchResult) (downgrade, crossDomain bool) {
+	from, err := url.Parse(result.URL)
+	if err != nil {
+		return false, false
+	}
+	startDomain := registeredDomain(from.Hostname())
+
+	previous := from
+	for _, hop := range result.Redirects {
+		next, err := url.Parse(hop)
+		if err != nil {
+			continue
+		}
+		if previous.Scheme == "https" && next.Scheme == "http" {
+			downgrade = true
+		}
+		if registeredDomain(next.Hostname()) != startDomain {
+			crossDomain = true
+		}
+		previous = next
+	}
+	return downgrade, crossDomain
+}
+
+// registeredDomain returns the eTLD+1 of host (e.g. example.co.uk for
+// www.example.co.uk), or the host itself for IPs and unknown suffixes
+func registeredDomain(host string) string {
+	host = strings.ToLower(host)
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// finalHost returns the host a fetch ended on: the last redirect's, or
+// the site's own when it wasn't redirected
+func finalHost(result FetchResult) string {
+	last := result.URL
+	if len(result.Redirects) > 0 {
+		last = result.Redirects[len(result.Redirects)-1]
+	}
+	u, err := url.Parse(last)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// sameHost compares host with an expected one, ignoring case and, unless
+// expected names one, the port. A bare IPv6 address such as ::1 names no
+// port, with or without its brackets.
+func sameHost(host, expected string) bool {
+	if _, _, err := net.SplitHostPort(expected); err != nil {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host, expected = strings.Trim(host, "[]"), strings.Trim(expected, "[]")
+	}
+	return strings.EqualFold(host, expected)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestClipLocation(t *testing.T) {
+	long := strings.Repeat("a", 3000)
+	// A two-byte rune straddles the cut
+	straddle := strings.Repeat("a", maxStoredLocation-1) + "é" + "bbb"
+	tests := []struct {
+		name     string
+		location string
+		want     string
+	}{
+		{"short", "/next", "/next"},
+		{"at the cap", long[:maxStoredLocation], long[:maxStoredLocation]},
+		{"over the cap", long, long[:maxStoredLocation] + "…[952 bytes truncated]"},
+		{"rune at the cut", straddle, straddle[:maxStoredLocation-1] + "…[5 bytes truncated]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clipLocation(tt.location)
+			if got != tt.want {
+				t.Errorf("clipLocation = %q (%d bytes), want %q (%d bytes)", got, len(got), tt.want, len(tt.want))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("clipped to invalid UTF-8")
+			}
+		})
+	}
+}
+
+func TestFetchDataLongLocation(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/long/{size}", func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.PathValue("size"))
+		location := "/ok?pad=" + strings.Repeat("x", size-len("/ok?pad="))
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	follow := false
+	tests := []struct {
+		name     string
+		size     int
+		follow   *bool
+		status   int
+		failed   bool
+		errorHas string
+	}{
+		{"followed and clipped", 4 << 10, nil, http.StatusOK, false, ""},
+		{"too long to follow", 20 << 10, nil, http.StatusFound, true, fmt.Sprintf("302 redirect with a %d-byte Location header, not following", 20<<10)},
+		{"not followed", 20 << 10, &follow, http.StatusFound, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fetchData(t.Context(), newFetchClient(), Website{URL: fmt.Sprintf("%s/long/%d", server.URL, tt.size), FollowRedirects: tt.follow}, newLimiter(0))
+			if result.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", result.StatusCode, tt.status)
+			}
+			if got := result.Error != nil; got != tt.failed {
+				t.Fatalf("error = %v, want failed %v", result.Error, tt.failed)
+			}
+			if tt.failed && !strings.Contains(result.Error.Error(), tt.errorHas) {
+				t.Errorf("error = %v, want %q", result.Error, tt.errorHas)
+			}
+
+			stored := append([]string{result.Location}, result.Redirects...)
+			for _, location := range stored {
+				if len(location) > maxStoredLocation+len("…[99999 bytes truncated]") {
+					t.Errorf("stored a %d-byte Location", len(location))
+				}
+			}
+			if tt.follow == nil && (len(result.Redirects) != 1 || !strings.Contains(result.Redirects[0], "bytes truncated]")) {
+				t.Errorf("redirects = %d, want the one hop with its Location clipped", len(result.Redirects))
+			}
+			if tt.follow != nil && !strings.Contains(result.Location, "bytes truncated]") {
+				t.Errorf("Location of %d bytes, want it clipped", len(result.Location))
+			}
+
+			columns, err := selectFetchColumns("url,status,notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Error messages wrap within their cell, as any long error does
+			maxHeight := 1
+			if tt.failed {
+				maxHeight = 3
+			}
+			if row := renderFetchRow(columns, result); lipgloss.Height(row) > maxHeight {
+				t.Errorf("row is %d lines, want at most %d:\n%s", lipgloss.Height(row), maxHeight, row)
+			}
+		})
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		host, expected string
+		want           bool
+	}{
+		{"example.com", "example.com", true},
+		{"Example.COM", "example.com", true},
+		{"example.com:443", "example.com", true},
+		{"example.com:8443", "example.com:8443", true},
+		{"example.com:8443", "example.com:443", false},
+		{"example.com", "example.com:443", false},
+		{"www.example.com", "example.com", false},
+		{"[::1]:8080", "::1", true},
+		{"[::1]:8080", "[::1]", true},
+		{"[::1]", "::1", true},
+		{"[::1]:8080", "[::1]:8080", true},
+		{"[::1]:8080", "[::1]:9090", false},
+		{"[::2]:8080", "::1", false},
+		{"", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := sameHost(tt.host, tt.expected); got != tt.want {
+			t.Errorf("sameHost(%q, %q) = %v, want %v", tt.host, tt.expected, got, tt.want)
+		}
+	}
+}
+
+func TestFetchDataExpectFinalHost(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	// /canon sends 127.0.0.1 visitors on to the canonical localhost name,
+	// through a second hop
+	mux.HandleFunc("/canon", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/hop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		mismatch string
+	}{
+		{"redirected onto it", "/canon", "localhost", ""},
+		{"case ignored", "/canon", "LocalHost", ""},
+		{"port named", "/canon", "localhost:" + port, ""},
+		{"wrong port", "/canon", "localhost:1", "localhost:" + port},
+		{"redirected elsewhere", "/canon", "127.0.0.1", "localhost:" + port},
+		{"never redirected", "/home", "localhost", "127.0.0.1:" + port},
+		{"no expectation", "/canon", "", ""},
+		{"fetch failed", "/missing-hop", "localhost", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := Website{URL: server.URL + tt.path, ExpectFinalHost: tt.expected}
+			if tt.path == "/missing-hop" {
+				site.URL = "http://127.0.0.1:1/"
+				site.Retry = &RetryPolicy{Attempts: 1}
+			}
+			result := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if result.FinalHostMismatch != tt.mismatch {
+				t.Fatalf("FinalHostMismatch = %q, want %q (error %v)", result.FinalHostMismatch, tt.mismatch, result.Error)
+			}
+			note := slices.Contains(fetchNotes(result), "ended on "+tt.mismatch)
+			if note != (tt.mismatch != "") {
+				t.Errorf("notes %q, want the final host noted = %v", fetchNotes(result), tt.mismatch != "")
+			}
+			if tt.mismatch != "" {
+				if !fetchFailed(result) {
+					t.Error("mismatch doesn't count as a failure")
+				}
+				if notesStyle(result).GetForeground() != errorStyle.GetForeground() {
+					t.Error("mismatch notes aren't drawn as an error")
+				}
+			} else if result.Error == nil && fetchFailed(result) {
+				t.Errorf("matching fetch counts as a failure: %+v", result)
+			}
+		})
+	}
+}
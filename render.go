@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// renderRun prints the timing, ping, fetch and redirect tables for a run
+func renderRun(w io.Writer, run RunResult) {
+	allFetchResults := run.Fetches
+	pingTime, fetchTime := run.PingTime, run.FetchTime
+
+	if run.Aborted {
+		banner := errorStyle.Bold(true).Render(" ⚠ Aborted early after too many consecutive failures; results are partial ")
+		fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(banner))
+		fmt.Fprintln(w)
+	}
+	if run.Interrupted {
+		banner := warningStyle.Bold(true).Render(" ⚠ Interrupted; results are partial ")
+		fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(banner))
+		fmt.Fprintln(w)
+	}
+	if *health {
+		renderHealth(w, run)
+	}
+
+	// Display timing information
+	timingTitle := titleStyle.Render(" Timing Information ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(timingTitle))
+
+	// Properly align the timing table headers and values
+	operationHeader := headerStyle.Width(40).Render("Operation")
+	timeHeader := headerStyle.Width(40).Render("Time")
+	headerRow := lipgloss.JoinHorizontal(lipgloss.Top, operationHeader, timeHeader)
+
+	pingRow := lipgloss.JoinHorizontal(lipgloss.Top,
+		cellStyle.Width(40).Render("Ping All URLs"),
+		cellStyle.Width(40).Render(pingTime.String()),
+	)
+
+	fetchRow := lipgloss.JoinHorizontal(lipgloss.Top,
+		cellStyle.Width(40).Render("Fetch All URLs"),
+		cellStyle.Width(40).Render(fetchTime.String()),
+	)
+
+	timingRows := []string{headerRow}
+	if run.ResolveTime > 0 {
+		timingRows = append(timingRows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(40).Render("Resolve All Hosts"),
+			cellStyle.Width(40).Render(run.ResolveTime.String()),
+		))
+	}
+	timingRows = append(timingRows, pingRow, fetchRow)
+	timingTable := lipgloss.JoinVertical(lipgloss.Left, timingRows...)
+
+	fmt.Fprintln(w, tableStyle.Width(80).Render(timingTable))
+	if *parallelPhases {
+		fmt.Fprintln(w, infoStyle.Render(" Phases ran in parallel, so their timings overlap"))
+	}
+
+	if *showDNS {
+		renderDNSResolutions(w, run.Resolutions)
+	}
+	renderDNSFailures(w, run.DNSFailures)
+
+	if !run.pingsShown {
+		renderPingTable(w, run)
+	}
+
+	// Print fetch results table
+	fetchTitle := titleStyle.Render(" HTTP Fetch Results ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(fetchTitle))
+
+	// Create fetch table rows
+	spec := *columnSpec
+	if spec == "" {
+		spec = defaultFetchColumns(allFetchResults)
+	}
+	columns, _ := selectFetchColumns(spec)
+	renderFetch := func(result FetchResult) string {
+		return renderFetchRow(columns, result)
+	}
+	fetchRows := []string{renderFetchHeader(columns)}
+	if *groupByStatus {
+		for _, group := range groupByStatusClass(limitRows(allFetchResults, *topN)) {
+			label := fmt.Sprintf(" %s (%d)", group.class, len(group.results))
+			fetchRows = append(fetchRows, infoStyle.Bold(true).Render(label))
+			fetchRows = append(fetchRows, renderRows(group.results, renderFetch)...)
+		}
+	} else {
+		fetchRows = append(fetchRows, renderRows(limitRows(allFetchResults, *topN), renderFetch)...)
+	}
+	fetchWidth := -labelWidth
+	for _, column := range columns {
+		fetchWidth += column.width
+	}
+	for _, site := range run.Disabled {
+		fetchRows = append(fetchRows, renderDisabledRow(site, fetchWidth))
+	}
+
+	// Render fetch table
+	fetchTable := lipgloss.JoinVertical(lipgloss.Left, fetchRows...)
+	fmt.Fprintln(w, tableStyle.Render(fetchTable))
+	if *topN > 0 {
+		fetchErrors := 0
+		for _, result := range allFetchResults {
+			if result.Error != nil {
+				fetchErrors++
+			}
+		}
+		fmt.Fprintln(w, infoStyle.Render(tableSummary(len(limitRows(allFetchResults, *topN)), len(allFetchResults), fetchErrors)))
+	}
+
+	// Print detailed redirect information if any
+	hasRedirects := false
+	for _, result := range allFetchResults {
+		if len(result.Redirects) > 0 {
+			hasRedirects = true
+			break
+		}
+	}
+
+	if hasRedirects {
+		redirectTitle := titleStyle.Render(" Redirect Details ")
+		fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(redirectTitle))
+
+		for _, result := range allFetchResults {
+			if len(result.Redirects) > 0 {
+				fmt.Fprintln(w, infoStyle.Render(fmt.Sprintf(" → Redirects for %s (%s redirecting, %s on the final page):", result.URL, formatDuration(result.RedirectTime), formatDuration(result.FinalTime))))
+				for i, redirect := range result.Redirects {
+					fmt.Fprintln(w, cellStyle.Render(fmt.Sprintf("   %d. %s", i+1, redirect)))
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+
+	renderRedirectSummary(w, allFetchResults)
+	renderHTTPSAudit(w, run.HTTPSViolations)
+}
+
+// statusGroup is one section of the fetch table under -group-by-status
+type statusGroup struct {
+	class   string
+	results []FetchResult
+}
+
+// statusClasses is the order of the -group-by-status sections. WebSocket
+// upgrades are the only 1xx results, and are listed first.
+var statusClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx", "errors"}
+
+// statusClass returns the section a fetch belongs in
+func statusClass(result FetchResult) string {
+	if result.Error != nil || result.StatusCode < 100 || result.StatusCode > 599 {
+		return "errors"
+	}
+	return fmt.Sprintf("%dxx", result.StatusCode/100)
+}
+
+// groupByStatusClass splits results into the non-empty status sections,
+// keeping their order within each
+func groupByStatusClass(results []FetchResult) []statusGroup {
+	byClass := make(map[string][]FetchResult)
+	for _, result := range results {
+		class := statusClass(result)
+		byClass[class] = append(byClass[class], result)
+	}
+	var groups []statusGroup
+	for _, class := range statusClasses {
+		if len(byClass[class]) > 0 {
+			groups = append(groups, statusGroup{class, byClass[class]})
+		}
+	}
+	return groups
+}
+
+// renderDNSResolutions lists every host looked up by -pre-resolve with its
+// addresses, or its error, and how long the lookup took
+func renderDNSResolutions(w io.Writer, resolutions []DNSResolution) {
+	if len(resolutions) == 0 {
+		return
+	}
+
+	dnsTitle := titleStyle.Render(" DNS Resolution ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(dnsTitle))
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(labelWidth).Render("Host"),
+		headerStyle.Width(34).Render("Addresses"),
+		headerStyle.Width(14).Render("Time"),
+	)}
+	for _, resolution := range resolutions {
+		addresses, style := strings.Join(resolution.IPs, ", "), cellStyle
+		if resolution.Error != "" {
+			addresses, style = resolution.Error, errorStyle
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(labelWidth).Render(fitCell(resolution.Host, labelWidth)),
+			style.Width(34).Render(truncateString(addresses, 31)),
+			cellStyle.Width(14).Render(formatDuration(resolution.Duration)),
+		))
+	}
+	fmt.Fprintln(w, tableStyle.Render(lipgloss.JoinVertical(lipgloss.Left, rows...)))
+}
+
+// renderDNSFailures lists the sites left out of the run because their host
+// could not be resolved, if there are any
+func renderDNSFailures(w io.Writer, failures []DNSFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	dnsTitle := titleStyle.Render(" DNS Resolution Failures ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(dnsTitle))
+
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(labelWidth).Render("URL"),
+		headerStyle.Width(48).Render("Error"),
+	)}
+	for _, failure := range failures {
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Width(labelWidth).Render(fitCell(failure.URL, labelWidth)),
+			errorStyle.Width(48).Render(failure.Error),
+		))
+	}
+	fmt.Fprintln(w, tableStyle.Render(lipgloss.JoinVertical(lipgloss.Left, rows...)))
+}
+
+// renderPingTable prints the ping results table of a run, with a summary
+// line under -top
+func renderPingTable(w io.Writer, run RunResult) {
+	allPingResults := run.Pings
+	pingTitle := titleStyle.Render(" Ping Results ")
+	fmt.Fprintln(w, lipgloss.NewStyle().Width(80).Align(lipgloss.Center).Render(pingTitle))
+
+	// Create ping table header
+	pingTableHeader := []string{
+		headerStyle.Width(labelWidth).Render(siteHeader()),
+		headerStyle.Width(10).Render("Sent"),
+		headerStyle.Width(10).Render("Received"),
+		headerStyle.Width(10).Render("Loss %"),
+		headerStyle.Width(18).Render("Avg Time"),
+	}
+	if *reverseDNS {
+		pingTableHeader = append(pingTableHeader, headerStyle.Width(30).Render("PTR"))
+	}
+	if asnDB != nil {
+		pingTableHeader = append(pingTableHeader, headerStyle.Width(asnWidth).Render("ASN"))
+	}
+	if *showFamily {
+		pingTableHeader = append(pingTableHeader, headerStyle.Width(8).Render("IP"))
+	}
+	if *watch > 0 {
+		pingTableHeader = append(pingTableHeader, headerStyle.Width(12).Render("Checked"))
+	}
+	showTrend := hasTrend(allPingResults)
+	trendWidth := 8
+	for _, result := range allPingResults {
+		trendWidth = max(trendWidth, len(result.Trend)+2)
+	}
+	if showTrend {
+		pingTableHeader = append(pingTableHeader, headerStyle.Width(trendWidth).Render("Trend"))
+	}
+
+	pingHeaderRow := lipgloss.JoinHorizontal(lipgloss.Top, pingTableHeader...)
+
+	// Create ping table rows
+	var pingRows []string
+	pingRows = append(pingRows, pingHeaderRow)
+
+	pingRows = append(pingRows, renderRows(limitRows(allPingResults, *topN), func(result PingResult) string {
+		return renderPingRow(result, showTrend, trendWidth)
+	})...)
+	for _, site := range run.Disabled {
+		pingRows = append(pingRows, renderDisabledRow(site, 48))
+	}
+
+	// Render ping table
+	pingTable := lipgloss.JoinVertical(lipgloss.Left, pingRows...)
+	fmt.Fprintln(w, tableStyle.Render(pingTable))
+	if *topN > 0 {
+		pingErrors := 0
+		for _, result := range allPingResults {
+			if result.Error != nil {
+				pingErrors++
+			}
+		}
+		fmt.Fprintln(w, infoStyle.Render(tableSummary(len(limitRows(allPingResults, *topN)), len(allPingResults), pingErrors)))
+	}
+}
+
+// asnWidth is the width of the ping table's ASN column
+const asnWidth = 30
+
+// renderPingRow renders one ping result, with the Trend column when
+// showTrend is set
+func renderPingRow(result PingResult, showTrend bool, trendWidth int) string {
+	var row string
+	stale := isStale(result.CheckedAt)
+	if result.Error != nil {
+		row = lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Faint(stale).Width(labelWidth).Render(fitCell(siteLabel(result.Name, result.URL), labelWidth)),
+			errorStyle.Faint(stale).Width(48).Render(fmt.Sprintf("Error: %v", result.Error)),
+		)
+	} else if result.Skipped != "" {
+		row = lipgloss.JoinHorizontal(lipgloss.Top,
+			cellStyle.Faint(stale).Width(labelWidth).Render(fitCell(siteLabel(result.Name, result.URL), labelWidth)),
+			infoStyle.Faint(stale).Width(48).Render(fmt.Sprintf("Skipped (%s)", result.Skipped)),
+		)
+	} else {
+		recvStyle := cellStyle
+		if result.PacketsRecv == 0 {
+			recvStyle = errorStyle
+		} else if result.PacketsRecv < result.PacketsSent {
+			recvStyle = warningStyle
+		} else {
+			recvStyle = successStyle
+		}
+
+		lossStyle := cellStyle
+		if result.PacketLoss > *lossCrit {
+			lossStyle = errorStyle
+		} else if result.PacketLoss > *lossWarn {
+			lossStyle = warningStyle
+		} else {
+			lossStyle = successStyle
+		}
+
+		cells := []string{
+			cellStyle.Faint(stale).Width(labelWidth).Render(fitCell(siteLabel(result.Name, result.URL), labelWidth)),
+			cellStyle.Faint(stale).Width(10).Render(fmt.Sprintf("%d", result.PacketsSent)),
+			padded(recvStyle).Faint(stale).Width(10).Render(fmt.Sprintf("%d", result.PacketsRecv)),
+			padded(lossStyle).Faint(stale).Width(10).Render(formatLoss(result.PacketLoss)),
+			rttStyle(result).Faint(stale).Width(18).Render(formatDuration(result.AvgRtt)),
+		}
+		if *reverseDNS {
+			ptr := result.PTR
+			if ptr == "" {
+				ptr = "-"
+			}
+			cells = append(cells, cellStyle.Faint(stale).Width(30).Render(truncateString(ptr, 27)))
+		}
+		if asnDB != nil {
+			info := asnInfo{Number: result.ASN, Org: result.ASOrg}
+			cells = append(cells, cellStyle.Faint(stale).Width(asnWidth).Render(fitCell(info.String(), asnWidth)))
+		}
+		if *showFamily {
+			cells = append(cells, cellStyle.Faint(stale).Width(8).Render(formatIPVersion(result.IPVersion)))
+		}
+		if *watch > 0 {
+			cells = append(cells, cellStyle.Faint(stale).Width(12).Render(formatAgo(result.CheckedAt)))
+		}
+		if showTrend {
+			cells = append(cells, infoStyle.Faint(stale).Width(trendWidth).Render(sparkline(result.Trend)))
+		}
+		row = lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+	}
+	return row
+}
+
+// lossBarWidth is how many cells the packet loss bar takes, leaving room
+// for " 100%" inside the padded Loss column
+const lossBarWidth = 3
+
+// formatLoss renders packet loss as a proportional bar and percentage,
+// e.g. "██░░ 50%", or as plain text without colours or Unicode borders
+func formatLoss(loss float64) string {
+	if lipgloss.ColorProfile() == termenv.Ascii || borderMode() == "ascii" {
+		return fmt.Sprintf("%.1f%%", loss)
+	}
+	filled := int(math.Round(loss / 100 * lossBarWidth))
+	return strings.Repeat("█", filled) + strings.Repeat("░", lossBarWidth-filled) + fmt.Sprintf(" %.0f%%", loss)
+}
+
+// renderDisabledRow renders a dimmed placeholder row for a disabled site,
+// with width cells after the label
+func renderDisabledRow(site DisabledSite, width int) string {
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		cellStyle.Faint(true).Width(labelWidth).Render(fitCell(siteLabel(site.Name, site.URL), labelWidth)),
+		cellStyle.Faint(true).Width(width).Render("disabled"),
+	)
+}
+
+// rttStyle colours a ping's average RTT red when it breached -max-rtt
+func rttStyle(result PingResult) lipgloss.Style {
+	if result.RTTBreach {
+		return errorStyle
+	}
+	return cellStyle
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestPingRowLossFitsOneLine(t *testing.T) {
+	// The bar is only drawn on colour terminals with Unicode borders
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	oldBorder := *border
+	*border = "rounded"
+	t.Cleanup(func() {
+		lipgloss.SetColorProfile(termenv.Ascii)
+		*border = oldBorder
+	})
+
+	tests := []struct {
+		loss float64
+		recv int
+		bar  string
+	}{
+		{0, 4, "░░░ 0%"},
+		{50, 2, "██░ 50%"},
+		{100, 0, "███ 100%"},
+	}
+	header := lipgloss.Width(lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(labelWidth).Render(siteHeader()),
+		headerStyle.Width(10).Render("Sent"),
+		headerStyle.Width(10).Render("Received"),
+		headerStyle.Width(10).Render("Loss %"),
+		headerStyle.Width(18).Render("Avg Time"),
+	))
+	for _, tt := range tests {
+		row := renderPingRow(PingResult{URL: "https://example.com", PacketsSent: 4, PacketsRecv: tt.recv, PacketLoss: tt.loss}, false, 8)
+		if strings.Contains(row, "\n") {
+			t.Errorf("%g%% loss wraps onto a second line:\n%s", tt.loss, row)
+		}
+		if width := lipgloss.Width(row); width != header {
+			t.Errorf("%g%% loss row is %d cells wide, want the header's %d", tt.loss, width, header)
+		}
+		if got := formatLoss(tt.loss); got != tt.bar {
+			t.Errorf("formatLoss(%g) = %q, want %q", tt.loss, got, tt.bar)
+		}
+		if !strings.Contains(row, tt.bar) {
+			t.Errorf("%g%% loss row lacks the bar %q:\n%s", tt.loss, tt.bar, row)
+		}
+	}
+}
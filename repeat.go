@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// fetchRepeated fetches site -repeat times one after another, so each
+// request can hit whatever the previous one warmed. The first (cold)
+// result is returned, carrying the duration of every successful fetch in
+// Samples and a count of the failed ones.
+func fetchRepeated(ctx context.Context, client *http.Client, site Website, limiter *rate.Limiter) FetchResult {
+	result := fetch(ctx, client, site, limiter)
+	if *repeat <= 1 {
+		return result
+	}
+	if result.Error == nil {
+		result.Samples = append(result.Samples, result.Duration)
+	} else {
+		result.RepeatFailures++
+	}
+	for range *repeat - 1 {
+		if ctx.Err() != nil {
+			break
+		}
+		next := fetch(ctx, client, site, limiter)
+		if next.Error != nil {
+			result.RepeatFailures++
+			continue
+		}
+		result.Samples = append(result.Samples, next.Duration)
+	}
+	return result
+}
+
+// sampleStats returns the shortest, mean and longest of samples, which
+// must not be empty
+func sampleStats(samples []time.Duration) (minimum, mean, maximum time.Duration) {
+	minimum, maximum = samples[0], samples[0]
+	var total time.Duration
+	for _, sample := range samples {
+		minimum = min(minimum, sample)
+		maximum = max(maximum, sample)
+		total += sample
+	}
+	return minimum, total / time.Duration(len(samples)), maximum
+}
+
+// repeatCell formats a result's samples as "min/avg/max ms", noting failed
+// repeats
+func repeatCell(result FetchResult) string {
+	if len(result.Samples) == 0 {
+		return "-"
+	}
+	minimum, mean, maximum := sampleStats(result.Samples)
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	text := fmt.Sprintf("%.*f/%.*f/%.*f ms", *decimals, ms(minimum), *decimals, ms(mean), *decimals, ms(maximum))
+	if result.RepeatFailures > 0 {
+		text += fmt.Sprintf(" (%d failed)", result.RepeatFailures)
+	}
+	return text
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// RunResult holds everything measured during one run of the checks
+type RunResult struct {
+	StartedAt time.Time     `json:"started_at"`
+	PingTime  time.Duration `json:"ping_time"`
+	FetchTime time.Duration `json:"fetch_time"`
+	Pings     []PingResult  `json:"pings"`
+	Fetches   []FetchResult `json:"fetches"`
+	// Aborted is set when -abort-after cut the run short, leaving the
+	// results partial
+	Aborted bool `json:"aborted,omitempty"`
+	// Interrupted is set when SIGINT or SIGTERM stopped the run part way
+	Interrupted bool `json:"interrupted,omitempty"`
+	// ResolveTime, Resolutions and DNSFailures cover the -pre-resolve
+	// step; sites whose host failed to resolve are reported here and not
+	// pinged or fetched
+	ResolveTime time.Duration   `json:"resolve_time,omitempty"`
+	Resolutions []DNSResolution `json:"resolutions,omitempty"`
+	DNSFailures []DNSFailure    `json:"dns_failures,omitempty"`
+	// Build identifies the binary that produced the run
+	Build BuildInfo `json:"build"`
+	// HTTPSViolations lists the plaintext sites found by -require-https
+	HTTPSViolations []HTTPSViolation `json:"https_violations,omitempty"`
+	// Disabled lists the sites skipped by enabled: false, with
+	// -show-disabled
+	Disabled []DisabledSite `json:"disabled,omitempty"`
+	// pingsShown is set when -progressive already rendered the ping table
+	pingsShown bool
+}
+
+// DisabledSite identifies a site that was switched off in the config
+type DisabledSite struct {
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+}
+
+// writeReport saves run to path as indented JSON. It writes a temporary
+// file and renames it into place, so an interrupted write never leaves a
+// truncated report behind.
+func writeReport(path string, run RunResult) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadReport reads a report previously saved by writeReport
+func loadReport(path string) (RunResult, error) {
+	var run RunResult
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return run, err
+	}
+	err = json.Unmarshal(data, &run)
+	return run, err
+}
+
+// errorString returns the message of err, or "" when it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// errorFromString is the inverse of errorString
+func errorFromString(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// Results carry their error as a string in JSON since error values
+// cannot be marshalled directly
+
+func (r PingResult) MarshalJSON() ([]byte, error) {
+	type plain PingResult
+	return json.Marshal(struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain(r), errorString(r.Error)})
+}
+
+func (r *PingResult) UnmarshalJSON(data []byte) error {
+	type plain PingResult
+	var aux struct {
+		*plain
+		Error string `json:"error"`
+	}
+	aux.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Error = errorFromString(aux.Error)
+	return nil
+}
+
+func (r FetchResult) MarshalJSON() ([]byte, error) {
+	type plain FetchResult
+	return json.Marshal(struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain(r), errorString(r.Error)})
+}
+
+func (r *FetchResult) UnmarshalJSON(data []byte) error {
+	type plain FetchResult
+	var aux struct {
+		*plain
+		Error string `json:"error"`
+	}
+	aux.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Error = errorFromString(aux.Error)
+	return nil
+}
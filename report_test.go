@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInterruptedRunIsSaved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	// The interrupt lands while this fetch is still waiting
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.AfterFunc(50*time.Millisecond, cancel)
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	fakePinger(t, func(string) error { return nil })
+	setFlag(t, quiet, true)
+
+	urls := []Website{{Name: "ok", URL: server.URL + "/ok"}, {Name: "slow", URL: server.URL + "/slow"}}
+	run := runChecks(ctx, urls, nil, newLimiter(0), newLimiter(0))
+	run.Interrupted = ctx.Err() != nil
+	if !run.Interrupted || len(run.Fetches) != 1 || run.Fetches[0].Name != "ok" {
+		t.Fatalf("interrupted %v with fetches %+v, want the one finished before the interrupt", run.Interrupted, run.Fetches)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		save func(path string) error
+		load func(path string) (RunResult, error)
+	}{
+		{"report", func(path string) error { return writeReport(path, run) }, loadReport},
+		{"history", func(path string) error {
+			// An earlier, complete run is already on file
+			if err := appendHistory(path, RunResult{StartedAt: run.StartedAt.Add(-time.Minute)}); err != nil {
+				return err
+			}
+			return appendHistory(path, run)
+		}, func(path string) (RunResult, error) { return loadHistory(path, time.Time{}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := tt.save(path); err != nil {
+				t.Fatal(err)
+			}
+			saved, err := tt.load(path)
+			if err != nil {
+				t.Fatalf("the partial run doesn't load back: %v", err)
+			}
+			if !saved.Interrupted || !saved.StartedAt.Equal(run.StartedAt) {
+				t.Errorf("loaded run started %v, interrupted %v, want the partial run", saved.StartedAt, saved.Interrupted)
+			}
+			if len(saved.Fetches) != 1 || saved.Fetches[0].StatusCode != http.StatusOK {
+				t.Errorf("loaded fetches %+v, want the finished one", saved.Fetches)
+			}
+			if len(saved.Pings) != len(run.Pings) {
+				t.Errorf("loaded %d pings, want %d", len(saved.Pings), len(run.Pings))
+			}
+			if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("left a temporary file behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+)
+
+// Reporter renders a finished run in one output format
+type Reporter interface {
+	Report(w io.Writer, run RunResult) error
+}
+
+// reporters maps each -output name to its Reporter; a new format only
+// needs an entry here
+var reporters = map[string]Reporter{
+	"table":  tableReporter{},
+	"line":   lineReporter{},
+	"json":   jsonReporter{},
+	"alerts": alertsReporter{},
+}
+
+// reporterNames lists the registered formats for flag help and errors
+func reporterNames() string {
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// tableReporter draws the dashboard tables
+type tableReporter struct{}
+
+func (tableReporter) Report(w io.Writer, run RunResult) error {
+	renderRun(w, run)
+	return nil
+}
+
+// lineReporter prints one dense line per URL
+type lineReporter struct{}
+
+func (lineReporter) Report(w io.Writer, run RunResult) error {
+	renderLines(w, run)
+	return nil
+}
+
+// jsonReporter writes the run as indented JSON, in the same shape as -report
+// but with durations in -time-unit
+type jsonReporter struct{}
+
+func (jsonReporter) Report(w io.Writer, run RunResult) error {
+	return encodeTimed(w, run, *timeUnit)
+}
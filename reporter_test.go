@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleRun has a healthy site and one that refused the connection
+func sampleRun() RunResult {
+	return RunResult{
+		Pings: []PingResult{
+			{URL: "https://a.example/", Name: "a", PacketsSent: 3, PacketsRecv: 3, AvgRtt: 42 * time.Millisecond},
+			{URL: "https://b.example/x", Name: "b", Error: errors.New("no route")},
+		},
+		Fetches: []FetchResult{
+			{URL: "https://a.example/", Name: "a", StatusCode: 200, BodySize: 1.2, Duration: 1500 * time.Millisecond},
+			{URL: "https://b.example/x", Name: "b", Error: errors.New("connection refused"), ErrorKind: ErrorKindRefused},
+		},
+	}
+}
+
+func TestReportersRegistered(t *testing.T) {
+	for name := range reporters {
+		t.Run(name, func(t *testing.T) {
+			setFlag(t, output, name)
+			if err := validateFlags(); err != nil {
+				t.Errorf("-output %s: %v", name, err)
+			}
+		})
+	}
+	setFlag(t, output, "csv")
+	err := validateFlags()
+	if err == nil || !strings.Contains(err.Error(), reporterNames()) {
+		t.Errorf("-output csv: error = %v, want the registered formats listed", err)
+	}
+}
+
+func TestLineReporter(t *testing.T) {
+	setFlag(t, decimals, 2)
+	tests := []struct {
+		show string
+		want []string
+	}{
+		{"url", []string{
+			"a.example    42.00 ms  0%loss  200  1.20MB",
+			"b.example/x  ping-error  -  REFUSED  -  connection refused",
+		}},
+		{"name", []string{
+			"a  42.00 ms  0%loss  200  1.20MB",
+			"b  ping-error  -  REFUSED  -  connection refused",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.show, func(t *testing.T) {
+			setFlag(t, show, tt.show)
+			var out strings.Builder
+			if err := reporters["line"].Report(&out, sampleRun()); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	tests := []struct {
+		unit     string
+		rtt      float64
+		duration float64
+	}{
+		{"ns", 42e6, 1.5e9},
+		{"ms", 42, 1500},
+		{"s", 0.042, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			setFlag(t, timeUnit, tt.unit)
+			var out strings.Builder
+			if err := reporters["json"].Report(&out, sampleRun()); err != nil {
+				t.Fatal(err)
+			}
+			var run struct {
+				Pings []struct {
+					URL    string  `json:"url"`
+					AvgRtt float64 `json:"avg_rtt"`
+				} `json:"pings"`
+				Fetches []struct {
+					URL        string  `json:"url"`
+					StatusCode int     `json:"status_code"`
+					Duration   float64 `json:"duration"`
+					Error      string  `json:"error"`
+				} `json:"fetches"`
+			}
+			if err := json.Unmarshal([]byte(out.String()), &run); err != nil {
+				t.Fatalf("not JSON: %v\n%s", err, out.String())
+			}
+			if len(run.Pings) != 2 || len(run.Fetches) != 2 {
+				t.Fatalf("got %d pings and %d fetches, want 2 of each", len(run.Pings), len(run.Fetches))
+			}
+			if run.Pings[0].AvgRtt != tt.rtt {
+				t.Errorf("avg_rtt = %v, want %v", run.Pings[0].AvgRtt, tt.rtt)
+			}
+			if f := run.Fetches[0]; f.URL != "https://a.example/" || f.StatusCode != 200 || f.Duration != tt.duration {
+				t.Errorf("first fetch = %+v, want a.example's 200 taking %v", f, tt.duration)
+			}
+			if run.Fetches[1].Error != "connection refused" {
+				t.Errorf("second fetch error = %q, want it carried over", run.Fetches[1].Error)
+			}
+		})
+	}
+}
+
+func TestTableReporter(t *testing.T) {
+	var out strings.Builder
+	if err := reporters["table"].Report(&out, sampleRun()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"https://a.example/", "https://b.example/x", "42.00 ms", "connection refused"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, out.String())
+		}
+	}
+}
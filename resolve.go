@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// DNSFailure records a site left out of a run because -pre-resolve could
+// not resolve its host
+type DNSFailure struct {
+	URL   string `json:"url"`
+	Host  string `json:"host"`
+	Error string `json:"error"`
+}
+
+// DNSResolution is the outcome of looking up one host
+type DNSResolution struct {
+	Host     string        `json:"host"`
+	IPs      []string      `json:"ips,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// resolveAll resolves the unique hosts of sites concurrently, running at
+// most concurrency lookups at once. It returns the sites annotated with
+// their IPs, leaving out any whose host failed, along with each host's
+// resolution and the failed sites.
+func resolveAll(ctx context.Context, sites []Website, concurrency int) ([]Website, []DNSResolution, []DNSFailure) {
+	// Each site needs the host it is fetched from and the host it is
+	// pinged at, which differ when pinging strips a www. prefix
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, site := range sites {
+		for _, host := range siteHosts(site) {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	type resolution struct {
+		ips      []string
+		err      error
+		duration time.Duration
+	}
+	resolved := make(map[string]resolution, len(hosts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			ips, err := resolveHost(ctx, host)
+			duration := time.Since(start)
+			mu.Lock()
+			resolved[host] = resolution{ips, err, duration}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	resolutions := make([]DNSResolution, 0, len(hosts))
+	for _, host := range hosts {
+		r := resolved[host]
+		resolutions = append(resolutions, DNSResolution{Host: host, IPs: r.ips, Duration: r.duration, Error: errorString(r.err)})
+	}
+
+	var ok []Website
+	var failures []DNSFailure
+sites:
+	for _, site := range sites {
+		hosts := siteHosts(site)
+		for _, host := range hosts {
+			if err := resolved[host].err; err != nil {
+				failures = append(failures, DNSFailure{URL: site.URL, Host: host, Error: err.Error()})
+				continue sites
+			}
+		}
+		if len(hosts) == 2 {
+			site.IPs = resolved[hosts[0]].ips
+			site.PingIPs = resolved[hosts[1]].ips
+			// Pinning sends the ping and the fetch to the one address
+			if *pinIP {
+				site.IPs = site.IPs[:1]
+				site.PingIPs = site.IPs
+			}
+		}
+		ok = append(ok, site)
+	}
+	return ok, resolutions, failures
+}
+
+// siteHosts returns the fetch and ping hosts of site, or nothing for sites
+// behind a Unix socket or with URLs that don't parse
+func siteHosts(site Website) []string {
+	if _, _, ok := site.unixSocket(); ok {
+		return nil
+	}
+	u, err := url.Parse(site.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	pinged, err := pingHost(site.URL)
+	if err != nil {
+		return nil
+	}
+	return []string{u.Hostname(), pinged}
+}
+
+// resolvedClient returns a copy of client that connects to host through
+// ips instead of looking it up again. Other hosts, such as redirect
+// targets, are still resolved normally.
+func resolvedClient(client *http.Client, host string, ips []string) *http.Client {
+	resolved := *client
+	resolved.Transport = siteTransport(client, func(t *http.Transport) {
+		dial := t.DialContext
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			addrHost, port, err := net.SplitHostPort(addr)
+			if err != nil || addrHost != host {
+				return dial(ctx, network, addr)
+			}
+			for _, ip := range ips {
+				var conn net.Conn
+				conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+				if err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		}
+	}, func(t *http3.Transport) {
+		t.Dial = resolvedQUICDial(host, ips)
+	})
+	return &resolved
+}
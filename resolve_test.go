@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResolveAll(t *testing.T) {
+	answers := map[string][]string{"www.shared.test.": {"192.0.2.100"}, "shared.test.": {"192.0.2.101"}}
+	var sites []Website
+	for i := range 8 {
+		host := fmt.Sprintf("h%d.test.", i)
+		answers[host] = []string{fmt.Sprintf("192.0.2.%d", i+1)}
+		sites = append(sites, Website{Name: host, URL: "https://" + host + "/"})
+	}
+	// Two sites on one host share its lookups, and one host doesn't exist
+	sites = append(sites,
+		Website{Name: "shared a", URL: "https://www.shared.test./a"},
+		Website{Name: "shared b", URL: "https://www.shared.test./b"},
+		Website{Name: "missing", URL: "https://missing.test./"},
+	)
+	setFlag(t, &dnsResolver, nil)
+	setFlag(t, &dnsSlots, nil)
+	setFlag(t, pinIP, false)
+
+	for _, concurrency := range []int{1, 3, 16} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			stub := newStubDNS(t, answers, 50*time.Millisecond)
+			setFlag(t, &resolver, serverResolver(stub.addr))
+
+			ok, resolutions, failures := resolveAll(context.Background(), sites, concurrency)
+
+			if peak := stub.peakInFlight(); peak > concurrency {
+				t.Errorf("%d lookups in flight at once, want at most %d", peak, concurrency)
+			} else if concurrency > 1 && peak < 2 {
+				t.Errorf("lookups never overlapped, want them concurrent")
+			}
+			// h0-h7, www.shared, shared and missing
+			if len(resolutions) != 11 {
+				t.Errorf("got %d resolutions, want one per unique host: %+v", len(resolutions), resolutions)
+			}
+			for host := range answers {
+				if got := stub.count(host); got != 1 {
+					t.Errorf("%s looked up %d times, want once", host, got)
+				}
+			}
+
+			if len(failures) != 1 || failures[0].URL != "https://missing.test./" || failures[0].Host != "missing.test." {
+				t.Errorf("failures = %+v, want just missing.test.", failures)
+			}
+			if len(ok) != len(sites)-1 {
+				t.Fatalf("kept %d sites, want %d", len(ok), len(sites)-1)
+			}
+			for i, site := range ok {
+				if site.Name != sites[i].Name {
+					t.Errorf("site %d is %q, want the order kept with %q", i, site.Name, sites[i].Name)
+				}
+			}
+			if got := ok[0]; len(got.IPs) != 1 || got.IPs[0] != "192.0.2.1" || len(got.PingIPs) != 1 || got.PingIPs[0] != "192.0.2.1" {
+				t.Errorf("h0 annotated with %v / %v, want 192.0.2.1 for both", got.IPs, got.PingIPs)
+			}
+			if got := ok[8]; len(got.IPs) != 1 || got.IPs[0] != "192.0.2.100" || len(got.PingIPs) != 1 || got.PingIPs[0] != "192.0.2.101" {
+				t.Errorf("www.shared annotated with %v / %v, want fetches on www and pings on the bare host", got.IPs, got.PingIPs)
+			}
+		})
+	}
+}
+
+func TestPinIP(t *testing.T) {
+	// The fetch and ping hosts differ, and the fetch host has two addresses
+	stub := newStubDNS(t, map[string][]string{
+		"www.pin.test.": {"127.0.0.2", "127.0.0.3"},
+		"pin.test.":     {"127.0.0.4"},
+	}, 0)
+	setFlag(t, &resolver, serverResolver(stub.addr))
+	setFlag(t, &dnsResolver, nil)
+
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetchedAt := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		host, _, _ := net.SplitHostPort(local.String())
+		fetchedAt <- host
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	tests := []struct {
+		pin               bool
+		pingIP, fetchIP   string
+		pinned            string
+		fetchIPs, pingIPs []string
+	}{
+		{false, "127.0.0.4", "127.0.0.2", "", []string{"127.0.0.2", "127.0.0.3"}, []string{"127.0.0.4"}},
+		{true, "127.0.0.2", "127.0.0.2", "127.0.0.2", []string{"127.0.0.2"}, []string{"127.0.0.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("-pin-ip=%v", tt.pin), func(t *testing.T) {
+			setFlag(t, pinIP, tt.pin)
+			var pinged string
+			fakePinger(t, func(ip string) error {
+				pinged = ip
+				return nil
+			})
+
+			sites, _, failures := resolveAll(context.Background(), []Website{{URL: "http://www.pin.test.:" + port + "/"}}, 4)
+			if len(failures) > 0 {
+				t.Fatalf("resolution failed: %+v", failures)
+			}
+			site := sites[0]
+			if !slices.Equal(site.IPs, tt.fetchIPs) || !slices.Equal(site.PingIPs, tt.pingIPs) {
+				t.Errorf("annotated with %v / %v, want %v / %v", site.IPs, site.PingIPs, tt.fetchIPs, tt.pingIPs)
+			}
+
+			ping := pingSite(context.Background(), site, newLimiter(0))
+			if ping.Error != nil {
+				t.Fatalf("ping failed: %v", ping.Error)
+			}
+			fetch := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if fetch.Error != nil {
+				t.Fatalf("fetch failed: %v", fetch.Error)
+			}
+			fetched := <-fetchedAt
+
+			if pinged != tt.pingIP || ping.IP != tt.pingIP {
+				t.Errorf("pinged %s (reported %s), want %s", pinged, ping.IP, tt.pingIP)
+			}
+			if fetched != tt.fetchIP {
+				t.Errorf("fetched from %s, want %s", fetched, tt.fetchIP)
+			}
+			if fetch.PinnedIP != tt.pinned {
+				t.Errorf("pinned IP = %q, want %q", fetch.PinnedIP, tt.pinned)
+			}
+		})
+	}
+}
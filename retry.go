@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Conditions a retry policy can retry on
+const (
+	retryOn5xx        = "5xx"
+	retryOnTimeout    = "timeout"
+	retryOnConnection = "connection"
+)
+
+// RetryPolicy controls how often a failed fetch is repeated. Zero fields
+// fall back to the -retry-attempts, -retry-backoff and -retry-on flags.
+type RetryPolicy struct {
+	// Attempts is the total number of tries, including the first
+	Attempts int `yaml:"attempts"`
+	// Backoff is the wait before the first retry, doubling after each
+	Backoff time.Duration `yaml:"backoff"`
+	// RetryOn lists the conditions worth retrying: 5xx, timeout and
+	// connection
+	RetryOn []string `yaml:"retry_on"`
+}
+
+// retryPolicy returns the site's policy with any unset fields taken from
+// the global flags
+func (w Website) retryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		Attempts: *retryAttempts,
+		Backoff:  *retryBackoff,
+		RetryOn:  splitRetryOn(*retryOn),
+	}
+	if w.Retry == nil {
+		return policy
+	}
+	if w.Retry.Attempts > 0 {
+		policy.Attempts = w.Retry.Attempts
+	}
+	if w.Retry.Backoff > 0 {
+		policy.Backoff = w.Retry.Backoff
+	}
+	if w.Retry.RetryOn != nil {
+		policy.RetryOn = w.Retry.RetryOn
+	}
+	return policy
+}
+
+// shouldRetry reports whether result failed in a way the policy retries.
+// A 429 that says when to come back is always worth another try.
+func (p RetryPolicy) shouldRetry(result FetchResult) bool {
+	if result.Error == nil && result.StatusCode == http.StatusTooManyRequests && result.RetryAfter > 0 {
+		return true
+	}
+	for _, condition := range p.RetryOn {
+		switch condition {
+		case retryOn5xx:
+			if result.Error == nil && result.StatusCode >= 500 {
+				return true
+			}
+		case retryOnTimeout:
+			if result.ErrorKind == ErrorKindTimeout {
+				return true
+			}
+		case retryOnConnection:
+			if connectionFailed(result) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// connectionFailed reports whether the fetch failed because connecting
+// did: the dial was refused or failed, the connection was reset or closed
+// under the request, or the TLS handshake failed. Other HTTP errors, such
+// as a malformed response or a redirect without a Location, would only
+// fail the same way again.
+func connectionFailed(result FetchResult) bool {
+	switch result.ErrorKind {
+	case ErrorKindRefused, ErrorKindTLS:
+		return true
+	case ErrorKindHTTP:
+		var opErr *net.OpError
+		if errors.As(result.Error, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return errors.Is(result.Error, syscall.ECONNRESET) || errors.Is(result.Error, io.EOF)
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry, counting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	return p.Backoff << (retry - 1)
+}
+
+// maxRetryAfter caps how long a Retry-After header can hold up a fetch
+const maxRetryAfter = time.Minute
+
+// retryWait returns how long to wait before the given retry: the
+// backoff, or the server's Retry-After when it sent one. It reports false
+// when the wait would run past ctx's deadline, as the retry could never
+// finish in time.
+func retryWait(ctx context.Context, p RetryPolicy, retry int, result FetchResult) (time.Duration, bool) {
+	wait := p.delay(retry)
+	if result.RetryAfter > 0 {
+		wait = min(result.RetryAfter, maxRetryAfter)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// parseRetryAfter reads a Retry-After value, either delay-seconds or an
+// HTTP date, as a wait from now. It returns 0 for a missing, malformed or
+// past value.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// splitRetryOn parses a comma-separated list of retry conditions
+func splitRetryOn(s string) []string {
+	var conditions []string
+	for _, condition := range strings.Split(s, ",") {
+		if condition = strings.TrimSpace(condition); condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// validateRetryOn checks that every condition is one a policy understands
+func validateRetryOn(conditions []string) error {
+	for _, condition := range conditions {
+		switch condition {
+		case retryOn5xx, retryOnTimeout, retryOnConnection:
+		default:
+			return fmt.Errorf("unknown retry condition %q (valid: %s, %s, %s)", condition, retryOn5xx, retryOnTimeout, retryOnConnection)
+		}
+	}
+	return nil
+}
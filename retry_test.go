@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyFallsBackToFlags(t *testing.T) {
+	setFlag(t, retryAttempts, 2)
+	setFlag(t, retryBackoff, time.Second)
+	setFlag(t, retryOn, "5xx, timeout")
+
+	global := Website{}.retryPolicy()
+	if global.Attempts != 2 || global.Backoff != time.Second || len(global.RetryOn) != 2 {
+		t.Errorf("without a retry block got %+v, want the flags", global)
+	}
+	site := Website{Retry: &RetryPolicy{Attempts: 5, RetryOn: []string{"connection"}}}.retryPolicy()
+	if site.Attempts != 5 || site.Backoff != time.Second || len(site.RetryOn) != 1 || site.RetryOn[0] != "connection" {
+		t.Errorf("with a partial retry block got %+v, want attempts and retry_on overridden, backoff from the flag", site)
+	}
+	if d := site.delay(3); d != 4*time.Second {
+		t.Errorf("third retry waits %v, want the backoff doubled twice", d)
+	}
+}
+
+// countingServer runs handle for every connection to a local listener and
+// returns its address and a count of connections accepted
+func countingServer(t *testing.T, handle func(net.Conn)) (string, *atomic.Int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var count atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			count.Add(1)
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String(), &count
+}
+
+func TestRetryOnConnection(t *testing.T) {
+	// Closing with SO_LINGER 0 resets the connection instead of closing it
+	reset, _ := countingServer(t, func(conn net.Conn) {
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Read(make([]byte, 1024))
+		conn.Close()
+	})
+	garbage, _ := countingServer(t, func(conn net.Conn) {
+		conn.Read(make([]byte, 1024))
+		conn.Write([]byte("NOT HTTP\r\n\r\n"))
+		conn.Close()
+	})
+	// Nothing listens on a port that was just closed
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := closed.Addr().String()
+	closed.Close()
+	noLocation := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer noLocation.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		attempts int
+	}{
+		{"refused", "http://" + refused + "/", 3},
+		{"reset", "http://" + reset + "/", 3},
+		{"malformed response", "http://" + garbage + "/", 1},
+		{"redirect without Location", noLocation.URL, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := Website{URL: tt.url, Retry: &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, RetryOn: []string{retryOnConnection}}}
+			result := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+			if result.Error == nil {
+				t.Fatal("want an error, got none")
+			}
+			if result.Attempts != tt.attempts {
+				t.Errorf("made %d attempts, want %d (%s: %v)", result.Attempts, tt.attempts, result.ErrorKind, result.Error)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	all := RetryPolicy{RetryOn: []string{retryOn5xx, retryOnTimeout, retryOnConnection}}
+	only5xx := RetryPolicy{RetryOn: []string{retryOn5xx}}
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		result FetchResult
+		want   bool
+	}{
+		{"503", all, FetchResult{StatusCode: 503}, true},
+		{"404", all, FetchResult{StatusCode: 404}, false},
+		{"timeout", all, FetchResult{ErrorKind: ErrorKindTimeout}, true},
+		{"timeout under 5xx only", only5xx, FetchResult{ErrorKind: ErrorKindTimeout}, false},
+		{"TLS", all, FetchResult{ErrorKind: ErrorKindTLS}, true},
+		{"DNS", all, FetchResult{ErrorKind: ErrorKindDNS}, false},
+		{"429 with Retry-After", RetryPolicy{}, FetchResult{StatusCode: 429, RetryAfter: time.Second}, true},
+		{"429 without Retry-After", RetryPolicy{}, FetchResult{StatusCode: 429}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.shouldRetry(tt.result); got != tt.want {
+			t.Errorf("%s: shouldRetry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{" 120 ", 2 * time.Minute},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWaitCaps(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond}
+	short, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		retryAfter time.Duration
+		want       time.Duration
+		ok         bool
+	}{
+		{"backoff", context.Background(), 0, 100 * time.Millisecond, true},
+		{"Retry-After", context.Background(), 3 * time.Second, 3 * time.Second, true},
+		{"Retry-After capped", context.Background(), time.Hour, maxRetryAfter, true},
+		{"past the deadline", short, 3 * time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		wait, ok := retryWait(tt.ctx, policy, 1, FetchResult{RetryAfter: tt.retryAfter})
+		if wait != tt.want || ok != tt.ok {
+			t.Errorf("%s: retryWait = %v, %v, want %v, %v", tt.name, wait, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFetchDataHonoursRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter func() string
+		deadline   time.Duration
+		wantStatus int
+		attempts   int
+		minWait    time.Duration
+	}{
+		{"429 in seconds", http.StatusTooManyRequests, func() string { return "1" }, 0, http.StatusOK, 2, time.Second},
+		{"503 as a date", http.StatusServiceUnavailable, func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) }, 0, http.StatusOK, 2, time.Second},
+		{"past the deadline", http.StatusTooManyRequests, func() string { return "30" }, 2 * time.Second, http.StatusTooManyRequests, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter())
+					w.WriteHeader(tt.status)
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+			start := time.Now()
+			result := fetchData(ctx, newFetchClient(), Website{URL: server.URL, Retry: &RetryPolicy{Attempts: 3}}, newLimiter(0))
+			elapsed := time.Since(start)
+
+			if result.StatusCode != tt.wantStatus || result.Attempts != tt.attempts {
+				t.Errorf("got %d after %d attempts, want %d after %d", result.StatusCode, result.Attempts, tt.wantStatus, tt.attempts)
+			}
+			if elapsed < tt.minWait || result.RetryAfterWaited < tt.minWait {
+				t.Errorf("took %v and waited %v, want at least %v", elapsed, result.RetryAfterWaited, tt.minWait)
+			}
+			if tt.deadline > 0 && elapsed > tt.deadline {
+				t.Errorf("took %v, past the %v deadline", elapsed, tt.deadline)
+			}
+			note := "Retry-After " + result.RetryAfterWaited.Round(time.Second).String()
+			if got := slices.Contains(fetchNotes(result), note); got != (tt.minWait > 0) {
+				t.Errorf("notes %q, want %q noted %v", fetchNotes(result), note, tt.minWait > 0)
+			}
+		})
+	}
+}
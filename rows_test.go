@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetchRows returns n fetch results mixing the kinds of row the fetch
+// table draws: successes, redirects, failed statuses, notes and errors
+func testFetchRows(n int) []FetchResult {
+	results := make([]FetchResult, n)
+	for i := range results {
+		result := FetchResult{
+			URL:        fmt.Sprintf("https://site%d.example/path", i),
+			StatusCode: []int{200, 301, 404, 503}[i%4],
+			BodyLength: i * 1000,
+			BodySize:   float64(i) / 1000,
+			Duration:   time.Duration(i) * time.Millisecond,
+			CheckedAt:  time.Now(),
+		}
+		switch i % 7 {
+		case 1:
+			result.Redirects = []string{"https://www.example/"}
+		case 3:
+			result.SLABreach = true
+		case 5:
+			result.Error = errors.New("connection refused")
+			result.ErrorKind = ErrorKindRefused
+		}
+		results[i] = result
+	}
+	return results
+}
+
+func testRenderFetch(t testing.TB) func(FetchResult) string {
+	columns, err := selectFetchColumns("url,status,size,time,notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(result FetchResult) string { return renderFetchRow(columns, result) }
+}
+
+func TestRenderRowsKeepsOrder(t *testing.T) {
+	render := testRenderFetch(t)
+	items := testFetchRows(100)
+	rows := renderRows(items, render)
+	if len(rows) != len(items) {
+		t.Fatalf("got %d rows for %d items", len(rows), len(items))
+	}
+	for i, row := range rows {
+		if !strings.Contains(row, fmt.Sprintf("site%d.example", i)) {
+			t.Errorf("row %d is not item %d:\n%s", i, i, row)
+		}
+	}
+}
+
+func BenchmarkRenderRows(b *testing.B) {
+	render := testRenderFetch(b)
+	for _, n := range []int{100, 1000} {
+		items := testFetchRows(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for b.Loop() {
+				renderRows(items, render)
+			}
+		})
+	}
+}
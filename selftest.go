@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+)
+
+// selftestCase is one fixture site and what the fetch pipeline must
+// report for it
+type selftestCase struct {
+	name  string
+	site  Website
+	check func(FetchResult) error
+}
+
+// selftestBodySize is the length of the body the size fixture serves
+const selftestBodySize = 256 * 1024
+
+// newSelftestServer starts the local fixtures the self-test fetches
+func newSelftestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("/redirect", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/slow", func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/large", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Length", strconv.Itoa(selftestBodySize))
+		rw.Write(bytes.Repeat([]byte("x"), selftestBodySize))
+	})
+	return httptest.NewServer(mux)
+}
+
+// selftestCases are the fixtures of the server at baseURL and what each
+// must produce. The timeout case needs -watchdog.
+func selftestCases(baseURL string) []selftestCase {
+	// Retries would only slow the failing cases down
+	noRetry := &RetryPolicy{Attempts: 1}
+	noFollow := false
+
+	cases := []selftestCase{
+		{
+			name: "200 with assertion",
+			site: Website{URL: baseURL + "/ok", Assert: &Assertion{Status: 200, BodyContains: `"ok"`}},
+			check: func(r FetchResult) error {
+				if r.Error != nil || r.StatusCode != 200 || r.CheckOK == nil || !*r.CheckOK {
+					return fmt.Errorf("want 200 passing its assertion, got status %d, check %v, error %v", r.StatusCode, r.CheckOK, r.Error)
+				}
+				return nil
+			},
+		},
+		{
+			name: "redirect followed",
+			site: Website{URL: baseURL + "/redirect"},
+			check: func(r FetchResult) error {
+				if r.Error != nil || r.StatusCode != 200 || len(r.Redirects) != 1 {
+					return fmt.Errorf("want 200 after 1 redirect, got status %d after %d, error %v", r.StatusCode, len(r.Redirects), r.Error)
+				}
+				return nil
+			},
+		},
+		{
+			name: "redirect not followed",
+			site: Website{URL: baseURL + "/redirect", FollowRedirects: &noFollow},
+			check: func(r FetchResult) error {
+				if r.StatusCode != http.StatusFound || r.Location != "/ok" {
+					return fmt.Errorf("want 302 to /ok, got status %d to %q", r.StatusCode, r.Location)
+				}
+				return nil
+			},
+		},
+		{
+			name: "404 fails",
+			site: Website{URL: baseURL + "/missing", Retry: noRetry},
+			check: func(r FetchResult) error {
+				if r.StatusCode != http.StatusNotFound || !fetchFailed(r) {
+					return fmt.Errorf("want a failing 404, got status %d", r.StatusCode)
+				}
+				return nil
+			},
+		},
+		{
+			name: "timeout",
+			site: Website{URL: baseURL + "/slow", MaxTime: 200 * time.Millisecond, Retry: noRetry},
+			check: func(r FetchResult) error {
+				if r.ErrorKind != ErrorKindTimeout {
+					return fmt.Errorf("want a %s error, got %q (%v)", ErrorKindTimeout, r.ErrorKind, r.Error)
+				}
+				return nil
+			},
+		},
+		{
+			name: "body size",
+			site: Website{URL: baseURL + "/large"},
+			check: func(r FetchResult) error {
+				if r.Error != nil || r.BodyLength != selftestBodySize || r.ContentLength != selftestBodySize || lengthMismatch(r) {
+					return fmt.Errorf("want a %d-byte body matching its Content-Length, got %d of %d, error %v", selftestBodySize, r.BodyLength, r.ContentLength, r.Error)
+				}
+				if r.BodySize != float64(selftestBodySize)/1024/1024 {
+					return fmt.Errorf("want %g MB, got %g", float64(selftestBodySize)/1024/1024, r.BodySize)
+				}
+				return nil
+			},
+		},
+	}
+	for i := range cases {
+		cases[i].site.Name = cases[i].name
+	}
+	return cases
+}
+
+// fetchSelftest fetches every case through fetchAll and returns each
+// case's result by name, turning -watchdog on for the duration
+func fetchSelftest(cases []selftestCase) map[string]FetchResult {
+	defer func(old bool) { *watchdog = old }(*watchdog)
+	*watchdog = true
+
+	urls := make([]Website, len(cases))
+	for i, c := range cases {
+		urls[i] = c.site
+	}
+	results, _ := fetchAll(context.Background(), urls, newFetchClient(), newLimiter(0), &abortCounter{})
+	byName := make(map[string]FetchResult, len(results))
+	for _, result := range results {
+		byName[result.Name] = result
+	}
+	return byName
+}
+
+// runSelftest fetches a set of local httptest fixtures through the same
+// fetchAll pipeline as a real run (retries, redirects, assertions, SLA,
+// body size and error classification) and prints PASS or FAIL for each.
+// It reports whether every case passed. Pings are left out because ICMP
+// depends on the host's privileges rather than on this program.
+func runSelftest(w io.Writer) bool {
+	server := newSelftestServer()
+	defer server.Close()
+
+	cases := selftestCases(server.URL)
+	byName := fetchSelftest(cases)
+
+	passed := true
+	for _, c := range cases {
+		result, ok := byName[c.name]
+		err := fmt.Errorf("no result")
+		if ok {
+			err = c.check(result)
+		}
+		if err != nil {
+			passed = false
+			fmt.Fprintln(w, errorStyle.Render("FAIL")+" "+c.name+": "+err.Error())
+		} else {
+			fmt.Fprintln(w, successStyle.Render("PASS")+" "+c.name)
+		}
+	}
+	return passed
+}
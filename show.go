@@ -0,0 +1,24 @@
+package main
+
+// siteLabel returns how a result is identified in the tables under -show:
+// its URL, or its name when it has one
+func siteLabel(name, url string) string {
+	if *show == "url" || name == "" {
+		return url
+	}
+	return name
+}
+
+// siteHeader is the header of the column holding siteLabel
+func siteHeader() string {
+	if *show == "url" {
+		return "URL"
+	}
+	return "Name"
+}
+
+// showURLInNotes reports whether -show both moved the URL of a named site
+// into the notes
+func showURLInNotes(name string) bool {
+	return *show == "both" && name != ""
+}
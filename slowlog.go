@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// slowLogger writes the -slow-log records to stderr, away from the tables
+var slowLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// watchSlow times one ping or fetch of url for -slow-log. If it is still
+// running once the threshold passes, a record is logged straight away;
+// the function returned must be called when it finishes, and then logs
+// the final duration of an operation that was reported as slow.
+func watchSlow(kind, url string) func() {
+	if *slowLog <= 0 {
+		return func() {}
+	}
+	start := time.Now()
+	timer := time.AfterFunc(*slowLog, func() {
+		logSlow("slow check still running", kind, url, time.Since(start))
+	})
+	return func() {
+		// Stop only fails once the timer has fired, i.e. for slow ones
+		if !timer.Stop() {
+			logSlow("slow check finished", kind, url, time.Since(start))
+		}
+	}
+}
+
+// logSlow logs a -slow-log record for the ping or fetch of url
+func logSlow(msg, kind, url string, elapsed time.Duration) {
+	slowLogger.Warn(msg,
+		slog.String("kind", kind),
+		slog.String("url", url),
+		slog.Duration("duration", roundDuration(elapsed)),
+		slog.Duration("threshold", *slowLog),
+	)
+}
+
+// roundDuration trims d to a readable precision, e.g. 3.4s or 850ms
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(100 * time.Millisecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchSlow(t *testing.T) {
+	var logged syncBuffer
+	setFlag(t, &slowLogger, slog.New(slog.NewJSONHandler(&logged, nil)))
+	setFlag(t, slowLog, 50*time.Millisecond)
+
+	watchSlow("ping", "quick.example")()
+	done := watchSlow("fetch", "https://slow.example/")
+	time.Sleep(80 * time.Millisecond)
+	running := logged.String()
+	done()
+
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	if !strings.HasPrefix(logged.String(), running) || running == "" || len(lines) != 2 {
+		t.Fatalf("want one record while running and one on finishing, got:\n%s", logged.String())
+	}
+	for i, msg := range []string{"slow check still running", "slow check finished"} {
+		var record struct {
+			Level, Msg, Kind, URL string
+			Duration, Threshold   time.Duration
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Level != "WARN" || record.Msg != msg || record.Kind != "fetch" || record.URL != "https://slow.example/" {
+			t.Errorf("record %d = %+v, want a WARN %q for the slow fetch", i, record, msg)
+		}
+		if record.Threshold != 50*time.Millisecond || record.Duration < record.Threshold {
+			t.Errorf("record %d: duration %v, threshold %v, want the 50ms threshold passed", i, record.Duration, record.Threshold)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// spinnerFrames are drawn in turn while a phase is running
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinner animates a status message on a single terminal line until
+// stopped. It draws on stdout, or stderr with -out. When that is not a
+// terminal it prints the message once instead, and outside the table
+// dashboard or with -api it prints nothing at all.
+type spinner struct {
+	message string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func startSpinner(message string) *spinner {
+	s := &spinner{message: message}
+	if *output != "table" || *apiAddr != "" || *quiet || *tui {
+		return s
+	}
+	w := spinnerOut()
+	if !isatty.IsTerminal(w.Fd()) && !isatty.IsCygwinTerminal(w.Fd()) {
+		fmt.Fprintln(w, infoStyle.Render(" ⏳ "+message))
+		return s
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			fmt.Fprint(w, "\r"+infoStyle.Render(" "+spinnerFrames[frame%len(spinnerFrames)]+" "+message))
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// Stop ends the animation and leaves the message on its own line
+func (s *spinner) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	fmt.Fprintln(spinnerOut(), "\r\033[K"+infoStyle.Render(" ⏳ "+s.message))
+}
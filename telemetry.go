@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the ping and fetch spans. It is a no-op until
+// setupTracing installs an exporter for -otel-endpoint.
+var tracer = otel.Tracer("github.com/mwmuni/go_async_web_data")
+
+// setupTracing exports spans over OTLP/HTTP to -otel-endpoint, which may be
+// a host:port reached over HTTPS or a full URL. It returns a function that flushes and stops
+// the exporter; both are no-ops when the flag is unset.
+func setupTracing() (func(), error) {
+	if *otelEndpoint == "" {
+		return func() {}, nil
+	}
+
+	option := otlptracehttp.WithEndpoint(*otelEndpoint)
+	if strings.Contains(*otelEndpoint, "://") {
+		option = otlptracehttp.WithEndpointURL(*otelEndpoint)
+	}
+	exporter, err := otlptracehttp.New(context.Background(), option)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("go_async_web_data"))),
+	)
+	otel.SetTracerProvider(provider)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		provider.Shutdown(ctx)
+	}, nil
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// pingSpanAttributes describes a finished ping
+func pingSpanAttributes(result PingResult) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("ping.domain", result.Domain),
+		attribute.String("ping.ip", result.IP),
+		attribute.Int("ping.packets_sent", result.PacketsSent),
+		attribute.Int("ping.packets_recv", result.PacketsRecv),
+		attribute.Float64("ping.packet_loss", result.PacketLoss),
+		attribute.Float64("ping.rtt_ms", float64(result.AvgRtt)/float64(time.Millisecond)),
+	}
+}
+
+// fetchSpanAttributes describes a finished fetch
+func fetchSpanAttributes(result FetchResult) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.HTTPResponseStatusCode(result.StatusCode),
+		semconv.HTTPResponseBodySize(result.BodyLength),
+		attribute.Int("fetch.attempts", result.Attempts),
+		attribute.Int("fetch.redirects", len(result.Redirects)),
+		attribute.Float64("fetch.duration_ms", float64(result.Duration)/float64(time.Millisecond)),
+	}
+}
+
+// withConnectionSpans returns ctx with an httptrace hook that records DNS,
+// connect and TLS handshake child spans under the span in ctx. It returns
+// ctx unchanged when tracing is off.
+func withConnectionSpans(ctx context.Context) context.Context {
+	if *otelEndpoint == "" {
+		return ctx
+	}
+
+	var mu sync.Mutex
+	var dnsSpan, tlsSpan trace.Span
+	connectSpans := make(map[string]trace.Span)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			_, dnsSpan = tracer.Start(ctx, "dns", trace.WithAttributes(attribute.String("dns.host", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if dnsSpan != nil {
+				endSpan(dnsSpan, info.Err)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			_, connectSpans[network+addr] = tracer.Start(ctx, "connect", trace.WithAttributes(attribute.String("net.peer.addr", addr)))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if span, ok := connectSpans[network+addr]; ok {
+				endSpan(span, err)
+				delete(connectSpans, network+addr)
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			_, tlsSpan = tracer.Start(ctx, "tls")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if tlsSpan != nil {
+				endSpan(tlsSpan, err)
+			}
+		},
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// metricPrefix starts every metric name in the -textfile output
+const metricPrefix = "async_web_data_"
+
+// metric is one gauge in the Prometheus text exposition format
+type metric struct {
+	name, help string
+	// value returns the sample for a site, or false to leave it out
+	ping  func(PingResult) (float64, bool)
+	fetch func(FetchResult) (float64, bool)
+}
+
+// boolValue converts b to the 0/1 Prometheus uses for up-style gauges
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// siteMetrics are written once per pinged or fetched site
+var siteMetrics = []metric{
+	{name: "ping_up", help: "Whether the host answered at least one ping (1) or not (0).",
+		ping: func(r PingResult) (float64, bool) {
+			return boolValue(r.Error == nil && r.PacketsRecv > 0), r.Skipped == ""
+		}},
+	{name: "ping_rtt_seconds", help: "Average ping round-trip time.",
+		ping: func(r PingResult) (float64, bool) {
+			return r.AvgRtt.Seconds(), r.Error == nil && r.PacketsRecv > 0
+		}},
+	{name: "ping_packet_loss_ratio", help: "Fraction of ping packets lost, from 0 to 1.",
+		ping: func(r PingResult) (float64, bool) {
+			return r.PacketLoss / 100, r.Error == nil && r.Skipped == ""
+		}},
+	{name: "fetch_success", help: "Whether the fetch passed (1) or failed as -fail-on-error counts it (0).",
+		fetch: func(r FetchResult) (float64, bool) {
+			return boolValue(!fetchFailed(r)), true
+		}},
+	{name: "fetch_status_code", help: "HTTP status code of the final response.",
+		fetch: func(r FetchResult) (float64, bool) {
+			return float64(r.StatusCode), r.Error == nil
+		}},
+	{name: "fetch_duration_seconds", help: "Time taken by the fetch, redirects and body included.",
+		fetch: func(r FetchResult) (float64, bool) {
+			return r.Duration.Seconds(), r.Error == nil
+		}},
+	{name: "fetch_body_bytes", help: "Size of the response body.",
+		fetch: func(r FetchResult) (float64, bool) {
+			return float64(r.BodyLength), r.Error == nil
+		}},
+	{name: "fetch_redirects", help: "Number of redirects followed.",
+		fetch: func(r FetchResult) (float64, bool) {
+			return float64(len(r.Redirects)), r.Error == nil
+		}},
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// siteLabels renders the url and name labels of a sample
+func siteLabels(url, name string) string {
+	return fmt.Sprintf(`{url="%s",name="%s"}`, labelEscaper.Replace(url), labelEscaper.Replace(name))
+}
+
+// formatMetrics renders run in the Prometheus text exposition format
+func formatMetrics(run RunResult) []byte {
+	var buf bytes.Buffer
+	gauge := func(name, help string) {
+		fmt.Fprintf(&buf, "# HELP %s%s %s\n# TYPE %s%s gauge\n", metricPrefix, name, help, metricPrefix, name)
+	}
+
+	gauge("run_timestamp_seconds", "Unix time the run started.")
+	fmt.Fprintf(&buf, "%srun_timestamp_seconds %d\n", metricPrefix, run.StartedAt.Unix())
+	gauge("run_ping_duration_seconds", "Time taken by the ping phase.")
+	fmt.Fprintf(&buf, "%srun_ping_duration_seconds %g\n", metricPrefix, run.PingTime.Seconds())
+	gauge("run_fetch_duration_seconds", "Time taken by the fetch phase.")
+	fmt.Fprintf(&buf, "%srun_fetch_duration_seconds %g\n", metricPrefix, run.FetchTime.Seconds())
+	gauge("run_partial", "Whether the run was aborted or interrupted before finishing.")
+	fmt.Fprintf(&buf, "%srun_partial %g\n", metricPrefix, boolValue(run.Aborted || run.Interrupted))
+
+	for _, m := range siteMetrics {
+		gauge(m.name, m.help)
+		if m.ping != nil {
+			for _, result := range run.Pings {
+				if value, ok := m.ping(result); ok {
+					fmt.Fprintf(&buf, "%s%s%s %g\n", metricPrefix, m.name, siteLabels(result.URL, result.Name), value)
+				}
+			}
+		}
+		if m.fetch != nil {
+			for _, result := range run.Fetches {
+				if value, ok := m.fetch(result); ok {
+					fmt.Fprintf(&buf, "%s%s%s %g\n", metricPrefix, m.name, siteLabels(result.URL, result.Name), value)
+				}
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeTextfile saves run's metrics to path for node_exporter's textfile
+// collector. The temporary file doesn't end in .prom, so the collector
+// never reads it half-written.
+func writeTextfile(path string, run RunResult) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, formatMetrics(run), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
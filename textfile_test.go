@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exposition is a parsed Prometheus text exposition: each sample's value
+// keyed by its metric name and rendered labels, and each metric's type
+type exposition struct {
+	samples map[string]float64
+	types   map[string]string
+}
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelPair  = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\\n]|\\[\\"n])*)"`)
+)
+
+// parseExposition checks data against the text exposition format as
+// node_exporter reads it: HELP and TYPE once per metric and before its
+// samples, valid names, quoted and escaped label values, float values and
+// no duplicate series
+func parseExposition(data []byte) (exposition, error) {
+	exp := exposition{samples: make(map[string]float64), types: make(map[string]string)}
+	helped := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		fail := func(why string) (exposition, error) {
+			return exp, errors.New("line " + strconv.Itoa(n) + ": " + why + ": " + line)
+		}
+		if comment, ok := strings.CutPrefix(line, "# "); ok {
+			kind, rest, _ := strings.Cut(comment, " ")
+			name, text, _ := strings.Cut(rest, " ")
+			switch {
+			case !metricName.MatchString(name):
+				return fail("bad metric name")
+			case kind == "HELP" && helped[name], kind == "TYPE" && exp.types[name] != "":
+				return fail("repeated " + kind)
+			case kind == "HELP":
+				helped[name] = true
+			case kind == "TYPE" && text != "gauge" && text != "counter":
+				return fail("unknown type")
+			case kind == "TYPE":
+				exp.types[name] = text
+			}
+			continue
+		}
+
+		// Label values may hold spaces, but the value is the last field
+		space := strings.LastIndex(line, " ")
+		if space < 0 {
+			return fail("bad sample")
+		}
+		series, value := line[:space], line[space+1:]
+		name, labels, hasLabels := strings.Cut(series, "{")
+		if !metricName.MatchString(name) {
+			return fail("bad sample")
+		}
+		if exp.types[name] == "" {
+			return fail("sample before its TYPE")
+		}
+		if hasLabels {
+			var ok bool
+			labels, ok = strings.CutSuffix(labels, "}")
+			if !ok {
+				return fail("unclosed labels")
+			}
+			for labels != "" {
+				match := labelPair.FindString(labels)
+				if match == "" {
+					return fail("bad label")
+				}
+				labels = strings.TrimPrefix(labels[len(match):], ",")
+			}
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fail("bad value")
+		}
+		if _, dup := exp.samples[series]; dup {
+			return fail("duplicate series")
+		}
+		exp.samples[series] = v
+	}
+	return exp, scanner.Err()
+}
+
+func TestFormatMetrics(t *testing.T) {
+	redirected := "https://c.example/"
+	run := sampleRun()
+	run.StartedAt = time.Unix(1700000000, 0)
+	run.PingTime, run.FetchTime = 250*time.Millisecond, 1500*time.Millisecond
+	run.Pings = append(run.Pings,
+		PingResult{URL: "unix:///run/app.sock:/health", Name: "socket", Skipped: "unix socket"},
+		PingResult{URL: redirected, Name: `say "hi"\` + "\nthere", PacketsSent: 4, PacketsRecv: 2, PacketLoss: 50, AvgRtt: 8 * time.Millisecond},
+	)
+	run.Fetches = append(run.Fetches, FetchResult{URL: redirected, Name: `say "hi"\` + "\nthere", StatusCode: 200, BodyLength: 2_500_000,
+		Duration: 20 * time.Millisecond, Redirects: []string{redirected + "a", redirected + "b"}})
+
+	exp, err := parseExposition(formatMetrics(run))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, formatMetrics(run))
+	}
+	a := `{url="https://a.example/",name="a"}`
+	b := `{url="https://b.example/x",name="b"}`
+	c := `{url="https://c.example/",name="say \"hi\"\\\nthere"}`
+	tests := []struct {
+		series string
+		want   float64
+		// absent series must not be written at all
+		absent bool
+	}{
+		{"async_web_data_run_timestamp_seconds", 1700000000, false},
+		{"async_web_data_run_ping_duration_seconds", 0.25, false},
+		{"async_web_data_run_fetch_duration_seconds", 1.5, false},
+		{"async_web_data_run_partial", 0, false},
+		{"async_web_data_ping_up" + a, 1, false},
+		{"async_web_data_ping_up" + b, 0, false},
+		{"async_web_data_ping_rtt_seconds" + a, 0.042, false},
+		{"async_web_data_ping_rtt_seconds" + b, 0, true},
+		{"async_web_data_ping_packet_loss_ratio" + c, 0.5, false},
+		{`async_web_data_ping_up{url="unix:///run/app.sock:/health",name="socket"}`, 0, true},
+		{"async_web_data_fetch_success" + a, 1, false},
+		{"async_web_data_fetch_success" + b, 0, false},
+		{"async_web_data_fetch_status_code" + a, 200, false},
+		{"async_web_data_fetch_status_code" + b, 0, true},
+		{"async_web_data_fetch_duration_seconds" + a, 1.5, false},
+		{"async_web_data_fetch_body_bytes" + c, 2_500_000, false},
+		{"async_web_data_fetch_redirects" + c, 2, false},
+	}
+	for _, tt := range tests {
+		got, ok := exp.samples[tt.series]
+		switch {
+		case tt.absent && ok:
+			t.Errorf("%s written as %v, want it left out", tt.series, got)
+		case !tt.absent && !ok:
+			t.Errorf("%s missing", tt.series)
+		case !tt.absent && got != tt.want:
+			t.Errorf("%s = %v, want %v", tt.series, got, tt.want)
+		}
+	}
+	for _, m := range siteMetrics {
+		if exp.types[metricPrefix+m.name] != "gauge" {
+			t.Errorf("%s has no gauge TYPE line", m.name)
+		}
+	}
+
+	run.Interrupted = true
+	if exp, _ := parseExposition(formatMetrics(run)); exp.samples["async_web_data_run_partial"] != 1 {
+		t.Error("interrupted run not marked partial")
+	}
+}
+
+func TestParseExpositionRejects(t *testing.T) {
+	// The checker itself has to catch what node_exporter would refuse
+	for _, bad := range []string{
+		"up 1\n",
+		"# TYPE up gauge\nup{url=\"a\" 1\n",
+		"# TYPE up gauge\nup{url=\"a\"b\"} 1\n",
+		"# TYPE up gauge\nup one\n",
+		"# TYPE up gauge\nup 1\nup 2\n",
+		"# TYPE 1up gauge\n",
+		"# TYPE up gauge\n# TYPE up gauge\n",
+	} {
+		if _, err := parseExposition([]byte(bad)); err == nil {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sites.prom")
+	if err := os.WriteFile(path, []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := sampleRun()
+	if err := writeTextfile(path, run); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, formatMetrics(run)) {
+		t.Errorf("file holds %q, want the run's metrics in place of the old ones", data)
+	}
+	if _, err := parseExposition(data); err != nil {
+		t.Error(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want the temporary one renamed away", len(entries))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644 for node_exporter to read (%v)", info.Mode().Perm(), err)
+	}
+
+	if err := writeTextfile(filepath.Join(dir, "missing", "sites.prom"), run); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "github.com/charmbracelet/lipgloss"
+
+// theme is the colour palette the style variables are drawn with
+type theme struct {
+	// accent colours titles, headers and borders; onAccent is the text
+	// drawn on an accent background
+	accent, onAccent lipgloss.TerminalColor
+	success, error   lipgloss.TerminalColor
+	info, warning    lipgloss.TerminalColor
+}
+
+// darkTheme is the original palette, meant for dark backgrounds
+var darkTheme = theme{
+	accent:   lipgloss.Color("#7D56F4"),
+	onAccent: lipgloss.Color("#FAFAFA"),
+	success:  lipgloss.Color("#2ECC71"),
+	error:    lipgloss.Color("#E74C3C"),
+	info:     lipgloss.Color("#3498DB"),
+	warning:  lipgloss.Color("#F39C12"),
+}
+
+// themes maps each -theme name to its palette. The light one uses darker
+// shades that stay readable on white; mono drops colour but keeps bold.
+var themes = map[string]theme{
+	"dark": darkTheme,
+	"light": {
+		accent:   lipgloss.Color("#4B2BB8"),
+		onAccent: lipgloss.Color("#FFFFFF"),
+		success:  lipgloss.Color("#1E7B45"),
+		error:    lipgloss.Color("#B03A2E"),
+		info:     lipgloss.Color("#1F5F8B"),
+		warning:  lipgloss.Color("#9A5B00"),
+	},
+	"mono": {
+		accent:   lipgloss.NoColor{},
+		onAccent: lipgloss.NoColor{},
+		success:  lipgloss.NoColor{},
+		error:    lipgloss.NoColor{},
+		info:     lipgloss.NoColor{},
+		warning:  lipgloss.NoColor{},
+	},
+}
+
+// applyTheme repaints the style variables with t
+func applyTheme(t theme) {
+	titleStyle = titleStyle.Foreground(t.onAccent).Background(t.accent)
+	headerStyle = headerStyle.Foreground(t.accent).BorderForeground(t.accent)
+	tableStyle = tableStyle.BorderForeground(t.accent)
+	successStyle = successStyle.Foreground(t.success)
+	errorStyle = errorStyle.Foreground(t.error)
+	infoStyle = infoStyle.Foreground(t.info)
+	warningStyle = warningStyle.Foreground(t.warning)
+}
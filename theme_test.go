@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// keepStyles puts the style variables and colour profile back when the
+// test ends, so a theme applied in it doesn't leak into the others
+func keepStyles(t *testing.T) {
+	t.Helper()
+	styles := []*lipgloss.Style{&titleStyle, &headerStyle, &tableStyle, &successStyle, &errorStyle, &infoStyle, &warningStyle}
+	saved := make([]lipgloss.Style, len(styles))
+	for i, style := range styles {
+		saved[i] = *style
+	}
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	t.Cleanup(func() {
+		for i, style := range styles {
+			*style = saved[i]
+		}
+		lipgloss.SetColorProfile(termenv.Ascii)
+	})
+}
+
+// foreground returns the true-colour escape sequence for hex, e.g.
+// "38;2;46;204;113" for #2ECC71
+func foreground(hex string) string {
+	var r, g, b int
+	fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b)
+	return fmt.Sprintf("38;2;%d;%d;%d", r, g, b)
+}
+
+func TestApplyTheme(t *testing.T) {
+	tests := []struct {
+		theme string
+		// success and error are the hex colours those styles should be
+		// drawn in, or "" for none
+		success, error string
+	}{
+		{"dark", "#2ECC71", "#E74C3C"},
+		{"light", "#1E7B45", "#B03A2E"},
+		{"mono", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.theme, func(t *testing.T) {
+			keepStyles(t)
+			applyTheme(themes[tt.theme])
+
+			for name, c := range map[string]struct {
+				style lipgloss.Style
+				hex   string
+			}{"success": {successStyle, tt.success}, "error": {errorStyle, tt.error}} {
+				got := c.style.Render("x")
+				if c.hex == "" {
+					if strings.Contains(got, "38;") {
+						t.Errorf("%s drawn with a colour: %q", name, got)
+					}
+				} else if !strings.Contains(got, foreground(c.hex)) {
+					t.Errorf("%s = %q, want it drawn in %s", name, got, c.hex)
+				}
+			}
+			// Mono keeps bold titles even without colour
+			if title := titleStyle.Render("x"); !strings.Contains(title, "\x1b[1") {
+				t.Errorf("title lost its bold: %q", title)
+			}
+		})
+	}
+}
+
+func TestThemesDiffer(t *testing.T) {
+	dark, light := themes["dark"], themes["light"]
+	pairs := map[string][2]lipgloss.TerminalColor{
+		"accent":   {dark.accent, light.accent},
+		"onAccent": {dark.onAccent, light.onAccent},
+		"success":  {dark.success, light.success},
+		"error":    {dark.error, light.error},
+		"info":     {dark.info, light.info},
+		"warning":  {dark.warning, light.warning},
+	}
+	for name, pair := range pairs {
+		if pair[0] == nil || pair[1] == nil {
+			t.Errorf("%s is unset in a theme", name)
+		} else if pair[0] == pair[1] {
+			t.Errorf("light %s is the same as dark's", name)
+		}
+	}
+
+	// A whole table comes out differently under each theme
+	rendered := make(map[string]string)
+	for name := range themes {
+		t.Run(name, func(t *testing.T) {
+			keepStyles(t)
+			applyTheme(themes[name])
+			var out strings.Builder
+			if err := reporters["table"].Report(&out, sampleRun()); err != nil {
+				t.Fatal(err)
+			}
+			for other, seen := range rendered {
+				if seen == out.String() {
+					t.Errorf("-theme %s renders the same as %s", name, other)
+				}
+			}
+			rendered[name] = out.String()
+		})
+	}
+}
+
+func TestThemeFlag(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{"dark", false}, {"light", false}, {"mono", false}, {"solarized", true}, {"", true},
+	} {
+		setFlag(t, themeName, tt.name)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-theme %q: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
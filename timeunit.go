@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// timeUnits maps each -time-unit name to the duration one JSON number stands for
+var timeUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// durationKeys are the JSON fields that hold a time.Duration (or a list of
+// them) anywhere in a RunResult or BenchmarkResult. A new duration field
+// must be added here for -time-unit to scale it.
+var durationKeys = map[string]bool{
+	"ping_time":          true,
+	"fetch_time":         true,
+	"resolve_time":       true,
+	"avg_rtt":            true,
+	"trend":              true,
+	"duration":           true,
+	"samples":            true,
+	"retry_after_waited": true,
+	"redirect_time":      true,
+	"final_time":         true,
+	"ttfb":               true,
+	"elapsed":            true,
+	"p50":                true,
+	"p90":                true,
+	"p99":                true,
+	"max":                true,
+}
+
+// encodeTimed writes v, a RunResult or BenchmarkResult, as indented JSON
+// with its durations in unit.
+// Nanoseconds are encoding/json's own form for time.Duration and are
+// written as-is; other units become floats so no precision is lost. The
+// chosen unit is recorded at the top level as "time_unit".
+func encodeTimed(w io.Writer, v any, unit string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if unit == "ns" {
+		return encoder.Encode(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree map[string]any
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+	scaleDurations(tree, timeUnits[unit])
+	tree["time_unit"] = unit
+	return encoder.Encode(tree)
+}
+
+// scaleDurations walks a decoded JSON value, converting every number under
+// a durationKeys field from nanoseconds to unit
+func scaleDurations(value any, unit time.Duration) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if durationKeys[key] {
+				v[key] = scaled(child, unit)
+			} else {
+				scaleDurations(child, unit)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			scaleDurations(child, unit)
+		}
+	}
+}
+
+// scaled converts a nanosecond json.Number, or a list of them, to unit
+func scaled(value any, unit time.Duration) any {
+	switch v := value.(type) {
+	case json.Number:
+		ns, err := v.Int64()
+		if err != nil {
+			return v
+		}
+		return float64(ns) / float64(unit)
+	case []any:
+		for i, child := range v {
+			v[i] = scaled(child, unit)
+		}
+	}
+	return value
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillDurations sets every time.Duration reachable from v through exported
+// struct fields and slices to d, recording the JSON key each one is
+// written under
+func fillDurations(v reflect.Value, d time.Duration, keys map[string]bool) {
+	durationType := reflect.TypeFor[time.Duration]()
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			value := v.Field(i)
+			switch {
+			case field.Type == durationType:
+				value.SetInt(int64(d))
+				keys[name] = true
+			case field.Type.Kind() == reflect.Slice && field.Type.Elem() == durationType:
+				value.Set(reflect.ValueOf([]time.Duration{d}))
+				keys[name] = true
+			case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+				value.Set(reflect.MakeSlice(field.Type, 1, 1))
+				fillDurations(value.Index(0), d, keys)
+			case field.Type.Kind() == reflect.Struct:
+				fillDurations(value, d, keys)
+			}
+		}
+	}
+}
+
+// collectNumbers gathers every value of key anywhere in a decoded JSON tree
+func collectNumbers(value any, key string, found *[]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if k == key {
+				*found = append(*found, child)
+			}
+			collectNumbers(child, key, found)
+		}
+	case []any:
+		for _, child := range v {
+			collectNumbers(child, key, found)
+		}
+	}
+}
+
+func TestEveryDurationFieldIsScaled(t *testing.T) {
+	var run RunResult
+	keys := make(map[string]bool)
+	fillDurations(reflect.ValueOf(&run).Elem(), 1500*time.Millisecond, keys)
+	if !keys["ttfb"] || !keys["avg_rtt"] {
+		t.Fatalf("the walk missed fields it should have found: %v", keys)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeTimed(&buf, run, "ms"); err != nil {
+		t.Fatal(err)
+	}
+	var tree map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	for key := range keys {
+		if !durationKeys[key] {
+			t.Errorf("%q holds a time.Duration but is missing from durationKeys", key)
+			continue
+		}
+		var found []any
+		collectNumbers(tree, key, &found)
+		if len(found) == 0 {
+			t.Errorf("%q is missing from the JSON", key)
+		}
+		for _, value := range found {
+			if list, ok := value.([]any); ok && len(list) == 1 {
+				value = list[0]
+			}
+			if value != 1500.0 {
+				t.Errorf("%q = %v, want 1500 (ms)", key, value)
+			}
+		}
+	}
+}
+
+func TestEncodeTimedUnits(t *testing.T) {
+	run := RunResult{FetchTime: 2500 * time.Millisecond}
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"ns", `"fetch_time": 2500000000`},
+		{"us", `"fetch_time": 2500000`},
+		{"ms", `"fetch_time": 2500`},
+		{"s", `"fetch_time": 2.5`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeTimed(&buf, run, tt.unit); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("output lacks %s:\n%s", tt.want, buf.String())
+			}
+			if hasUnit := strings.Contains(buf.String(), `"time_unit"`); hasUnit != (tt.unit != "ns") {
+				t.Errorf("time_unit recorded = %v for %s", hasUnit, tt.unit)
+			}
+		})
+	}
+}
+
+func TestEncodeTimedKeepsPrecision(t *testing.T) {
+	// An odd number of nanoseconds, which rounding to display precision
+	// would lose, alongside numbers that aren't durations at all
+	run := RunResult{Fetches: []FetchResult{{StatusCode: 200, BodyLength: 1234567, Duration: 1234567891}}}
+	tests := []struct {
+		unit string
+		want float64
+	}{
+		{"ns", 1234567891},
+		{"us", 1234567.891},
+		{"ms", 1234.567891},
+		{"s", 1.234567891},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeTimed(&buf, run, tt.unit); err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Fetches []struct {
+					StatusCode int     `json:"status_code"`
+					BodyLength int     `json:"body_length"`
+					Duration   float64 `json:"duration"`
+				} `json:"fetches"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			fetch := decoded.Fetches[0]
+			if fetch.Duration != tt.want {
+				t.Errorf("duration = %v, want %v", fetch.Duration, tt.want)
+			}
+			if fetch.StatusCode != 200 || fetch.BodyLength != 1234567 {
+				t.Errorf("non-duration fields were scaled: status %d, body %d", fetch.StatusCode, fetch.BodyLength)
+			}
+			if tt.unit == "ns" && strings.Contains(buf.String(), "1234567891.") {
+				t.Error("nanoseconds written as a float")
+			}
+		})
+	}
+}
+
+func TestTimeUnitFlag(t *testing.T) {
+	for _, tt := range []struct {
+		unit    string
+		wantErr bool
+	}{
+		{"ns", false}, {"us", false}, {"ms", false}, {"s", false},
+		{"m", true}, {"µs", true}, {"", true},
+	} {
+		setFlag(t, timeUnit, tt.unit)
+		if err := validateFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("-time-unit %q: error = %v, want error %v", tt.unit, err, tt.wantErr)
+		}
+	}
+
+	// The human table keeps its own formatting whatever the JSON unit
+	var want strings.Builder
+	if err := reporters["table"].Report(&want, sampleRun()); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, timeUnit, "s")
+	var got strings.Builder
+	if err := reporters["table"].Report(&got, sampleRun()); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("-time-unit s changed the table:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// sparkBlocks draw a sample's height in a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkGap marks a cycle where the host failed to answer
+const sparkGap = '·'
+
+// rttHistory keeps the last size average RTTs of each URL across -watch
+// cycles. A zero sample records a cycle where the ping failed.
+type rttHistory struct {
+	size    int
+	samples map[string][]time.Duration
+}
+
+func newRTTHistory(size int) *rttHistory {
+	return &rttHistory{size: size, samples: make(map[string][]time.Duration)}
+}
+
+// record adds the pings of one cycle and sets each result's Trend. URLs
+// missing from the cycle are forgotten, so a host that comes back starts a
+// fresh trend.
+func (h *rttHistory) record(pings []PingResult) {
+	seen := make(map[string]bool, len(pings))
+	for i := range pings {
+		result := &pings[i]
+		if result.Skipped != "" {
+			continue
+		}
+		seen[result.URL] = true
+		sample := result.AvgRtt
+		if result.Error != nil || result.PacketsRecv == 0 {
+			sample = 0
+		}
+		window := append(h.samples[result.URL], sample)
+		if len(window) > h.size {
+			window = window[len(window)-h.size:]
+		}
+		h.samples[result.URL] = window
+		result.Trend = append([]time.Duration(nil), window...)
+	}
+	for url := range h.samples {
+		if !seen[url] {
+			delete(h.samples, url)
+		}
+	}
+}
+
+// sparkline draws samples scaled between their smallest and largest value
+func sparkline(samples []time.Duration) string {
+	var low, high time.Duration
+	for _, sample := range samples {
+		if sample == 0 {
+			continue
+		}
+		if low == 0 || sample < low {
+			low = sample
+		}
+		high = max(high, sample)
+	}
+
+	var b strings.Builder
+	for _, sample := range samples {
+		switch {
+		case sample == 0:
+			b.WriteRune(sparkGap)
+		case high == low:
+			b.WriteRune(sparkBlocks[len(sparkBlocks)/2])
+		default:
+			level := int(float64(sample-low) / float64(high-low) * float64(len(sparkBlocks)-1))
+			b.WriteRune(sparkBlocks[level])
+		}
+	}
+	return b.String()
+}
+
+// hasTrend reports whether any result carries a trend to draw
+func hasTrend(results []PingResult) bool {
+	for _, result := range results {
+		if len(result.Trend) > 0 {
+			return true
+		}
+	}
+	return false
+}
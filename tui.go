@@ -0,0 +1,333 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tuiFlash is how long a row stays highlighted after its status changes
+const tuiFlash = 3 * time.Second
+
+// Widths of the -tui columns before Detail, which gets the rest
+const (
+	tuiPingWidth    = 20
+	tuiFetchWidth   = 24
+	tuiCheckedWidth = 12
+	tuiSinceWidth   = 12
+)
+
+// liveDashboard is the -tui program, fed each ping and fetch result as
+// the watch loop produces it
+type liveDashboard struct {
+	program *tea.Program
+	done    chan struct{}
+	// quitKey is the key the user quit with, q or ctrl+c
+	quitKey string
+}
+
+// dashboard is the running -tui program, or nil
+var dashboard *liveDashboard
+
+// startDashboard takes over the terminal with a live table of urls and
+// calls cancel once the user quits
+func startDashboard(urls []Website, cancel context.CancelFunc) *liveDashboard {
+	model := tuiModel{rows: make(map[string]*tuiRow)}
+	for _, site := range urls {
+		if _, ok := model.rows[site.URL]; !ok {
+			model.order = append(model.order, site.URL)
+			model.rows[site.URL] = &tuiRow{url: site.URL, name: site.Name}
+		}
+	}
+
+	d := &liveDashboard{
+		program: tea.NewProgram(model, tea.WithAltScreen()),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(d.done)
+		defer cancel()
+		final, _ := d.program.Run()
+		if m, ok := final.(tuiModel); ok {
+			d.quitKey = m.quitKey
+		}
+	}()
+	return d
+}
+
+// stop quits the program if it is still running and waits for it to
+// restore the terminal
+func (d *liveDashboard) stop() {
+	if d == nil {
+		return
+	}
+	d.program.Quit()
+	<-d.done
+}
+
+// pinged and fetched hand the dashboard one result as soon as it is in
+func (d *liveDashboard) pinged(result PingResult) {
+	if d != nil {
+		d.program.Send(result)
+	}
+}
+
+func (d *liveDashboard) fetched(result FetchResult) {
+	if d != nil {
+		d.program.Send(result)
+	}
+}
+
+// cycleStarted and cycleDone bracket each run of the watch loop
+func (d *liveDashboard) cycleStarted() {
+	if d != nil {
+		d.program.Send(cycleStartMsg{})
+	}
+}
+
+func (d *liveDashboard) cycleDone(run RunResult) {
+	if d != nil {
+		d.program.Send(cycleDoneMsg{next: time.Now().Add(*watch), partial: run.Aborted})
+	}
+}
+
+// cycleStartMsg and cycleDoneMsg tell the model a run began or ended
+type cycleStartMsg struct{}
+
+type cycleDoneMsg struct {
+	next    time.Time
+	partial bool
+}
+
+// tuiTickMsg redraws the relative times and ends flashes
+type tuiTickMsg time.Time
+
+// tuiRow is the latest state of one URL. Rows are keyed by URL, so each
+// stays on its line however the results arrive.
+type tuiRow struct {
+	url, name string
+	ping      *PingResult
+	fetch     *FetchResult
+	// failing is the state last shown; changedAt is when it last flipped
+	// and flashUntil when the highlight of that flip ends. Rows only flash
+	// once settled by a completed cycle, so the first results don't.
+	known      bool
+	settled    bool
+	failing    bool
+	changedAt  time.Time
+	flashUntil time.Time
+}
+
+// tuiModel is the bubbletea model behind -tui
+type tuiModel struct {
+	order    []string
+	rows     map[string]*tuiRow
+	cycle    int
+	checking bool
+	partial  bool
+	next     time.Time
+	width    int
+	quitKey  string
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tuiTick()
+}
+
+// tuiTick schedules the next tuiTickMsg
+func tuiTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if key := msg.String(); key == "q" || key == "ctrl+c" {
+			m.quitKey = key
+			return m, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tuiTickMsg:
+		return m, tuiTick()
+	case cycleStartMsg:
+		m.cycle++
+		m.checking = true
+	case cycleDoneMsg:
+		m.checking = false
+		m.partial = msg.partial
+		m.next = msg.next
+		for _, row := range m.rows {
+			row.settled = row.known
+		}
+	case PingResult:
+		if row, ok := m.rows[msg.URL]; ok {
+			row.ping = &msg
+			row.update()
+		}
+	case FetchResult:
+		if row, ok := m.rows[msg.URL]; ok {
+			row.fetch = &msg
+			row.update()
+		}
+	}
+	return m, nil
+}
+
+// update recomputes whether the row is failing, flashing it when that
+// changed since the last result
+func (r *tuiRow) update() {
+	failing := (r.ping != nil && pingFailed(*r.ping)) || (r.fetch != nil && fetchFailed(*r.fetch))
+	now := time.Now()
+	if !r.known {
+		r.known, r.failing, r.changedAt = true, failing, now
+		return
+	}
+	if failing != r.failing {
+		r.failing, r.changedAt = failing, now
+		if r.settled {
+			r.flashUntil = now.Add(tuiFlash)
+		}
+	}
+}
+
+func (m tuiModel) View() string {
+	up, down := 0, 0
+	for _, row := range m.rows {
+		if row.known && row.failing {
+			down++
+		} else if row.known {
+			up++
+		}
+	}
+	status := fmt.Sprintf("Cycle %d · next run in %s", m.cycle, time.Until(m.next).Round(time.Second))
+	switch {
+	case m.cycle == 0:
+		status = "Starting..."
+	case m.checking:
+		status = fmt.Sprintf("Cycle %d · checking...", m.cycle)
+	case m.partial:
+		status += " · last run aborted"
+	}
+	counts := successStyle.Render(fmt.Sprintf("%d up", up)) + " · " + errorStyle.Render(fmt.Sprintf("%d down", down))
+
+	detailWidth := m.width - labelWidth - tuiPingWidth - tuiFetchWidth - tuiCheckedWidth - tuiSinceWidth - 2
+	header := []string{
+		headerStyle.Width(labelWidth).Render(siteHeader()),
+		headerStyle.Width(tuiPingWidth).Render("Ping"),
+		headerStyle.Width(tuiFetchWidth).Render("Fetch"),
+		headerStyle.Width(tuiCheckedWidth).Render("Checked"),
+		headerStyle.Width(tuiSinceWidth).Render("Since"),
+	}
+	if detailWidth > 10 {
+		header = append(header, headerStyle.Width(detailWidth).Render("Detail"))
+	}
+	lines := []string{lipgloss.JoinHorizontal(lipgloss.Top, header...)}
+	for _, url := range m.order {
+		lines = append(lines, m.rows[url].render(detailWidth))
+	}
+
+	return strings.Join([]string{
+		titleStyle.Render(" Async Web Data Dashboard ") + "  " + infoStyle.Render(status) + "  " + counts,
+		tableStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...)),
+		infoStyle.Render(" q quit"),
+	}, "\n")
+}
+
+// render draws the row, highlighted in red just after it starts failing
+// and in green just after it recovers
+func (r *tuiRow) render(detailWidth int) string {
+	pingText, pingStyle := tuiPingCell(r.ping)
+	fetchText, fetchStyle := tuiFetchCell(r.fetch)
+	checked, since := "-", "-"
+	var checkedAt time.Time
+	if r.ping != nil {
+		checkedAt = r.ping.CheckedAt
+	}
+	if r.fetch != nil && r.fetch.CheckedAt.After(checkedAt) {
+		checkedAt = r.fetch.CheckedAt
+	}
+	if !checkedAt.IsZero() {
+		checked = formatAgo(checkedAt)
+	}
+	if r.known {
+		since = formatAgo(r.changedAt)
+	}
+
+	labelStyle, checkedStyle := lipgloss.NewStyle(), lipgloss.NewStyle()
+	if time.Now().Before(r.flashUntil) {
+		flash := successStyle.Reverse(true)
+		if r.failing {
+			flash = errorStyle.Reverse(true)
+		}
+		labelStyle, pingStyle, fetchStyle, checkedStyle = flash, flash, flash, flash
+	}
+
+	cells := []string{
+		cellStyle.Inherit(labelStyle).Width(labelWidth).Render(fitCell(siteLabel(r.name, r.url), labelWidth)),
+		cellStyle.Inherit(pingStyle).Width(tuiPingWidth).Render(fitCell(pingText, tuiPingWidth)),
+		cellStyle.Inherit(fetchStyle).Width(tuiFetchWidth).Render(fitCell(fetchText, tuiFetchWidth)),
+		cellStyle.Inherit(checkedStyle).Width(tuiCheckedWidth).Render(checked),
+		cellStyle.Inherit(checkedStyle).Width(tuiSinceWidth).Render(since),
+	}
+	if detailWidth > 10 {
+		cells = append(cells, cellStyle.Inherit(checkedStyle).Width(detailWidth).Render(fitCell(r.detail(), detailWidth)))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+}
+
+// detail is the row's first error, or the notes of its fetch
+func (r *tuiRow) detail() string {
+	switch {
+	case r.ping != nil && r.ping.Error != nil:
+		return "ping: " + r.ping.Error.Error()
+	case r.fetch != nil && r.fetch.Error != nil:
+		return "fetch: " + r.fetch.Error.Error()
+	case r.fetch != nil:
+		return strings.Join(fetchNotes(*r.fetch), ", ")
+	}
+	return ""
+}
+
+// tuiPingCell summarises a ping as its average RTT and any packet loss
+func tuiPingCell(result *PingResult) (string, lipgloss.Style) {
+	switch {
+	case result == nil:
+		return "...", infoStyle
+	case result.Skipped != "":
+		return "skipped", infoStyle
+	case result.Error != nil:
+		return "error", errorStyle
+	}
+	text := formatDuration(result.AvgRtt)
+	if result.PacketLoss > 0 {
+		text += fmt.Sprintf(" · %.0f%% loss", result.PacketLoss)
+	}
+	switch {
+	case pingFailed(*result):
+		return text, errorStyle
+	case result.PacketLoss > *lossWarn:
+		return text, warningStyle
+	}
+	return text, successStyle
+}
+
+// tuiFetchCell summarises a fetch as its status and time, or its error kind
+func tuiFetchCell(result *FetchResult) (string, lipgloss.Style) {
+	switch {
+	case result == nil:
+		return "...", infoStyle
+	case result.Error != nil:
+		return string(cmp.Or(result.ErrorKind, "error")), errorStyle
+	}
+	statusText, style := fetchStatusCell(*result)
+	if fetchFailed(*result) {
+		style = errorStyle
+	}
+	return statusText + " · " + formatDuration(result.Duration), style
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// unixScheme prefixes URLs of the form unix:///path/to.sock:/http/path
+const unixScheme = "unix://"
+
+// unixSocket returns the socket path and the HTTP URL to request over it
+// when the site is served on a Unix domain socket. Sites either set Socket
+// alongside an ordinary http:// URL, or use the unix:// URL form.
+func (w Website) unixSocket() (socketPath, httpURL string, ok bool) {
+	if w.Socket != "" {
+		return w.Socket, w.URL, true
+	}
+	rest, found := strings.CutPrefix(w.URL, unixScheme)
+	if !found {
+		return "", "", false
+	}
+	socketPath, path, _ := strings.Cut(rest, ":")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	// The host is never dialled, it only fills in the request's Host header
+	return socketPath, "http://localhost" + path, true
+}
+
+// unixClient returns a copy of client whose connections all go to the
+// Unix socket at socketPath. QUIC can't run over a stream socket, so under
+// -http3 it keeps only the TCP side.
+func unixClient(client *http.Client, socketPath string) *http.Client {
+	unix := *client
+	unix.Transport = siteTransport(client, func(t *http.Transport) {
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	}, nil)
+	return &unix
+}
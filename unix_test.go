@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	tests := []struct {
+		name         string
+		site         Website
+		socket, http string
+		ok           bool
+	}{
+		{"unix URL", Website{URL: "unix:///var/run/app.sock:/health"}, "/var/run/app.sock", "http://localhost/health", true},
+		{"unix URL without path", Website{URL: "unix:///var/run/app.sock"}, "/var/run/app.sock", "http://localhost/", true},
+		{"unix URL without slash", Website{URL: "unix:///var/run/app.sock:health"}, "/var/run/app.sock", "http://localhost/health", true},
+		{"socket field", Website{URL: "http://app.local/health", Socket: "/tmp/app.sock"}, "/tmp/app.sock", "http://app.local/health", true},
+		{"TCP", Website{URL: "http://app.local/health"}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket, httpURL, ok := tt.site.unixSocket()
+			if socket != tt.socket || httpURL != tt.http || ok != tt.ok {
+				t.Errorf("unixSocket() = %q, %q, %v, want %q, %q, %v", socket, httpURL, ok, tt.socket, tt.http, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFetchUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("no Unix sockets here: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(r.Host))
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name string
+		site Website
+		host string
+	}{
+		{"unix URL", Website{URL: "unix://" + socketPath + ":/health"}, "localhost"},
+		{"socket field", Website{URL: "http://app.local/health", Socket: socketPath}, "app.local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fetchData(context.Background(), newFetchClient(), tt.site, newLimiter(0))
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want the /health path sent over the socket", result.StatusCode)
+			}
+			if result.BodyLength != len(tt.host) {
+				t.Errorf("body length = %d, want the %q Host echoed", result.BodyLength, tt.host)
+			}
+			if result.URL != tt.site.URL {
+				t.Errorf("result URL = %q, want the configured %q", result.URL, tt.site.URL)
+			}
+
+			if ping := pingSite(context.Background(), tt.site, newLimiter(0)); ping.Skipped != "unix socket" || ping.Error != nil {
+				t.Errorf("ping = skipped %q, error %v, want it skipped", ping.Skipped, ping.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// isWebSocket reports whether rawURL is a ws:// or wss:// endpoint
+func isWebSocket(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "ws" || u.Scheme == "wss")
+}
+
+// fetchWebSocket performs the WebSocket opening handshake with target and
+// closes the connection straight away, recording how long the upgrade
+// took. There is no body to read; success is reported as status 101. A
+// non-empty serverName replaces the host in wss:// SNI, and a Host in
+// header replaces the one sent in the handshake.
+func fetchWebSocket(ctx context.Context, target, serverName string, header http.Header, result FetchResult) FetchResult {
+	u, err := url.Parse(target)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	// Servers that check Origin expect the site's own http(s) origin
+	origin := &url.URL{Scheme: "http", Host: u.Host}
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	config, err := websocket.NewConfig(target, origin.String())
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	// x/net/websocket drops a Host in Header, sending Location's instead
+	host := header.Get("Host")
+	config.Header = header.Clone()
+	config.Header.Del("Host")
+	if serverName != "" {
+		config.TlsConfig = &tls.Config{ServerName: serverName}
+	}
+	config.Dialer = &net.Dialer{Resolver: resolver}
+	if *fetchInterface != "" {
+		// validateFlags has already checked the address
+		ip, _ := sourceIP(*fetchInterface)
+		config.Dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	var conn *websocket.Conn
+	if host == "" {
+		conn, err = config.DialContext(ctx)
+	} else {
+		conn, err = dialWithHost(ctx, config, host)
+	}
+	result.Duration = time.Since(start)
+	result.FinalTime = result.Duration
+	if err != nil {
+		// DialError doesn't unwrap, which classifyError needs
+		var dialErr *websocket.DialError
+		if errors.As(err, &dialErr) {
+			err = dialErr.Err
+		}
+		result.Error = fmt.Errorf("websocket handshake: %w", err)
+		return result
+	}
+	conn.Close()
+
+	result.StatusCode = http.StatusSwitchingProtocols
+	result.Proto = "WebSocket"
+	return result
+}
+
+// statusOK reports whether result ended on a success status: a 2xx, or
+// the 101 of a completed WebSocket handshake
+func statusOK(result FetchResult) bool {
+	if result.StatusCode == http.StatusSwitchingProtocols && result.Proto == "WebSocket" {
+		return true
+	}
+	return result.StatusCode >= 200 && result.StatusCode < 300
+}
+
+// dialWithHost connects to the address of config's Location and performs
+// the handshake there, sending host as the Host header. x/net/websocket
+// would dial whatever host Location names, so the connection is made here
+// before Location is pointed at host.
+func dialWithHost(ctx context.Context, config *websocket.Config, host string) (*websocket.Conn, error) {
+	addr := config.Location.Host
+	if config.Location.Port() == "" {
+		port := "80"
+		if config.Location.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(config.Location.Hostname(), port)
+	}
+	conn, err := config.Dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if config.TlsConfig != nil {
+			tlsConfig = config.TlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = config.Location.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	location := *config.Location
+	location.Host = host
+	config.Location = &location
+	// NewClient takes no context, so cancelling ctx cuts the connection off
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestFetchWebSocketHostHeader(t *testing.T) {
+	hosts := make(chan string, 1)
+	echo := websocket.Handler(func(ws *websocket.Conn) { ws.Close() })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		echo.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/socket"
+
+	tests := []struct {
+		name string
+		site Website
+		want string
+	}{
+		{"no override", Website{URL: wsURL}, strings.TrimPrefix(server.URL, "http://")},
+		{"host_header", Website{URL: wsURL, HostHeader: "vhost.example"}, "vhost.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fetchData(context.Background(), newFetchClient(), tt.site, newLimiter(0))
+			if result.Error != nil {
+				t.Fatalf("handshake failed: %v", result.Error)
+			}
+			if result.StatusCode != http.StatusSwitchingProtocols || result.Proto != "WebSocket" {
+				t.Errorf("got %d %s, want 101 WebSocket", result.StatusCode, result.Proto)
+			}
+			if got := <-hosts; got != tt.want {
+				t.Errorf("server saw Host %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("-host-header", func(t *testing.T) {
+		setFlag(t, hostHeader, "global.example")
+		result := fetchData(context.Background(), newFetchClient(), Website{URL: wsURL}, newLimiter(0))
+		if result.Error != nil {
+			t.Fatalf("handshake failed: %v", result.Error)
+		}
+		if got := <-hosts; got != "global.example" {
+			t.Errorf("server saw Host %q, want %q", got, "global.example")
+		}
+	})
+}
+
+func TestFetchWebSocketRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/socket"
+	server.Close()
+	for _, host := range []string{"", "vhost.example"} {
+		site := Website{URL: wsURL, HostHeader: host, Retry: &RetryPolicy{Attempts: 1}}
+		result := fetchData(context.Background(), newFetchClient(), site, newLimiter(0))
+		if result.ErrorKind != ErrorKindRefused {
+			t.Errorf("Host %q: error kind %q, want %q (%v)", host, result.ErrorKind, ErrorKindRefused, result.Error)
+		}
+	}
+}
+
+func TestFetchWebSocketHandshake(t *testing.T) {
+	origins := make(chan string, 1)
+	echo := websocket.Handler(func(ws *websocket.Conn) { io.Copy(ws, ws) })
+	// chatty keeps sending after the upgrade, which a check that read
+	// past the handshake would never finish
+	chatty := websocket.Handler(func(ws *websocket.Conn) {
+		chunk := bytes.Repeat([]byte("x"), 1024)
+		for {
+			if _, err := ws.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origins <- r.Header.Get("Origin")
+		echo.ServeHTTP(w, r)
+	}))
+	mux.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		echo.ServeHTTP(w, r)
+	}))
+	mux.Handle("/chatty", chatty)
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "not a socket") })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		path    string
+		wantErr bool
+		minTime time.Duration
+	}{
+		{"/echo", false, 0},
+		{"/slow", false, 50 * time.Millisecond},
+		{"/chatty", false, 0},
+		{"/plain", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result := fetchData(context.Background(), newFetchClient(), Website{URL: wsURL + tt.path}, newLimiter(0))
+			if tt.wantErr {
+				if result.Error == nil || !strings.Contains(result.Error.Error(), "websocket handshake") {
+					t.Fatalf("got error %v, want a failed handshake", result.Error)
+				}
+				if result.StatusCode == http.StatusSwitchingProtocols {
+					t.Errorf("failed handshake reported as 101")
+				}
+				return
+			}
+			if result.Error != nil {
+				t.Fatalf("handshake failed: %v", result.Error)
+			}
+			if result.StatusCode != http.StatusSwitchingProtocols || result.Proto != "WebSocket" {
+				t.Errorf("got %d %s, want 101 WebSocket", result.StatusCode, result.Proto)
+			}
+			if result.Duration <= tt.minTime || result.FinalTime != result.Duration {
+				t.Errorf("handshake took %s (final %s), want over %s", result.Duration, result.FinalTime, tt.minTime)
+			}
+			if result.BodyLength != 0 {
+				t.Errorf("read %d bytes past the handshake", result.BodyLength)
+			}
+		})
+	}
+
+	if got, want := <-origins, "http://"+strings.TrimPrefix(server.URL, "http://"); got != want {
+		t.Errorf("handshake sent Origin %q, want %q", got, want)
+	}
+}
+
+func TestFetchWebSocketTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(websocket.Handler(func(ws *websocket.Conn) { ws.Close() }))
+	// The rejected handshakes are expected, so keep them out of the output
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	wssURL := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	// The test server's certificate isn't trusted, so both dial paths should
+	// get as far as TLS and fail there rather than falling back to ws://
+	for _, host := range []string{"", "vhost.example"} {
+		result := fetchData(context.Background(), newFetchClient(), Website{URL: wssURL, HostHeader: host}, newLimiter(0))
+		var unknown x509.UnknownAuthorityError
+		if !errors.As(result.Error, &unknown) {
+			t.Errorf("Host %q: got error %v, want an untrusted certificate", host, result.Error)
+		}
+	}
+}
+
+// A passing WebSocket check is a success everywhere its result is judged
+func TestWebSocketSuccessIsHealthy(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) { ws.Close() }))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/socket"
+	result := fetchData(context.Background(), newFetchClient(), Website{URL: wsURL}, newLimiter(0))
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	// A 101 that isn't a finished WebSocket handshake isn't a success,
+	// though like any status below 400 it raises no alert
+	stray := FetchResult{URL: "https://a.example/", StatusCode: http.StatusSwitchingProtocols, Proto: "HTTP/1.1"}
+	tests := []struct {
+		name    string
+		result  FetchResult
+		healthy bool
+	}{
+		{"ws handshake", result, true},
+		{"plain 101", stray, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, style := fetchStatusCell(tt.result); (style.GetForeground() == successStyle.GetForeground()) != tt.healthy {
+				t.Errorf("status cell drawn in %v, want success %v", style.GetForeground(), tt.healthy)
+			}
+			run := RunResult{Fetches: []FetchResult{tt.result}}
+			var out strings.Builder
+			if err := reporters["alerts"].Report(&out, run); err != nil {
+				t.Fatal(err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("-output alerts printed %q", out.String())
+			}
+			want := 0.0
+			if tt.healthy {
+				want = 100
+			}
+			if score, _ := healthScore(run, 0.3); score != want {
+				t.Errorf("health score %v, want %v", score, want)
+			}
+		})
+	}
+}